@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
+	_ "time/tzdata" // users' time zones must load without a system zoneinfo
+	"todos_api/internal/auth"
 	"todos_api/internal/config"
 	"todos_api/internal/database"
 	"todos_api/internal/handlers"
+	"todos_api/internal/jobs"
+	"todos_api/internal/mail"
 	"todos_api/internal/middleware"
+	"todos_api/internal/notify"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -29,6 +36,59 @@ func main() {
 		log.Fatalf("Failed to connect to the database %v", err)
 	}
 	defer pool.Close()
+
+	mailer, err := mail.New(cfg)
+	if err != nil {
+		log.Fatalf("Unable to configure mailer: %v", err)
+	}
+
+	keys, err := auth.LoadKeySet(cfg)
+	if err != nil {
+		log.Fatalf("Unable to load JWT keys: %v", err)
+	}
+
+	passwordHasher, err := auth.NewPasswordHasher(cfg)
+	if err != nil {
+		log.Fatalf("Invalid password hashing configuration: %v", err)
+	}
+
+	passwordPolicy, err := auth.NewPasswordPolicy(cfg)
+	if err != nil {
+		log.Fatalf("Invalid password policy: %v", err)
+	}
+
+	var secretBox *auth.SecretBox
+	if cfg.MFAEncryptionKey != "" {
+		secretBox, err = auth.NewSecretBox(cfg.MFAEncryptionKey)
+		if err != nil {
+			log.Fatalf("Invalid MFA_ENCRYPTION_KEY: %v", err)
+		}
+	} else {
+		log.Println("MFA_ENCRYPTION_KEY not set, two-factor authentication is disabled")
+	}
+
+	oidcProviders := auth.NewOIDCProviders(cfg)
+
+	var csrf *auth.CSRFProtector
+	if cfg.SessionCookies {
+		csrf = auth.NewCSRFProtector(cfg.CSRFSecret)
+	}
+
+	revocations := auth.NewRevocationStore(pool, cfg.RevocationCacheTTL)
+	go revocations.Run(context.Background(), 10*time.Minute)
+
+	loginThrottle := auth.NewLoginThrottle(pool, cfg)
+	go loginThrottle.Run(context.Background(), 10*time.Minute)
+
+	go jobs.RunAccountPurge(context.Background(), pool, cfg.AccountDeletionGracePeriod, time.Hour)
+
+	exportSigner := auth.NewURLSigner(cfg.ExportSigningSecret)
+	exportWorker := jobs.NewExportWorker(pool, cfg)
+	go exportWorker.Run(context.Background(), time.Minute)
+
+	reminderScheduler := jobs.NewReminderScheduler(pool, jobs.SystemClock{}, notify.New(pool, cfg, mailer))
+	go reminderScheduler.Run(context.Background(), cfg.ReminderInterval)
+
 	var router *gin.Engine = gin.Default()
 	router.SetTrustedProxies(nil)
 	router.GET("/", func(c *gin.Context) {
@@ -40,22 +100,119 @@ func main() {
 
 	})
 
-	router.POST("/auth/register", handlers.CreateUserHandler(pool))
-	router.POST("/auth/login", handlers.LoginHandler(pool, cfg))
+	router.GET("/.well-known/jwks.json", handlers.JWKSHandler(keys))
+	router.POST("/auth/register", handlers.CreateUserHandler(pool, cfg, mailer, passwordHasher, passwordPolicy))
+	router.POST("/auth/login", handlers.LoginHandler(pool, cfg, keys, loginThrottle, passwordHasher, csrf))
+	router.POST("/auth/refresh", handlers.RefreshHandler(pool, cfg, keys, csrf))
+	router.GET("/auth/oidc/:provider/login", handlers.OIDCLoginHandler(pool, cfg, oidcProviders, csrf))
+	router.GET("/auth/oidc/:provider/callback", handlers.OIDCCallbackHandler(pool, cfg, keys, oidcProviders, passwordHasher, csrf))
+	router.POST("/auth/mfa/verify", handlers.VerifyMFAHandler(pool, cfg, keys, secretBox, loginThrottle, csrf))
+	router.POST("/auth/logout", middleware.AuthMiddleware(pool, keys, revocations, csrf), handlers.LogoutHandler(pool, cfg, revocations))
+	router.POST("/auth/logout-all", middleware.AuthMiddleware(pool, keys, revocations, csrf), middleware.RequireScope(auth.ScopeAccountAdmin), handlers.LogoutAllHandler(cfg, revocations))
+	router.POST("/auth/password/forgot", handlers.ForgotPasswordHandler(pool, cfg, mailer))
+	router.POST("/auth/password/reset", handlers.ResetPasswordHandler(pool, revocations, passwordHasher, passwordPolicy))
+	router.POST("/auth/verify-email", handlers.VerifyEmailHandler(pool))
+	router.GET("/exports/:id/download", handlers.DownloadExportHandler(pool, exportSigner))
+	router.POST("/auth/verify-email/resend", middleware.AuthMiddleware(pool, keys, revocations, csrf), handlers.ResendVerificationEmailHandler(pool, cfg, mailer))
+
+	mfa := router.Group("/auth/mfa/totp")
+	mfa.Use(middleware.AuthMiddleware(pool, keys, revocations, csrf), middleware.RequireScope(auth.ScopeAccountAdmin))
+	{
+		mfa.POST("/enroll", handlers.EnrollTOTPHandler(pool, cfg, secretBox))
+		mfa.POST("/confirm", handlers.ConfirmTOTPHandler(pool, secretBox))
+		mfa.POST("/disable", handlers.DisableTOTPHandler(pool, secretBox, loginThrottle, passwordHasher))
+	}
+
+	tokens := router.Group("/auth/tokens")
+	tokens.Use(middleware.AuthMiddleware(pool, keys, revocations, csrf), middleware.RequireScope(auth.ScopeAccountAdmin))
+	{
+		tokens.POST("", handlers.CreateTokenHandler(pool))
+		tokens.GET("", handlers.GetTokensHandler(pool))
+		tokens.DELETE("/:id", handlers.RevokeTokenHandler(pool))
+	}
+
+	admin := router.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(pool, keys, revocations, csrf), middleware.RequireScope(auth.ScopeAccountAdmin), middleware.RequireAdmin(pool))
+	{
+		admin.GET("/users", handlers.ListUsersHandler(pool))
+		admin.GET("/users/:id", handlers.GetUserHandler(pool))
+		admin.POST("/users/:id/disable", handlers.DisableUserHandler(pool, revocations))
+		admin.POST("/users/:id/enable", handlers.EnableUserHandler(pool, revocations))
+		admin.POST("/users/:id/force-password-reset", handlers.ForcePasswordResetHandler(pool, cfg, mailer, revocations))
+		admin.POST("/users/:id/restore", handlers.RestoreUserHandler(pool, revocations))
+		admin.POST("/users/:id/unlock", handlers.UnlockUserHandler(pool, loginThrottle))
+		admin.GET("/users/:id/lockout-events", handlers.GetLockoutEventsHandler(pool))
+		admin.POST("/users/:id/impersonate", handlers.ImpersonateUserHandler(pool, cfg, keys))
+		admin.GET("/users/:id/impersonations", handlers.GetImpersonationsHandler(pool))
+		admin.GET("/impersonations/:id/events", handlers.GetImpersonationEventsHandler(pool))
+		admin.DELETE("/impersonations/:id", handlers.EndImpersonationHandler(pool))
+	}
+
+	me := router.Group("/me")
+	me.Use(middleware.AuthMiddleware(pool, keys, revocations, csrf))
+	{
+		me.GET("", handlers.GetMeHandler(pool))
+		me.GET("/identities", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.GetIdentitiesHandler(pool))
+		me.GET("/sessions", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.GetSessionsHandler(pool))
+		me.GET("/notifications", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetNotificationsHandler(pool))
+		me.POST("/notifications/:id/read", middleware.RequireScope(auth.ScopeTodosWrite), handlers.MarkNotificationReadHandler(pool))
+		me.DELETE("/sessions/:id", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.RevokeSessionHandler(cfg, revocations))
+		me.PATCH("", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.UpdateMeHandler(pool))
+		me.DELETE("", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.DeleteMeHandler(pool, cfg, revocations, loginThrottle, passwordHasher))
+		me.POST("/password", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.ChangePasswordHandler(pool, cfg, keys, revocations, loginThrottle, passwordHasher, passwordPolicy, csrf))
+		me.POST("/email", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.ChangeEmailHandler(pool, cfg, mailer, loginThrottle, passwordHasher))
+		me.POST("/export", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.RequestExportHandler(pool, exportWorker))
+		me.GET("/export", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.ListExportsHandler(pool, exportSigner))
+		me.GET("/export/:id", middleware.RequireScope(auth.ScopeAccountAdmin), handlers.GetExportHandler(pool, exportSigner))
+	}
 
 	protected := router.Group("/todos")
-	protected.Use(middleware.AuthMiddleware(cfg))
+	protected.Use(middleware.AuthMiddleware(pool, keys, revocations, csrf))
+	{
+		protected.POST("", middleware.RequireScope(auth.ScopeTodosWrite), middleware.RequireVerifiedEmail(pool, cfg), handlers.CreateToDoHandler(pool))
+		protected.GET("", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetAllTodosHandler(pool))
+		protected.GET("/:id", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetTodoByIDHandler(pool))
+		protected.PUT("/:id", middleware.RequireScope(auth.ScopeTodosWrite), handlers.UpdateTodoHandler(pool))
+		protected.DELETE("/:id", middleware.RequireScope(auth.ScopeTodosWrite), handlers.DeleteTodoHandler(pool))
+		protected.GET("/:id/series", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetTodoSeriesHandler(pool))
+		protected.GET("/:id/subtasks", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetSubtasksHandler(pool))
+		protected.POST("/:id/complete", middleware.RequireScope(auth.ScopeTodosWrite), handlers.CompleteTodoHandler(pool))
+		protected.POST("/:id/skip", middleware.RequireScope(auth.ScopeTodosWrite), handlers.SkipTodoHandler(pool))
+		protected.GET("/:id/reminders", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetRemindersHandler(pool))
+		protected.POST("/:id/reminders", middleware.RequireScope(auth.ScopeTodosWrite), handlers.CreateReminderHandler(pool))
+		protected.DELETE("/:id/reminders/:reminder_id", middleware.RequireScope(auth.ScopeTodosWrite), handlers.DeleteReminderHandler(pool))
+		protected.POST("/:id/reminders/:reminder_id/snooze", middleware.RequireScope(auth.ScopeTodosWrite), handlers.SnoozeReminderHandler(pool))
+		protected.PUT("/:id/tags/:tag_id", middleware.RequireScope(auth.ScopeTodosWrite), handlers.AttachTagHandler(pool))
+		protected.DELETE("/:id/tags/:tag_id", middleware.RequireScope(auth.ScopeTodosWrite), handlers.DetachTagHandler(pool))
+	}
+
+	tags := router.Group("/tags")
+	tags.Use(middleware.AuthMiddleware(pool, keys, revocations, csrf))
 	{
-		protected.POST("", handlers.CreateToDoHandler(pool))
-		protected.GET("", handlers.GetAllTodosHandler(pool))
-		protected.GET("/:id", handlers.GetTodoByIDHandler(pool))
-		protected.PUT("/:id", handlers.UpdateTodoHandler(pool))
-		protected.DELETE("/:id", handlers.DeleteTodoHandler(pool))
-	}
-	router.GET("/protected-test", middleware.AuthMiddleware(cfg), handlers.TestProtectedHandler())
-	
+		tags.GET("", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetTagsHandler(pool))
+		tags.POST("", middleware.RequireScope(auth.ScopeTodosWrite), handlers.CreateTagHandler(pool))
+		tags.PUT("/order", middleware.RequireScope(auth.ScopeTodosWrite), handlers.ReorderTagsHandler(pool))
+		tags.PATCH("/:id", middleware.RequireScope(auth.ScopeTodosWrite), handlers.UpdateTagHandler(pool))
+		tags.DELETE("/:id", middleware.RequireScope(auth.ScopeTodosWrite), handlers.DeleteTagHandler(pool))
+		tags.POST("/:id/merge", middleware.RequireScope(auth.ScopeTodosWrite), handlers.MergeTagHandler(pool))
+	}
+
+	projects := router.Group("/projects")
+	projects.Use(middleware.AuthMiddleware(pool, keys, revocations, csrf))
+	{
+		projects.GET("", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetProjectsHandler(pool))
+		projects.POST("", middleware.RequireScope(auth.ScopeTodosWrite), handlers.CreateProjectHandler(pool))
+		projects.PUT("/order", middleware.RequireScope(auth.ScopeTodosWrite), handlers.ReorderProjectsHandler(pool))
+		projects.GET("/:id", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetProjectHandler(pool))
+		projects.PATCH("/:id", middleware.RequireScope(auth.ScopeTodosWrite), handlers.UpdateProjectHandler(pool))
+		projects.DELETE("/:id", middleware.RequireScope(auth.ScopeTodosWrite), handlers.DeleteProjectHandler(pool))
+		projects.GET("/:id/todos", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetProjectTodosHandler(pool))
+		projects.POST("/:id/todos", middleware.RequireScope(auth.ScopeTodosWrite), handlers.MoveTodosHandler(pool))
+	}
+	router.GET("/protected-test", middleware.AuthMiddleware(pool, keys, revocations, csrf), handlers.TestProtectedHandler())
+
 	if err := router.Run(":" + cfg.Port); err != nil {
-	log.Fatalf("Failed to start server: %v", err)
+		log.Fatalf("Failed to start server: %v", err)
 	}
 
 }
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// breachedPrefixLength is the number of hex characters of the SHA-1 hash
+// used as the index key, as in the Have I Been Pwned range API.
+const breachedPrefixLength = 5
+
+var sha1HexPattern = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+/*
+BreachedPasswords is a local list of passwords known from data breaches.
+
+Passwords are indexed by SHA-1 hash: the first five hex characters pick a
+bucket and the rest of the hash is found by binary search in the sorted
+bucket, so a lookup costs one map access and a few string comparisons
+regardless of the list size. Plain passwords are never kept in memory.
+*/
+type BreachedPasswords struct {
+	buckets map[string][]string
+	count   int
+}
+
+/*
+LoadBreachedPasswords reads a breached password list.
+
+Each line is either a plain password or an uppercase or lowercase SHA-1
+hex hash, optionally followed by ":<count>" as in the Pwned Passwords
+downloads. Blank lines are ignored.
+
+Parameters:
+  path - File to read
+
+Returns:
+  *BreachedPasswords - Indexed list
+  error              - File could not be read
+*/
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	list := &BreachedPasswords{buckets: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if line == "" {
+			continue
+		}
+
+		var hash string
+
+		if sha1HexPattern.MatchString(line) {
+			hash = strings.ToUpper(line[:40])
+		} else {
+			hash = sha1Hex(line)
+		}
+
+		prefix := hash[:breachedPrefixLength]
+		list.buckets[prefix] = append(list.buckets[prefix], hash[breachedPrefixLength:])
+		list.count++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, bucket := range list.buckets {
+		sort.Strings(bucket)
+	}
+
+	return list, nil
+}
+
+// Len returns the number of entries in the list.
+func (b *BreachedPasswords) Len() int {
+	return b.count
+}
+
+// Contains reports whether the password is on the list.
+func (b *BreachedPasswords) Contains(password string) bool {
+	hash := sha1Hex(password)
+	bucket := b.buckets[hash[:breachedPrefixLength]]
+	suffix := hash[breachedPrefixLength:]
+
+	i := sort.SearchStrings(bucket, suffix)
+
+	return i < len(bucket) && bucket[i] == suffix
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
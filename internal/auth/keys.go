@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"todos_api/internal/config"
+
+	"github.com/golang-jwt/jwt"
+)
+
+/*
+SigningKey is an asymmetric JWT key identified by its kid.
+
+Keys loaded from a private key file can sign and verify. Keys loaded from
+a public key file can only verify; they are kept around after a rotation
+so tokens signed with the previous key stay valid until they expire.
+*/
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+/*
+KeySet holds the keys used to sign and verify JWTs.
+
+With JWT_KEYS_DIR set, tokens are signed with the asymmetric key named by
+JWT_SIGNING_KEY_ID (RS256 or EdDSA) and carry its kid in the header. Every
+key in the directory is accepted for verification and published at
+/.well-known/jwks.json, so other services can verify tokens without
+holding any secret.
+
+Without JWT_KEYS_DIR, tokens are signed with HS256 and JWT_SECRET as
+before. When both are configured, HS256 tokens are still accepted, which
+lets tokens issued before the switch run out naturally.
+*/
+type KeySet struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+	secret  []byte
+}
+
+/*
+LoadKeySet builds the key set from the configuration.
+
+Key files in cfg.JWTKeysDir are named "<kid>.pem" and contain a PEM
+encoded RSA or Ed25519 key:
+  - "PRIVATE KEY" (PKCS #8) or "RSA PRIVATE KEY" (PKCS #1): signing key
+  - "PUBLIC KEY" (PKIX): verification-only key
+
+Generate keys with, e.g.:
+  openssl genpkey -algorithm ed25519 -out keys/2026-10.pem
+  openssl genpkey -algorithm rsa -pkeyopt rsa_keygen_bits:2048 -out keys/2026-10.pem
+
+Returns:
+  *KeySet - Loaded keys
+  error   - Unreadable or unsupported key, unknown signing key, or no key
+            material at all
+*/
+func LoadKeySet(cfg *config.Config) (*KeySet, error) {
+	keySet := &KeySet{keys: make(map[string]*SigningKey)}
+
+	if cfg.JWTSecret != "" {
+		keySet.secret = []byte(cfg.JWTSecret)
+	}
+
+	if cfg.JWTKeysDir == "" {
+		if keySet.secret == nil {
+			return nil, errors.New("either JWT_SECRET or JWT_KEYS_DIR must be set")
+		}
+
+		return keySet, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cfg.JWTKeysDir, "*.pem"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+
+		data, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := parseSigningKey(kid, data)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		keySet.keys[kid] = key
+	}
+
+	signingKeyID := cfg.JWTSigningKeyID
+
+	if signingKeyID == "" {
+		var private []string
+
+		for kid, key := range keySet.keys {
+			if key.Private != nil {
+				private = append(private, kid)
+			}
+		}
+
+		if len(private) != 1 {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY_ID must be set when %s does not contain exactly one private key", cfg.JWTKeysDir)
+		}
+
+		signingKeyID = private[0]
+	}
+
+	signing, ok := keySet.keys[signingKeyID]
+
+	if !ok || signing.Private == nil {
+		return nil, fmt.Errorf("no private key with kid %q in %s", signingKeyID, cfg.JWTKeysDir)
+	}
+
+	keySet.signing = signing
+
+	return keySet, nil
+}
+
+// parseSigningKey decodes a PEM encoded RSA or Ed25519 key.
+func parseSigningKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: kid}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", parsed)
+	}
+
+	return key, nil
+}
+
+// Sign signs claims with the active signing key, or with HS256 and
+// JWT_SECRET when no asymmetric key is configured.
+func (k *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	if k.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.ID
+
+	return token.SignedString(k.signing.Private)
+}
+
+/*
+verificationKey is the jwt.Keyfunc used to verify tokens.
+
+The algorithm in the token header is only trusted to pick a key of the
+matching kind: HS256 tokens are checked against JWT_SECRET, asymmetric
+tokens against the key named by their kid, and only if that key uses the
+same algorithm. This prevents algorithm confusion attacks such as using a
+public key as an HMAC secret.
+*/
+func (k *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+
+	if alg == jwt.SigningMethodHS256.Alg() {
+		if k.secret == nil {
+			return nil, fmt.Errorf("unexpected signing method: %v", alg)
+		}
+
+		return k.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown kid: %q", kid)
+	}
+
+	if key.Method.Alg() != alg {
+		return nil, fmt.Errorf("unexpected signing method %v for kid %q", alg, kid)
+	}
+
+	return key.Public, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Alg     string `json:"alg"`
+	N       string `json:"n,omitempty"`
+	E       string `json:"e,omitempty"`
+	Curve   string `json:"crv,omitempty"`
+	X       string `json:"x,omitempty"`
+}
+
+// JWKS returns the public half of every asymmetric key, sorted by kid.
+// HS256 secrets are never published.
+func (k *KeySet) JWKS() []JWK {
+	jwks := []JWK{}
+
+	for _, key := range k.keys {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		jwks = append(jwks, jwk)
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].KeyID < jwks[j].KeyID })
+
+	return jwks
+}
@@ -0,0 +1,388 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Prefixes of login throttle keys.
+const (
+	throttleKeyAccount = "account:"
+	throttleKeyIP      = "ip:"
+	throttleKeyMFA     = "mfa:"
+)
+
+// AccountThrottleKey is the throttle key for login attempts on an email
+// address. It does not depend on whether an account with that address
+// exists.
+func AccountThrottleKey(email string) string {
+	return throttleKeyAccount + strings.ToLower(strings.TrimSpace(email))
+}
+
+// IPThrottleKey is the throttle key for login attempts from a client IP.
+func IPThrottleKey(ip string) string {
+	return throttleKeyIP + ip
+}
+
+// MFAThrottleKey is the throttle key for second-factor attempts of a user.
+func MFAThrottleKey(userID string) string {
+	return throttleKeyMFA + userID
+}
+
+/*
+ThrottlePolicy describes how failed attempts on one key are slowed down.
+
+The first FreeAttempts failures cost nothing. Every further failure blocks
+the key for BaseDelay, doubling each time up to MaxDelay. Reaching
+MaxAttempts locks the key for LockoutDuration. Failures older than
+LockoutDuration are forgotten, so lockouts clear on their own.
+*/
+type ThrottlePolicy struct {
+	FreeAttempts    int
+	MaxAttempts     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+}
+
+// blockFor returns how long a key is blocked after its n-th failure and
+// whether that block is a lockout.
+func (p ThrottlePolicy) blockFor(attempts int) (time.Duration, bool) {
+	if attempts >= p.MaxAttempts {
+		return p.LockoutDuration, true
+	}
+
+	if attempts <= p.FreeAttempts {
+		return 0, false
+	}
+
+	delay := p.BaseDelay
+
+	for i := p.FreeAttempts + 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay, false
+}
+
+/*
+LoginThrottle protects credential checks against brute force.
+
+Attempts are counted per throttle key in Postgres, so limits hold across
+API replicas. Login counts against both the submitted email
+(AccountThrottleKey) and the client IP (IPThrottleKey); the IP limit is
+higher because many users can share an address.
+
+An attempt is counted before the credentials are checked, so parallel
+guesses cannot all get through before the first failure is recorded.
+Typical use:
+
+  attempt, retryAfter, err := throttle.Reserve(accountKey, ipKey)  // before checking
+  attempt.Failure(userID, ip)                                       // on a wrong password
+  attempt.Success()                                                 // on success
+*/
+type LoginThrottle struct {
+	store   throttleStore
+	account ThrottlePolicy
+	ip      ThrottlePolicy
+}
+
+func NewLoginThrottle(pool *pgxpool.Pool, cfg *config.Config) *LoginThrottle {
+	return &LoginThrottle{
+		store: poolThrottleStore{pool},
+		account: ThrottlePolicy{
+			FreeAttempts:    3,
+			MaxAttempts:     cfg.LoginMaxAttempts,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutDuration: cfg.LoginLockoutTTL,
+		},
+		ip: ThrottlePolicy{
+			FreeAttempts:    10,
+			MaxAttempts:     cfg.LoginIPMaxAttempts,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutDuration: cfg.LoginLockoutTTL,
+		},
+	}
+}
+
+// throttleStore keeps one counter per throttle key. ReserveLoginAttempt
+// counts an attempt and reports a block still in force in a single step,
+// so concurrent guesses cannot all slip past the same check.
+type throttleStore interface {
+	ReserveLoginAttempt(key string, windowStart time.Time) (int, *time.Time, error)
+	ReleaseLoginAttempt(key string) error
+	BlockLogin(key string, until time.Time) error
+	ClearLoginThrottle(key string) (bool, error)
+	DeleteStaleLoginThrottles(before time.Time) (int64, error)
+	CreateLockoutEvent(event *models.LockoutEvent) error
+}
+
+type poolThrottleStore struct {
+	pool *pgxpool.Pool
+}
+
+func (s poolThrottleStore) ReserveLoginAttempt(key string, windowStart time.Time) (int, *time.Time, error) {
+	return repository.ReserveLoginAttempt(s.pool, key, windowStart)
+}
+
+func (s poolThrottleStore) ReleaseLoginAttempt(key string) error {
+	return repository.ReleaseLoginAttempt(s.pool, key)
+}
+
+func (s poolThrottleStore) BlockLogin(key string, until time.Time) error {
+	return repository.BlockLogin(s.pool, key, until)
+}
+
+func (s poolThrottleStore) ClearLoginThrottle(key string) (bool, error) {
+	return repository.ClearLoginThrottle(s.pool, key)
+}
+
+func (s poolThrottleStore) DeleteStaleLoginThrottles(before time.Time) (int64, error) {
+	return repository.DeleteStaleLoginThrottles(s.pool, before)
+}
+
+func (s poolThrottleStore) CreateLockoutEvent(event *models.LockoutEvent) error {
+	return repository.CreateLockoutEvent(s.pool, event)
+}
+
+func (t *LoginThrottle) policy(key string) ThrottlePolicy {
+	if strings.HasPrefix(key, throttleKeyIP) {
+		return t.ip
+	}
+
+	return t.account
+}
+
+/*
+LoginAttempt is a credential check that has been counted against its
+throttle keys before it runs. Once the check is done, exactly one of
+Failure, Success or Release must be called.
+*/
+type LoginAttempt struct {
+	throttle *LoginThrottle
+	reserved []reservedKey
+}
+
+// reservedKey is a throttle key an attempt was counted against, with the
+// count that included it.
+type reservedKey struct {
+	key      string
+	attempts int
+}
+
+/*
+Reserve counts an attempt against every given key, unless one of them is
+blocked or already has MaxAttempts attempts in flight or failed. Each key
+is counted in one statement, so concurrent attempts cannot exceed the
+limit.
+
+Returns:
+  *LoginAttempt - The counted attempt, nil if it may not go ahead
+  time.Duration - How long the caller has to wait, 0 if it may go ahead
+  error         - Database error (callers should fail closed)
+*/
+func (t *LoginThrottle) Reserve(keys ...string) (*LoginAttempt, time.Duration, error) {
+	attempt := &LoginAttempt{throttle: t}
+	var retryAfter time.Duration
+
+	for _, key := range keys {
+		policy := t.policy(key)
+
+		attempts, blockedUntil, err := t.store.ReserveLoginAttempt(key, time.Now().Add(-policy.LockoutDuration))
+
+		if err != nil {
+			attempt.Release()
+			return nil, 0, err
+		}
+
+		if blockedUntil != nil {
+			retryAfter = max(retryAfter, time.Until(*blockedUntil), time.Second)
+			continue
+		}
+
+		attempt.reserved = append(attempt.reserved, reservedKey{key: key, attempts: attempts})
+
+		// Earlier attempts still being checked will lock the key if they
+		// fail, and clear it if one succeeds.
+		if attempts > policy.MaxAttempts {
+			retryAfter = max(retryAfter, policy.LockoutDuration)
+		}
+	}
+
+	if retryAfter > 0 {
+		if err := attempt.Release(); err != nil {
+			return nil, 0, err
+		}
+
+		return nil, retryAfter, nil
+	}
+
+	return attempt, 0, nil
+}
+
+/*
+Failure records that the credentials were wrong. Every key is blocked if
+the policy says so for its count; reaching the lockout threshold records
+a lockout event.
+
+Parameters:
+  userID - Account the attempt targeted, nil if unknown
+  ip     - Client IP, for the lockout event
+
+Returns:
+  error - Database error
+*/
+func (a *LoginAttempt) Failure(userID *string, ip string) error {
+	var errs []error
+
+	for _, reserved := range a.reserved {
+		if err := a.throttle.block(reserved.key, reserved.attempts, userID, ip); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// block blocks a key after its n-th failed attempt, as far as the policy
+// asks for.
+func (t *LoginThrottle) block(key string, attempts int, userID *string, ip string) error {
+	delay, locked := t.policy(key).blockFor(attempts)
+
+	if delay <= 0 {
+		return nil
+	}
+
+	until := time.Now().Add(delay)
+
+	if err := t.store.BlockLogin(key, until); err != nil {
+		return err
+	}
+
+	if !locked {
+		return nil
+	}
+
+	log.Printf("Login locked for %s until %s after %d failed attempts", key, until.Format(time.RFC3339), attempts)
+
+	return t.store.CreateLockoutEvent(&models.LockoutEvent{
+		Key:         key,
+		UserID:      userID,
+		Event:       models.LockoutEventLocked,
+		IPAddress:   &ip,
+		LockedUntil: &until,
+	})
+}
+
+// Success forgets the failures of the attempt's keys after the
+// credentials were right. IP keys only get this attempt taken back: an
+// attacker could otherwise reset one by logging into their own account.
+func (a *LoginAttempt) Success() error {
+	var errs []error
+
+	for _, reserved := range a.reserved {
+		var err error
+
+		if strings.HasPrefix(reserved.key, throttleKeyIP) {
+			err = a.throttle.store.ReleaseLoginAttempt(reserved.key)
+		} else {
+			_, err = a.throttle.store.ClearLoginThrottle(reserved.key)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Release takes the attempt back without counting it either way, for
+// checks that could not be made.
+func (a *LoginAttempt) Release() error {
+	var errs []error
+
+	for _, reserved := range a.reserved {
+		if err := a.throttle.store.ReleaseLoginAttempt(reserved.key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	a.reserved = nil
+
+	return errors.Join(errs...)
+}
+
+/*
+Unlock lifts the lockout and backoff of a user's account ahead of time.
+
+Parameters:
+  user    - Account to unlock
+  actorID - Admin performing the unlock
+
+Returns:
+  bool  - true if the account was blocked
+  error - Database error
+*/
+func (t *LoginThrottle) Unlock(user *models.User, actorID string) (bool, error) {
+	key := AccountThrottleKey(user.Email)
+
+	wasBlocked, err := t.store.ClearLoginThrottle(key)
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := t.store.ClearLoginThrottle(MFAThrottleKey(user.ID)); err != nil {
+		return false, err
+	}
+
+	if !wasBlocked {
+		return false, nil
+	}
+
+	return true, t.store.CreateLockoutEvent(&models.LockoutEvent{
+		Key:     key,
+		UserID:  &user.ID,
+		Event:   models.LockoutEventUnlocked,
+		ActorID: &actorID,
+	})
+}
+
+// Run deletes throttle rows that no longer matter on every tick of the
+// given interval until ctx is cancelled.
+func (t *LoginThrottle) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			window := t.account.LockoutDuration
+
+			if t.ip.LockoutDuration > window {
+				window = t.ip.LockoutDuration
+			}
+
+			if _, err := t.store.DeleteStaleLoginThrottles(time.Now().Add(-window)); err != nil {
+				log.Printf("Failed to delete stale login throttles: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"todos_api/internal/models"
+)
+
+// fakeThrottleStore keeps throttle counters in memory. Each method runs
+// under one lock, like the single statements of the repository.
+type fakeThrottleStore struct {
+	mu       sync.Mutex
+	counters map[string]*fakeThrottle
+	events   []models.LockoutEvent
+}
+
+type fakeThrottle struct {
+	attempts     int
+	lastAttempt  time.Time
+	blockedUntil *time.Time
+}
+
+func newFakeThrottleStore() *fakeThrottleStore {
+	return &fakeThrottleStore{counters: make(map[string]*fakeThrottle)}
+}
+
+func (s *fakeThrottleStore) ReserveLoginAttempt(key string, windowStart time.Time) (int, *time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	counter, ok := s.counters[key]
+
+	if !ok {
+		s.counters[key] = &fakeThrottle{attempts: 1, lastAttempt: now}
+		return 1, nil, nil
+	}
+
+	if counter.blockedUntil != nil && counter.blockedUntil.After(now) {
+		blockedUntil := *counter.blockedUntil
+		return counter.attempts, &blockedUntil, nil
+	}
+
+	if counter.lastAttempt.Before(windowStart) {
+		counter.attempts = 1
+	} else {
+		counter.attempts++
+	}
+
+	counter.lastAttempt = now
+
+	return counter.attempts, nil, nil
+}
+
+func (s *fakeThrottleStore) ReleaseLoginAttempt(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if counter, ok := s.counters[key]; ok && counter.attempts > 0 {
+		counter.attempts--
+	}
+
+	return nil
+}
+
+func (s *fakeThrottleStore) BlockLogin(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter := s.counters[key]
+
+	if counter.blockedUntil == nil || counter.blockedUntil.Before(until) {
+		counter.blockedUntil = &until
+	}
+
+	return nil
+}
+
+func (s *fakeThrottleStore) ClearLoginThrottle(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[key]
+	delete(s.counters, key)
+
+	return ok && counter.blockedUntil != nil && counter.blockedUntil.After(time.Now()), nil
+}
+
+func (s *fakeThrottleStore) DeleteStaleLoginThrottles(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeThrottleStore) CreateLockoutEvent(event *models.LockoutEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, *event)
+
+	return nil
+}
+
+func (s *fakeThrottleStore) attempts(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if counter, ok := s.counters[key]; ok {
+		return counter.attempts
+	}
+
+	return 0
+}
+
+func newTestLoginThrottle(store throttleStore) *LoginThrottle {
+	return &LoginThrottle{
+		store: store,
+		account: ThrottlePolicy{
+			FreeAttempts:    3,
+			MaxAttempts:     5,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutDuration: 15 * time.Minute,
+		},
+		ip: ThrottlePolicy{
+			FreeAttempts:    10,
+			MaxAttempts:     100,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutDuration: 15 * time.Minute,
+		},
+	}
+}
+
+func TestLoginThrottleLimitHoldsUnderConcurrency(t *testing.T) {
+	store := newFakeThrottleStore()
+	throttle := newTestLoginThrottle(store)
+	accountKey := AccountThrottleKey("ann@example.com")
+	ipKey := IPThrottleKey("192.0.2.1")
+
+	// Every guess is reserved before any of them fails, as when they
+	// all arrive during the slow password check of the first.
+	const guesses = 50
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var allowed []*LoginAttempt
+	rejected := 0
+
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			attempt, retryAfter, err := throttle.Reserve(accountKey, ipKey)
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if attempt == nil {
+				if retryAfter <= 0 {
+					t.Error("rejected attempt without a Retry-After")
+				}
+
+				rejected++
+				return
+			}
+
+			allowed = append(allowed, attempt)
+		}()
+	}
+
+	wg.Wait()
+
+	if len(allowed) != throttle.account.MaxAttempts {
+		t.Fatalf("%d guesses got through, want %d", len(allowed), throttle.account.MaxAttempts)
+	}
+
+	if rejected != guesses-throttle.account.MaxAttempts {
+		t.Errorf("%d guesses rejected, want %d", rejected, guesses-throttle.account.MaxAttempts)
+	}
+
+	// Rejected guesses do not count against the shared IP.
+	if got := store.attempts(ipKey); got != throttle.account.MaxAttempts {
+		t.Errorf("IP counted %d attempts, want %d", got, throttle.account.MaxAttempts)
+	}
+
+	for _, attempt := range allowed {
+		if err := attempt.Failure(nil, "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(store.events) != 1 || store.events[0].Key != accountKey {
+		t.Fatalf("lockout events = %+v, want one for the account", store.events)
+	}
+
+	attempt, retryAfter, err := throttle.Reserve(accountKey, ipKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempt != nil || retryAfter < 14*time.Minute {
+		t.Errorf("after the lockout Reserve = %v, %v; want a rejection for the lockout", attempt, retryAfter)
+	}
+}
+
+func TestLoginThrottleBacksOffAfterFreeAttempts(t *testing.T) {
+	store := newFakeThrottleStore()
+	throttle := newTestLoginThrottle(store)
+	accountKey := AccountThrottleKey("ann@example.com")
+
+	for i := 1; i <= throttle.account.FreeAttempts; i++ {
+		attempt, retryAfter, err := throttle.Reserve(accountKey)
+
+		if err != nil || attempt == nil {
+			t.Fatalf("attempt %d: Reserve = %v, %v, %v", i, attempt, retryAfter, err)
+		}
+
+		attempt.Failure(nil, "192.0.2.1")
+	}
+
+	attempt, _, err := throttle.Reserve(accountKey)
+
+	if err != nil || attempt == nil {
+		t.Fatalf("the attempt after the free ones was rejected: %v", err)
+	}
+
+	attempt.Failure(nil, "192.0.2.1")
+
+	if attempt, retryAfter, _ := throttle.Reserve(accountKey); attempt != nil || retryAfter <= 0 {
+		t.Errorf("Reserve = %v, %v; want a backoff", attempt, retryAfter)
+	}
+}
+
+func TestLoginThrottleSuccessClearsAccountButNotIP(t *testing.T) {
+	store := newFakeThrottleStore()
+	throttle := newTestLoginThrottle(store)
+	accountKey := AccountThrottleKey("ann@example.com")
+	ipKey := IPThrottleKey("192.0.2.1")
+
+	for i := 0; i < 2; i++ {
+		attempt, _, err := throttle.Reserve(accountKey, ipKey)
+
+		if err != nil || attempt == nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+
+		attempt.Failure(nil, "192.0.2.1")
+	}
+
+	attempt, _, err := throttle.Reserve(accountKey, ipKey)
+
+	if err != nil || attempt == nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	if err := attempt.Success(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.attempts(accountKey); got != 0 {
+		t.Errorf("account has %d attempts after a success, want 0", got)
+	}
+
+	if got := store.attempts(ipKey); got != 2 {
+		t.Errorf("IP has %d attempts after a success, want the 2 failures", got)
+	}
+}
+
+func TestLoginThrottleRelease(t *testing.T) {
+	store := newFakeThrottleStore()
+	throttle := newTestLoginThrottle(store)
+	key := MFAThrottleKey("user-1")
+
+	attempt, _, err := throttle.Reserve(key)
+
+	if err != nil || attempt == nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	if err := attempt.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.attempts(key); got != 0 {
+		t.Errorf("%d attempts after a release, want 0", got)
+	}
+}
+
+func TestThrottlePolicyBlockFor(t *testing.T) {
+	policy := ThrottlePolicy{
+		FreeAttempts:    3,
+		MaxAttempts:     10,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutDuration: 15 * time.Minute,
+	}
+
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+		locked   bool
+	}{
+		{1, 0, false},
+		{3, 0, false},
+		{4, time.Second, false},
+		{5, 2 * time.Second, false},
+		{6, 4 * time.Second, false},
+		{9, 32 * time.Second, false},
+		{10, 15 * time.Minute, true},
+		{50, 15 * time.Minute, true},
+	}
+
+	for _, test := range tests {
+		delay, locked := policy.blockFor(test.attempts)
+
+		if delay != test.delay || locked != test.locked {
+			t.Errorf("blockFor(%d) = %v, %v; want %v, %v", test.attempts, delay, locked, test.delay, test.locked)
+		}
+	}
+}
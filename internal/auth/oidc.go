@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"todos_api/internal/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCClaims is what the API uses from a verified ID token.
+type OIDCClaims struct {
+	Subject       string   `json:"sub"`
+	Email         string   `json:"email"`
+	EmailVerified oidcBool `json:"email_verified"`
+}
+
+// oidcBool accepts both true and "true"; some providers send booleans
+// as strings.
+type oidcBool bool
+
+func (b *oidcBool) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseBool(strings.Trim(string(data), `"`))
+
+	if err != nil {
+		return err
+	}
+
+	*b = oidcBool(value)
+
+	return nil
+}
+
+/*
+OIDCProvider signs users in through an external OpenID Connect identity
+provider with the authorization code flow and PKCE.
+
+The provider's discovery document is fetched on first use rather than at
+startup, so an unreachable identity provider does not keep the API from
+starting; a failed discovery is retried on the next login.
+*/
+type OIDCProvider struct {
+	Name string
+
+	// HTTPClient is used for discovery, the token exchange and fetching
+	// the provider's signing keys. nil means http.DefaultClient.
+	HTTPClient *http.Client
+
+	cfg      config.OIDCProvider
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDCProviders returns the configured identity providers by name.
+func NewOIDCProviders(cfg *config.Config) map[string]*OIDCProvider {
+	providers := make(map[string]*OIDCProvider)
+
+	for _, provider := range cfg.OIDCProviders {
+		providers[provider.Name] = &OIDCProvider{Name: provider.Name, cfg: provider}
+	}
+
+	return providers
+}
+
+// context attaches the provider's HTTP client for go-oidc and oauth2.
+func (p *OIDCProvider) context(ctx context.Context) context.Context {
+	if p.HTTPClient == nil {
+		return ctx
+	}
+
+	return oidc.ClientContext(ctx, p.HTTPClient)
+}
+
+// discover returns the provider metadata, fetching it once.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(p.context(ctx), p.cfg.IssuerURL)
+
+	if err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", p.cfg.IssuerURL, err)
+	}
+
+	p.provider = provider
+
+	return provider, nil
+}
+
+func (p *OIDCProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}
+}
+
+/*
+AuthCodeURL returns the URL to send the user to.
+
+Parameters:
+  ctx      - Bounds discovery, if it has not happened yet
+  state    - Random value the callback must echo back
+  nonce    - Random value the ID token must contain
+  verifier - PKCE code verifier; only its S256 challenge is sent
+
+Returns:
+  string - Authorization URL at the identity provider
+  error  - Discovery failed
+*/
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+	provider, err := p.discover(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	return p.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+/*
+Exchange redeems an authorization code and verifies the ID token that
+comes with it: signature, issuer, audience, expiry and nonce.
+
+Parameters:
+  ctx      - Bounds the token request and key fetch
+  code     - Authorization code from the callback
+  verifier - PKCE code verifier of this login
+  nonce    - Nonce sent with this login
+
+Returns:
+  *OIDCClaims - Subject and email of the signed in user
+  error       - Exchange or verification failed
+*/
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, verifier string, nonce string) (*OIDCClaims, error) {
+	provider, err := p.discover(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = p.context(ctx)
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(ctx, rawIDToken)
+
+	if err != nil {
+		return nil, fmt.Errorf("verifying id_token: %w", err)
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims OIDCClaims
+
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"todos_api/internal/auth/oidctest"
+	"todos_api/internal/config"
+)
+
+// newTestOIDCProvider starts a fake identity provider and returns a
+// provider configured for it.
+func newTestOIDCProvider(t *testing.T) (*OIDCProvider, *oidctest.IdP) {
+	t.Helper()
+
+	idp, err := oidctest.NewIdP("todos-client")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(idp.Close)
+
+	providers := NewOIDCProviders(&config.Config{OIDCProviders: []config.OIDCProvider{{
+		Name:         "test",
+		IssuerURL:    idp.Issuer(),
+		ClientID:     "todos-client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/auth/oidc/test/callback",
+		Scopes:       []string{"openid", "email"},
+	}}})
+
+	provider := providers["test"]
+	provider.HTTPClient = idp.Server.Client()
+
+	return provider, idp
+}
+
+func TestOIDCExchangeReturnsVerifiedClaims(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-with-enough-entropy-0123456789")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state, err := idp.Authorize(authURL, oidctest.Identity{Subject: "user-1", Email: "ann@example.com", EmailVerified: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != "state-1" {
+		t.Errorf("state = %q, want state-1", state)
+	}
+
+	claims, err := provider.Exchange(ctx, code, "verifier-with-enough-entropy-0123456789", "nonce-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != "user-1" || claims.Email != "ann@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestOIDCAuthCodeURLSendsOnlyTheChallenge(t *testing.T) {
+	provider, _ := newTestOIDCProvider(t)
+	verifier := "verifier-with-enough-entropy-0123456789"
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(authURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	challenge := sha256.Sum256([]byte(verifier))
+
+	if got := query.Get("code_challenge"); got != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+		t.Errorf("code_challenge = %q", got)
+	}
+
+	if query.Get("code_challenge_method") != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+
+	if query.Has("code_verifier") {
+		t.Error("the authorization URL reveals the code verifier")
+	}
+
+	if query.Get("nonce") != "nonce-1" || query.Get("state") != "state-1" {
+		t.Errorf("nonce = %q, state = %q", query.Get("nonce"), query.Get("state"))
+	}
+}
+
+func TestOIDCExchangeSendsPKCEVerifier(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	ctx := context.Background()
+	verifier := "verifier-with-enough-entropy-0123456789"
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, err := idp.Authorize(authURL, oidctest.Identity{Subject: "user-1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := idp.TokenRequests()
+
+	if len(requests) != 1 {
+		t.Fatalf("%d token requests, want 1", len(requests))
+	}
+
+	if got := requests[0].Get("code_verifier"); got != verifier {
+		t.Errorf("code_verifier = %q, want %q", got, verifier)
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-with-enough-entropy-0123456789")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, err := idp.Authorize(authURL, oidctest.Identity{Subject: "user-1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Exchange(ctx, code, "another-verifier-with-enough-entropy-0123", "nonce-1"); err == nil {
+		t.Fatal("Exchange succeeded with the verifier of another login")
+	}
+}
+
+func TestOIDCExchangeRejectsNonceMismatch(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	ctx := context.Background()
+	verifier := "verifier-with-enough-entropy-0123456789"
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, err := idp.Authorize(authURL, oidctest.Identity{Subject: "user-1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce-of-another-login"); err == nil {
+		t.Fatal("Exchange accepted an id_token with another login's nonce")
+	}
+}
+
+func TestOIDCExchangeRejectsReusedCode(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	ctx := context.Background()
+	verifier := "verifier-with-enough-entropy-0123456789"
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, err := idp.Authorize(authURL, oidctest.Identity{Subject: "user-1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce-1"); err == nil {
+		t.Fatal("Exchange redeemed the same code twice")
+	}
+}
+
+func TestOIDCBoolAcceptsStrings(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`"true"`, true},
+		{`"false"`, false},
+	}
+
+	for _, test := range tests {
+		var got oidcBool
+
+		if err := got.UnmarshalJSON([]byte(test.input)); err != nil {
+			t.Errorf("UnmarshalJSON(%s): %v", test.input, err)
+			continue
+		}
+
+		if bool(got) != test.want {
+			t.Errorf("UnmarshalJSON(%s) = %v, want %v", test.input, got, test.want)
+		}
+	}
+}
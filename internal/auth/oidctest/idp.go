@@ -0,0 +1,247 @@
+/*
+Package oidctest runs a minimal OpenID Connect identity provider on a
+local httptest server, for testing logins without a real provider.
+
+The provider serves a discovery document, its signing keys and a token
+endpoint. There is no login page: Authorize plays the part of the user
+signing in and returns the code the provider would send to the callback.
+*/
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const keyID = "oidctest"
+
+// Identity is the account a user signs in with at the provider.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// grant is an authorization code waiting to be redeemed.
+type grant struct {
+	identity    Identity
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+/*
+IdP is a fake identity provider. Its issuer URL is Server.URL and it
+accepts a single client, ClientID.
+*/
+type IdP struct {
+	Server   *httptest.Server
+	ClientID string
+
+	key *rsa.PrivateKey
+
+	mu            sync.Mutex
+	grants        map[string]grant
+	tokenRequests []url.Values
+}
+
+// NewIdP starts a provider for one client. Close it when done.
+func NewIdP(clientID string) (*IdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		return nil, err
+	}
+
+	idp := &IdP{ClientID: clientID, key: key, grants: make(map[string]grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+
+	idp.Server = httptest.NewServer(mux)
+
+	return idp, nil
+}
+
+// Close shuts the provider down.
+func (p *IdP) Close() {
+	p.Server.Close()
+}
+
+// Issuer is the provider's issuer URL.
+func (p *IdP) Issuer() string {
+	return p.Server.URL
+}
+
+/*
+Authorize signs identity in at an authorization URL built by the client,
+the way the provider's login page would.
+
+Returns:
+  string - Authorization code for the callback
+  string - State to echo back to the callback
+  error  - The URL is not a valid PKCE authorization request for this
+           provider's client
+*/
+func (p *IdP) Authorize(authURL string, identity Identity) (string, string, error) {
+	parsed, err := url.Parse(authURL)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	query := parsed.Query()
+
+	if parsed.Scheme+"://"+parsed.Host != p.Server.URL || parsed.Path != "/authorize" {
+		return "", "", fmt.Errorf("authorization request sent to %s", authURL)
+	}
+
+	if query.Get("response_type") != "code" || query.Get("client_id") != p.ClientID {
+		return "", "", errors.New("not an authorization code request for this client")
+	}
+
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", errors.New("authorization request has no S256 code challenge")
+	}
+
+	code := rand.Text()
+
+	p.mu.Lock()
+	p.grants[code] = grant{
+		identity:    identity,
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	p.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+// TokenRequests returns the form of every request made to the token
+// endpoint so far.
+func (p *IdP) TokenRequests() []url.Values {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]url.Values(nil), p.tokenRequests...)
+}
+
+func (p *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Server.URL,
+		"authorization_endpoint":                p.Server.URL + "/authorize",
+		"token_endpoint":                        p.Server.URL + "/token",
+		"jwks_uri":                              p.Server.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token redeems an authorization code once, if the client proves it
+// holds the PKCE verifier of the code's challenge.
+func (p *IdP) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, _, ok := r.BasicAuth()
+
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+	}
+
+	code := r.PostForm.Get("code")
+
+	p.mu.Lock()
+	p.tokenRequests = append(p.tokenRequests, r.PostForm)
+	issued, found := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+
+	if clientID != p.ClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" || !found || r.PostForm.Get("redirect_uri") != issued.redirectURI {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != issued.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.Server.URL,
+		"aud":            p.ClientID,
+		"sub":            issued.identity.Subject,
+		"email":          issued.identity.Email,
+		"email_verified": issued.identity.EmailVerified,
+		"nonce":          issued.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = keyID
+
+	signed, err := idToken.SignedString(p.key)
+
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
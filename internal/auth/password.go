@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"todos_api/internal/config"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms accepted in PASSWORD_HASH_ALGORITHM.
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+)
+
+// bcryptMaxPasswordBytes is the longest password bcrypt can hash.
+const bcryptMaxPasswordBytes = 72
+
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+/*
+PasswordHasher hashes and verifies passwords.
+
+Hashes are self-describing strings: argon2id hashes use the PHC string
+format ($argon2id$v=19$m=...,t=...,p=...$salt$hash) and bcrypt hashes
+the usual $2a$/$2b$ format, so a hash carries the parameters needed to
+verify it.
+*/
+type PasswordHasher interface {
+	// Hash returns the encoded hash of a password.
+	Hash(password string) (string, error)
+
+	// Verify reports whether password matches an encoded hash.
+	Verify(password string, encoded string) (bool, error)
+
+	// NeedsRehash reports whether an encoded hash was made with another
+	// algorithm or other parameters than the ones currently configured.
+	NeedsRehash(encoded string) bool
+}
+
+/*
+NewPasswordHasher returns the hasher configured by cfg.
+
+New hashes use cfg.PasswordHashAlgorithm (argon2id by default); hashes of
+either algorithm can always be verified, so existing bcrypt hashes keep
+working and are upgraded by LoginHandler on the next successful login.
+
+Returns:
+  PasswordHasher - Configured hasher
+  error          - Unknown algorithm or invalid cost parameters
+*/
+func NewPasswordHasher(cfg *config.Config) (PasswordHasher, error) {
+	argon := &Argon2idHasher{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+
+	if argon.Memory < 8*uint32(argon.Parallelism) || argon.Iterations < 1 || argon.Parallelism < 1 {
+		return nil, errors.New("invalid argon2id parameters")
+	}
+
+	legacy := &BcryptHasher{Cost: cfg.BcryptCost}
+
+	if legacy.Cost < bcrypt.MinCost || legacy.Cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	switch cfg.PasswordHashAlgorithm {
+	case PasswordHashArgon2id:
+		return &passwordHashers{current: argon, argon2id: argon, bcrypt: legacy}, nil
+	case PasswordHashBcrypt:
+		return &passwordHashers{current: legacy, argon2id: argon, bcrypt: legacy}, nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.PasswordHashAlgorithm)
+	}
+}
+
+// passwordHashers hashes with the current algorithm and verifies hashes
+// of every supported algorithm.
+type passwordHashers struct {
+	current  PasswordHasher
+	argon2id *Argon2idHasher
+	bcrypt   *BcryptHasher
+}
+
+func (h *passwordHashers) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *passwordHashers) Verify(password string, encoded string) (bool, error) {
+	hasher, err := h.hasherFor(encoded)
+
+	if err != nil {
+		return false, err
+	}
+
+	return hasher.Verify(password, encoded)
+}
+
+func (h *passwordHashers) NeedsRehash(encoded string) bool {
+	hasher, err := h.hasherFor(encoded)
+
+	return err != nil || hasher != h.current || hasher.NeedsRehash(encoded)
+}
+
+// hasherFor picks the hasher that made an encoded hash.
+func (h *passwordHashers) hasherFor(encoded string) (PasswordHasher, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return h.argon2id, nil
+	case strings.HasPrefix(encoded, "$2"):
+		return h.bcrypt, nil
+	default:
+		return nil, ErrUnknownPasswordHash
+	}
+}
+
+// Argon2idHasher hashes passwords with argon2id (RFC 9106). Memory is in
+// KiB.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Memory,
+		h.Iterations,
+		h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password string, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != h.Memory ||
+		params.Iterations != h.Iterations ||
+		params.Parallelism != h.Parallelism ||
+		uint32(len(salt)) != h.SaltLength ||
+		uint32(len(key)) != h.KeyLength
+}
+
+// decodeArgon2id parses a PHC string produced by Argon2idHasher.Hash.
+func decodeArgon2id(encoded string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	params := &Argon2idHasher{}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if params.Iterations < 1 || params.Parallelism < 1 || len(key) == 0 {
+		return nil, nil, nil, errors.New("invalid argon2 parameters")
+	}
+
+	return params, salt, key, nil
+}
+
+// BcryptHasher hashes passwords with bcrypt. bcrypt only looks at the
+// first 72 bytes of a password, so Hash rejects longer ones instead of
+// silently truncating them.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(password string, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost != h.Cost
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"todos_api/internal/config"
+	"unicode/utf8"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// minEmailFragmentLength is the shortest part of an email address that a
+// password may not contain, so short local parts like "al" do not reject
+// half of all passwords.
+const minEmailFragmentLength = 3
+
+/*
+PasswordPolicy decides which new passwords are acceptable.
+
+A password must:
+  - have between MinLength and MaxLength characters
+  - fit in MaxBytes bytes, if set, since bcrypt cannot hash longer
+    passwords
+  - not contain the account's email address or its local part
+  - not appear in the breached password list, if one is configured
+  - reach MinScore on the zxcvbn strength scale (0 = too guessable,
+    4 = very unguessable)
+
+The same policy applies to registration, password change and password
+reset.
+*/
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	MaxBytes  int
+	MinScore  int
+	Breached  *BreachedPasswords
+}
+
+/*
+NewPasswordPolicy builds the policy configured by cfg, loading the
+breached password list if cfg.BreachedPasswordsFile is set. When new
+hashes use bcrypt, passwords are also limited to the 72 bytes bcrypt can
+hash, whatever cfg.PasswordMaxLength allows.
+
+Returns:
+  *PasswordPolicy - Configured policy
+  error           - Invalid bounds or unreadable breached password list
+*/
+func NewPasswordPolicy(cfg *config.Config) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength: cfg.PasswordMinLength,
+		MaxLength: cfg.PasswordMaxLength,
+		MinScore:  cfg.PasswordMinScore,
+	}
+
+	if policy.MinLength < 1 || policy.MaxLength < policy.MinLength {
+		return nil, errors.New("password length bounds are invalid")
+	}
+
+	if cfg.PasswordHashAlgorithm == PasswordHashBcrypt {
+		policy.MaxBytes = bcryptMaxPasswordBytes
+	}
+
+	if policy.MinScore < 0 || policy.MinScore > 4 {
+		return nil, errors.New("password minimum score must be between 0 and 4")
+	}
+
+	if cfg.BreachedPasswordsFile != "" {
+		breached, err := LoadBreachedPasswords(cfg.BreachedPasswordsFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("loading breached passwords: %w", err)
+		}
+
+		log.Printf("Loaded %d breached passwords", breached.Len())
+
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+/*
+Check validates a new password for the account with the given email.
+
+Parameters:
+  password - Proposed password
+  email    - Email address of the account
+
+Returns:
+  error - Explanation for the user if the password is rejected, nil
+          otherwise
+*/
+func (p *PasswordPolicy) Check(password string, email string) error {
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters long", p.MinLength)
+	}
+
+	if length > p.MaxLength {
+		return fmt.Errorf("Password must be at most %d characters long", p.MaxLength)
+	}
+
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return fmt.Errorf("Password must be at most %d bytes long, accented letters and symbols count as more than one", p.MaxBytes)
+	}
+
+	lowerPassword := strings.ToLower(password)
+	userInputs := emailFragments(email)
+
+	for _, fragment := range userInputs {
+		if strings.Contains(lowerPassword, fragment) {
+			return errors.New("Password must not contain your email address")
+		}
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		return errors.New("Password has appeared in a data breach, please choose another one")
+	}
+
+	if p.MinScore > 0 && zxcvbn.PasswordStrength(password, userInputs).Score < p.MinScore {
+		return errors.New("Password is too easy to guess, try a longer passphrase or a less common combination")
+	}
+
+	return nil
+}
+
+// emailFragments returns the lowercased address and its local part, if
+// long enough to be meaningful.
+func emailFragments(email string) []string {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if email == "" {
+		return nil
+	}
+
+	fragments := []string{email}
+
+	if at := strings.LastIndex(email, "@"); at >= minEmailFragmentLength {
+		fragments = append(fragments, email[:at])
+	}
+
+	return fragments
+}
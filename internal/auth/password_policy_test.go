@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"todos_api/internal/config"
+)
+
+func TestPasswordPolicyKeepsBcryptPasswordsHashable(t *testing.T) {
+	cfg := &config.Config{
+		PasswordHashAlgorithm: PasswordHashBcrypt,
+		PasswordMinLength:     8,
+		PasswordMaxLength:     128,
+		BcryptCost:            4,
+		Argon2Memory:          64,
+		Argon2Iterations:      1,
+		Argon2Parallelism:     1,
+	}
+
+	policy, err := NewPasswordPolicy(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasher, err := NewPasswordHasher(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		accepted bool
+	}{
+		{"72 ASCII bytes", strings.Repeat("a", 72), true},
+		{"73 ASCII bytes", strings.Repeat("a", 73), false},
+		{"40 two-byte characters", strings.Repeat("é", 40), false},
+		{"36 two-byte characters", strings.Repeat("é", 36), true},
+	}
+
+	for _, test := range tests {
+		err := policy.Check(test.password, "ann@example.com")
+
+		if (err == nil) != test.accepted {
+			t.Errorf("%s: Check = %v, want accepted %v", test.name, err, test.accepted)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if _, err := hasher.Hash(test.password); err != nil {
+			t.Errorf("%s: accepted by the policy but Hash = %v", test.name, err)
+		}
+	}
+}
+
+func TestPasswordPolicyWithArgon2idAllowsLongPasswords(t *testing.T) {
+	policy, err := NewPasswordPolicy(&config.Config{
+		PasswordHashAlgorithm: PasswordHashArgon2id,
+		PasswordMinLength:     8,
+		PasswordMaxLength:     128,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := policy.Check(strings.Repeat("é", 100), "ann@example.com"); err != nil {
+		t.Errorf("Check = %v, want a 100 character password accepted", err)
+	}
+}
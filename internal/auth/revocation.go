@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+	"todos_api/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+RevocationStore decides whether an otherwise valid access token has been
+revoked.
+
+Three kinds of revocation are supported:
+  - Single token: the token's jti is stored in the revoked_tokens table
+    (used by /auth/logout for tokens without a session)
+  - Every token of a session: the session's row is marked revoked (used by
+    /auth/logout and DELETE /me/sessions/:id)
+  - Every token of a user: users.tokens_invalid_before is moved forward and
+    any token with an older iat is rejected (used by /auth/logout-all and
+    password changes)
+
+Postgres is the source of truth so revocations are shared between API
+replicas. Lookups are cached in-process so AuthMiddleware does not hit the
+database on every request:
+  - Revocations made by this process are visible immediately
+  - Known-revoked jtis are cached until the token expires
+  - "Not revoked" answers, user states and session states are cached for
+    cacheTTL, which bounds how long a revocation made on another replica
+    can go unnoticed
+
+Tokens of disabled accounts, and of accounts scheduled for deletion, are
+treated as revoked as well.
+*/
+type RevocationStore struct {
+	pool     *pgxpool.Pool
+	cacheTTL time.Duration
+
+	mu            sync.Mutex
+	revoked       map[string]time.Time
+	notRevoked    map[string]time.Time
+	userStates    map[string]userStateEntry
+	sessionStates map[string]sessionStateEntry
+}
+
+type userStateEntry struct {
+	cutoff   *time.Time
+	disabled bool
+	loadedAt time.Time
+}
+
+type sessionStateEntry struct {
+	revoked    bool
+	lastSeenAt time.Time
+	loadedAt   time.Time
+}
+
+// sessionTouchInterval limits how often last_seen_at is written for a busy
+// session.
+const sessionTouchInterval = time.Minute
+
+// staleSessionRetention is how long a session is kept after it was revoked
+// or its refresh tokens expired. It is longer than any access token lives,
+// so tokens of a deleted session are rejected as unknown rather than
+// accepted.
+const staleSessionRetention = 24 * time.Hour
+
+func NewRevocationStore(pool *pgxpool.Pool, cacheTTL time.Duration) *RevocationStore {
+	return &RevocationStore{
+		pool:          pool,
+		cacheTTL:      cacheTTL,
+		revoked:       make(map[string]time.Time),
+		notRevoked:    make(map[string]time.Time),
+		userStates:    make(map[string]userStateEntry),
+		sessionStates: make(map[string]sessionStateEntry),
+	}
+}
+
+/*
+RevokeToken revokes a single access token until it expires.
+
+Parameters:
+  claims - Verified claims of the token being revoked
+
+Returns:
+  error - Database error
+*/
+func (s *RevocationStore) RevokeToken(claims *AccessClaims) error {
+	if claims.JTI == "" {
+		return nil
+	}
+
+	if err := repository.RevokeToken(s.pool, claims.JTI, claims.UserID, claims.ExpiresAt); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revoked[claims.JTI] = claims.ExpiresAt
+	delete(s.notRevoked, claims.JTI)
+	s.mu.Unlock()
+
+	return nil
+}
+
+/*
+RevokeSession signs a session out. Its refresh tokens stop working and
+its access tokens are rejected from now on.
+
+Parameters:
+  userID    - Owner of the session
+  sessionID - Session to revoke
+
+Returns:
+  error - pgx.ErrNoRows if the user has no such active session, or a
+          database error
+*/
+func (s *RevocationStore) RevokeSession(userID string, sessionID string) error {
+	if err := repository.RevokeSession(s.pool, sessionID, userID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.sessionStates[sessionID] = sessionStateEntry{revoked: true, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return nil
+}
+
+/*
+RevokeAllForUser revokes every access and refresh token a user holds.
+
+This is used for "log out everywhere", password changes and password
+resets.
+
+Parameters:
+  userID - User whose tokens are revoked
+
+Returns:
+  error - Database error
+*/
+func (s *RevocationStore) RevokeAllForUser(userID string) error {
+	cutoff := time.Now()
+
+	if err := repository.SetTokensInvalidBefore(s.pool, userID, cutoff); err != nil {
+		return err
+	}
+
+	if err := repository.RevokeAllRefreshTokensForUser(s.pool, userID); err != nil {
+		return err
+	}
+
+	if err := repository.RevokeAllSessionsForUser(s.pool, userID); err != nil {
+		return err
+	}
+
+	s.ForgetUser(userID)
+
+	return nil
+}
+
+// ForgetUser drops the cached state of a user so the next token check
+// reads it from the database again. Call it after disabling or enabling
+// an account.
+func (s *RevocationStore) ForgetUser(userID string) {
+	s.mu.Lock()
+	delete(s.userStates, userID)
+	s.mu.Unlock()
+}
+
+/*
+IsRevoked reports whether a verified access token has been revoked.
+
+Returns:
+  bool  - true if the token must be rejected
+  error - Database error (callers should fail closed)
+*/
+func (s *RevocationStore) IsRevoked(claims *AccessClaims) (bool, error) {
+	state, err := s.userState(claims.UserID)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// The user no longer exists, so none of their tokens are valid.
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	if state.disabled {
+		return true, nil
+	}
+
+	if state.cutoff != nil && claims.IssuedAt.Before(state.cutoff.Truncate(time.Second)) {
+		return true, nil
+	}
+
+	if claims.SessionID != "" {
+		session, err := s.sessionState(claims.SessionID)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return true, nil
+			}
+
+			return false, err
+		}
+
+		if session.revoked {
+			return true, nil
+		}
+	}
+
+	if claims.JTI == "" {
+		return false, nil
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	if _, ok := s.revoked[claims.JTI]; ok {
+		s.mu.Unlock()
+		return true, nil
+	}
+	if checkedAt, ok := s.notRevoked[claims.JTI]; ok && now.Sub(checkedAt) < s.cacheTTL {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.mu.Unlock()
+
+	revoked, err := repository.IsTokenRevoked(s.pool, claims.JTI)
+
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	if revoked {
+		s.revoked[claims.JTI] = claims.ExpiresAt
+	} else {
+		s.notRevoked[claims.JTI] = now
+	}
+	s.mu.Unlock()
+
+	return revoked, nil
+}
+
+func (s *RevocationStore) userState(userID string) (userStateEntry, error) {
+	s.mu.Lock()
+	entry, ok := s.userStates[userID]
+	s.mu.Unlock()
+
+	if ok && time.Since(entry.loadedAt) < s.cacheTTL {
+		return entry, nil
+	}
+
+	cutoff, disabled, err := repository.GetUserTokenState(s.pool, userID)
+
+	if err != nil {
+		return userStateEntry{}, err
+	}
+
+	entry = userStateEntry{cutoff: cutoff, disabled: disabled, loadedAt: time.Now()}
+
+	s.mu.Lock()
+	s.userStates[userID] = entry
+	s.mu.Unlock()
+
+	return entry, nil
+}
+
+func (s *RevocationStore) sessionState(sessionID string) (sessionStateEntry, error) {
+	s.mu.Lock()
+	entry, ok := s.sessionStates[sessionID]
+	s.mu.Unlock()
+
+	if ok && (entry.revoked || time.Since(entry.loadedAt) < s.cacheTTL) {
+		return entry, nil
+	}
+
+	revoked, lastSeenAt, err := repository.GetSessionState(s.pool, sessionID)
+
+	if err != nil {
+		return sessionStateEntry{}, err
+	}
+
+	entry = sessionStateEntry{revoked: revoked, lastSeenAt: lastSeenAt, loadedAt: time.Now()}
+
+	s.mu.Lock()
+	s.sessionStates[sessionID] = entry
+	s.mu.Unlock()
+
+	return entry, nil
+}
+
+/*
+TouchSession records that a session was just used, for the "last seen"
+time shown in the session list.
+
+The write happens in the background and at most once per
+sessionTouchInterval and replica, so busy sessions do not cost a write
+per request. Call it only after IsRevoked accepted a token of the
+session.
+*/
+func (s *RevocationStore) TouchSession(sessionID string) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.sessionStates[sessionID]
+
+	if !ok || now.Sub(entry.lastSeenAt) < sessionTouchInterval {
+		s.mu.Unlock()
+		return
+	}
+
+	entry.lastSeenAt = now
+	s.sessionStates[sessionID] = entry
+	s.mu.Unlock()
+
+	go func() {
+		if err := repository.TouchSession(s.pool, sessionID, sessionTouchInterval); err != nil {
+			log.Printf("Failed to update last_seen_at for session %s: %v", sessionID, err)
+		}
+	}()
+}
+
+/*
+Prune drops expired entries from the in-process cache and from the
+revoked_tokens table, and deletes stale sessions. It is meant to be
+called periodically, see Run.
+*/
+func (s *RevocationStore) Prune() {
+	now := time.Now()
+
+	s.mu.Lock()
+	for jti, expiresAt := range s.revoked {
+		if now.After(expiresAt) {
+			delete(s.revoked, jti)
+		}
+	}
+	for jti, checkedAt := range s.notRevoked {
+		if now.Sub(checkedAt) >= s.cacheTTL {
+			delete(s.notRevoked, jti)
+		}
+	}
+	for userID, entry := range s.userStates {
+		if now.Sub(entry.loadedAt) >= s.cacheTTL {
+			delete(s.userStates, userID)
+		}
+	}
+	for sessionID, entry := range s.sessionStates {
+		if now.Sub(entry.loadedAt) >= s.cacheTTL {
+			delete(s.sessionStates, sessionID)
+		}
+	}
+	s.mu.Unlock()
+
+	if _, err := repository.DeleteExpiredRevokedTokens(s.pool); err != nil {
+		log.Printf("Failed to delete expired revoked tokens: %v", err)
+	}
+
+	if _, err := repository.DeleteStaleSessions(s.pool, now.Add(-staleSessionRetention)); err != nil {
+		log.Printf("Failed to delete stale sessions: %v", err)
+	}
+}
+
+// Run calls Prune on every tick of the given interval until ctx is cancelled.
+func (s *RevocationStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Prune()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import "fmt"
+
+/*
+Scopes limit what a token may do.
+
+  todos:read    - Read todos
+  todos:write   - Create, update and delete todos (does not imply read)
+  account:admin - Manage the account itself: tokens, two-factor settings,
+                  signing out everywhere
+
+Tokens from /auth/login carry every scope unless the client asks for
+fewer; personal access tokens carry only the scopes chosen when they were
+created. Routes declare what they need with middleware.RequireScope.
+*/
+const (
+	ScopeTodosRead    = "todos:read"
+	ScopeTodosWrite   = "todos:write"
+	ScopeAccountAdmin = "account:admin"
+)
+
+// AllScopes lists every scope a token can be granted.
+var AllScopes = []string{ScopeTodosRead, ScopeTodosWrite, ScopeAccountAdmin}
+
+// IsValidScope reports whether scope is one of AllScopes.
+func IsValidScope(scope string) bool {
+	for _, known := range AllScopes {
+		if scope == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ResolveScopes validates the scopes a client asked for.
+
+An empty request means "every scope", which is what interactive logins
+get by default.
+
+Returns:
+  []string - Deduplicated scopes to grant
+  error    - If any requested scope is unknown
+*/
+func ResolveScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return AllScopes, nil
+	}
+
+	resolved := make([]string, 0, len(requested))
+	seen := make(map[string]bool)
+
+	for _, scope := range requested {
+		if !IsValidScope(scope) {
+			return nil, fmt.Errorf("Unknown scope: %s", scope)
+		}
+
+		if !seen[scope] {
+			seen[scope] = true
+			resolved = append(resolved, scope)
+		}
+	}
+
+	return resolved, nil
+}
+
+// HasScope reports whether scopes contains scope.
+func HasScope(scopes []string, scope string) bool {
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
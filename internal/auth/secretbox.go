@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+/*
+SecretBox encrypts small secrets (such as TOTP seeds) before they are
+written to the database, using AES-256-GCM.
+
+The stored format is nonce || ciphertext || tag. The key comes from
+MFA_ENCRYPTION_KEY and must be 32 bytes, base64 encoded.
+*/
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+var ErrSecretBoxDecrypt = errors.New("unable to decrypt secret")
+
+// NewSecretBox parses a base64 encoded 32-byte key.
+func NewSecretBox(encodedKey string) (*SecretBox, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretBox{aead: aead}, nil
+}
+
+// Seal encrypts plaintext. additionalData (e.g. the user ID) binds the
+// ciphertext to its owner so it cannot be copied to another row.
+func (b *SecretBox) Seal(plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return b.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts a value produced by Seal with the same additionalData.
+func (b *SecretBox) Open(sealed []byte, additionalData []byte) ([]byte, error) {
+	nonceSize := b.aead.NonceSize()
+
+	if len(sealed) < nonceSize {
+		return nil, ErrSecretBoxDecrypt
+	}
+
+	plaintext, err := b.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], additionalData)
+
+	if err != nil {
+		return nil, ErrSecretBoxDecrypt
+	}
+
+	return plaintext, nil
+}
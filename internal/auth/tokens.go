@@ -0,0 +1,421 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+
+	"github.com/golang-jwt/jwt"
+)
+
+/*
+GenerateAccessToken signs a short-lived JWT access token for a user.
+
+The token lifetime is controlled by cfg.AccessTokenTTL so clients are
+expected to renew it through /auth/refresh instead of re-sending
+credentials. It is signed with the active key of the key set.
+
+Claims:
+  typ     - Always "access"
+  user_id - ID of the authenticated user
+  email   - Email of the authenticated user
+  role    - Role of the user ("user" or "admin")
+  jti     - Unique token ID, used to revoke this single token
+  sid     - Session the token belongs to, used to revoke the session
+  scope   - Space separated list of granted scopes
+  iat     - Issued-at timestamp
+  exp     - Expiration timestamp
+
+Returns:
+  string    - Signed JWT
+  time.Time - Expiration time of the token
+  error     - Signing error
+*/
+func GenerateAccessToken(cfg *config.Config, keys *KeySet, user *models.User, sessionID string, scopes []string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(cfg.AccessTokenTTL)
+
+	jti, err := GenerateTokenID()
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := jwt.MapClaims{
+		"typ":     TokenTypeAccess,
+		"user_id": user.ID,
+		"email":   user.Email,
+		"role":    user.Role,
+		"jti":     jti,
+		"sid":     sessionID,
+		"scope":   strings.Join(scopes, " "),
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	}
+
+	tokenString, err := keys.Sign(claims)
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+/*
+GenerateImpersonationToken signs an access token that lets an admin act as
+another user.
+
+It carries the same claims as a normal access token for the user, plus:
+  act - {"sub": "<admin ID>"}, the acting admin (RFC 8693)
+  imp - ID of the impersonation record, under which every request made
+        with the token is audited
+
+There is no session and no refresh token: once it expires, the admin has
+to start a new impersonation.
+
+Returns:
+  string - Signed JWT
+  error  - Signing error
+*/
+func GenerateImpersonationToken(keys *KeySet, user *models.User, impersonation *models.Impersonation) (string, error) {
+	jti, err := GenerateTokenID()
+
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"typ":     TokenTypeAccess,
+		"user_id": user.ID,
+		"email":   user.Email,
+		"role":    user.Role,
+		"jti":     jti,
+		"act":     map[string]string{"sub": impersonation.AdminID},
+		"imp":     impersonation.ID,
+		"scope":   strings.Join(impersonation.Scopes, " "),
+		"iat":     impersonation.CreatedAt.Unix(),
+		"exp":     impersonation.ExpiresAt.Unix(),
+	}
+
+	return keys.Sign(claims)
+}
+
+// AccessClaims holds the verified claims of an access token.
+// ImpersonatorID and ImpersonationID are only set on impersonation tokens.
+type AccessClaims struct {
+	UserID          string
+	Email           string
+	Role            string
+	JTI             string
+	SessionID       string
+	ImpersonatorID  string
+	ImpersonationID string
+	Scopes          []string
+	IssuedAt        time.Time
+	ExpiresAt       time.Time
+}
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Values of the typ claim. Tokens of one type are never accepted where
+// another type is expected.
+const (
+	TokenTypeAccess     = "access"
+	TokenTypeMFAPending = "mfa_pending"
+)
+
+// mfaTokenTTL is how long a user has to enter their TOTP code after
+// passing the password step.
+const mfaTokenTTL = 5 * time.Minute
+
+/*
+ParseAccessToken verifies an access token and extracts its claims.
+
+This function:
+  1. Verifies the signature against the key set
+  2. Rejects tokens of any other type (e.g. "mfa pending" tokens)
+  3. Validates the exp claim
+  4. Requires a user_id claim
+
+Tokens issued before jti/iat/sid were introduced are still accepted;
+their JTI, IssuedAt and SessionID fields are left empty. Tokens without a role claim get
+an empty Role.
+
+The role claim is informational, for clients deciding what to show;
+RequireAdmin checks the role in the database so demotions take effect
+immediately.
+
+Returns:
+  *AccessClaims - Verified claims
+  error         - ErrInvalidToken if the token cannot be trusted
+*/
+func ParseAccessToken(keys *KeySet, tokenString string) (*AccessClaims, error) {
+	claims, err := parseToken(keys, tokenString)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens minted before the typ claim existed are access tokens.
+	if typ, ok := claims["typ"].(string); ok && typ != TokenTypeAccess {
+		return nil, ErrInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(string)
+
+	if !ok || userID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	accessClaims := &AccessClaims{UserID: userID}
+	accessClaims.Email, _ = claims["email"].(string)
+	accessClaims.Role, _ = claims["role"].(string)
+	accessClaims.JTI, _ = claims["jti"].(string)
+	accessClaims.SessionID, _ = claims["sid"].(string)
+
+	// An impersonation token is only usable together with the record its
+	// requests are audited under.
+	if act, present := claims["act"]; present {
+		actor, _ := act.(map[string]interface{})
+		accessClaims.ImpersonatorID, _ = actor["sub"].(string)
+		accessClaims.ImpersonationID, _ = claims["imp"].(string)
+
+		if accessClaims.ImpersonatorID == "" || accessClaims.ImpersonationID == "" {
+			return nil, ErrInvalidToken
+		}
+	}
+	accessClaims.Scopes = scopesFromClaims(claims)
+
+	if iat, ok := claims["iat"].(float64); ok {
+		accessClaims.IssuedAt = time.Unix(int64(iat), 0)
+	}
+
+	exp, ok := claims["exp"].(float64)
+
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	accessClaims.ExpiresAt = time.Unix(int64(exp), 0)
+
+	if time.Now().After(accessClaims.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	return accessClaims, nil
+}
+
+/*
+GenerateMFAToken signs the short-lived "mfa pending" token returned by the
+password step of a login when the user has two-factor authentication
+enabled.
+
+It proves the password was correct but grants no API access: AuthMiddleware
+rejects it, and it can only be exchanged at /auth/mfa/verify. The scopes
+requested at login are carried over to the final access token.
+
+Returns:
+  string    - Signed JWT
+  time.Time - Expiration time of the token
+  error     - Signing error
+*/
+func GenerateMFAToken(keys *KeySet, userID string, scopes []string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(mfaTokenTTL)
+
+	jti, err := GenerateTokenID()
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := jwt.MapClaims{
+		"typ":     TokenTypeMFAPending,
+		"user_id": userID,
+		"jti":     jti,
+		"scope":   strings.Join(scopes, " "),
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	}
+
+	tokenString, err := keys.Sign(claims)
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// MFAClaims holds the verified claims of an "mfa pending" token.
+type MFAClaims struct {
+	UserID    string
+	JTI       string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+/*
+ParseMFAToken verifies an "mfa pending" token and extracts the user ID,
+the scopes requested at login and what is needed to use the token only
+once: its jti, iat and exp claims.
+
+Returns:
+  *MFAClaims - Verified claims
+  error      - ErrInvalidToken if the token cannot be trusted
+*/
+func ParseMFAToken(keys *KeySet, tokenString string) (*MFAClaims, error) {
+	claims, err := parseToken(keys, tokenString)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != TokenTypeMFAPending {
+		return nil, ErrInvalidToken
+	}
+
+	exp, ok := claims["exp"].(float64)
+
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	iat, ok := claims["iat"].(float64)
+
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	mfaClaims := &MFAClaims{
+		Scopes:    scopesFromClaims(claims),
+		IssuedAt:  time.Unix(int64(iat), 0),
+		ExpiresAt: time.Unix(int64(exp), 0),
+	}
+
+	mfaClaims.UserID, _ = claims["user_id"].(string)
+	mfaClaims.JTI, _ = claims["jti"].(string)
+
+	if mfaClaims.UserID == "" || mfaClaims.JTI == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return mfaClaims, nil
+}
+
+// scopesFromClaims reads the space separated scope claim. Tokens issued
+// before scopes existed had full access and keep it until they expire.
+func scopesFromClaims(claims jwt.MapClaims) []string {
+	scope, ok := claims["scope"].(string)
+
+	if !ok {
+		return AllScopes
+	}
+
+	return strings.Fields(scope)
+}
+
+// parseToken verifies the signature and standard time claims of a JWT.
+func parseToken(keys *KeySet, tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, keys.verificationKey)
+
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// GenerateTokenID returns a random 128-bit identifier for the jti claim.
+func GenerateTokenID() (string, error) {
+	buf := make([]byte, 16)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+/*
+GenerateOpaqueToken creates a random, URL-safe token together with the
+hash that should be persisted in its place.
+
+Only the hash is ever stored in the database, so a database leak does not
+expose usable tokens.
+
+Returns:
+  string - Raw token to hand to the client (shown once)
+  string - SHA-256 hex digest of the token for storage
+  error  - Error reading from the system random source
+*/
+func GenerateOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the SHA-256 hex digest used to look up opaque tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalAccessTokenPrefix marks bearer tokens that are personal access
+// tokens rather than JWTs.
+const PersonalAccessTokenPrefix = "tdo_"
+
+/*
+GeneratePersonalAccessToken creates a new personal access token.
+
+Format:
+  tdo_<8 hex chars>_<43 base64url chars>
+
+The "tdo_<8 hex chars>" part is stored in clear as token_prefix so users
+can tell their tokens apart (and secret scanners can recognize leaked
+ones); the full token is only stored as a SHA-256 hash.
+
+Returns:
+  string - Raw token, shown to the user once
+  string - Display prefix
+  string - SHA-256 hex digest for storage
+  error  - Error reading from the system random source
+*/
+func GeneratePersonalAccessToken() (string, string, string, error) {
+	id := make([]byte, 4)
+
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+
+	secret, _, err := GenerateOpaqueToken()
+
+	if err != nil {
+		return "", "", "", err
+	}
+
+	prefix := PersonalAccessTokenPrefix + hex.EncodeToString(id)
+	token := prefix + "_" + secret
+
+	return token, prefix, HashToken(token), nil
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"testing"
+	"time"
+	"todos_api/internal/config"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestParseMFAToken(t *testing.T) {
+	keys, err := LoadKeySet(&config.Config{JWTSecret: "test-secret"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, expiresAt, err := GenerateMFAToken(keys, "ann", []string{ScopeTodosRead})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseMFAToken(keys, token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.UserID != "ann" || claims.JTI == "" || len(claims.Scopes) != 1 || claims.Scopes[0] != ScopeTodosRead {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	if claims.ExpiresAt.Unix() != expiresAt.Unix() || time.Since(claims.IssuedAt) > time.Minute {
+		t.Errorf("iat = %v, exp = %v; want now and %v", claims.IssuedAt, claims.ExpiresAt, expiresAt)
+	}
+
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"access token", jwt.MapClaims{"typ": TokenTypeAccess, "user_id": "ann", "jti": "a", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}},
+		{"no jti", jwt.MapClaims{"typ": TokenTypeMFAPending, "user_id": "ann", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}},
+		{"no iat", jwt.MapClaims{"typ": TokenTypeMFAPending, "user_id": "ann", "jti": "a", "exp": now.Add(time.Minute).Unix()}},
+		{"no user", jwt.MapClaims{"typ": TokenTypeMFAPending, "jti": "a", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}},
+		{"expired", jwt.MapClaims{"typ": TokenTypeMFAPending, "user_id": "ann", "jti": "a", "iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-time.Minute).Unix()}},
+	}
+
+	for _, test := range tests {
+		signed, err := keys.Sign(test.claims)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ParseMFAToken(keys, signed); err != ErrInvalidToken {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrInvalidToken)
+		}
+	}
+}
@@ -1,29 +1,296 @@
 package config
 
 import (
-	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/joho/godotenv"
 )
 
-type Config struct{
+// OIDCProvider is an OpenID Connect identity provider users can sign in
+// with. Name appears in the login URL, /auth/oidc/<name>/login.
+type OIDCProvider struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+type Config struct {
 	DatabaseURL string
-	Port string
-	JWTSecret string
+	Port        string
+	JWTSecret   string
+	// JWTKeysDir holds RS256/EdDSA keys named "<kid>.pem". When set,
+	// tokens are signed with the key named by JWTSigningKeyID.
+	JWTKeysDir      string
+	JWTSigningKeyID string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// RevocationCacheTTL bounds how long a token revoked on another replica
+	// may still be accepted by this one.
+	RevocationCacheTTL time.Duration
+	PasswordResetTTL   time.Duration
+	// ImpersonationTTL is how long an admin's impersonation token lasts.
+	ImpersonationTTL time.Duration
+
+	// PasswordHashAlgorithm is used for new password hashes, "argon2id"
+	// or "bcrypt". Argon2Memory is in KiB.
+	PasswordHashAlgorithm string
+	Argon2Memory          uint32
+	Argon2Iterations      uint32
+	Argon2Parallelism     uint8
+	BcryptCost            int
+
+	// SessionCookies lets browser clients log in with "session": true and
+	// receive their tokens as HttpOnly cookies instead of in the body.
+	// Requests authenticated by cookie need a CSRF token signed with
+	// CSRFSecret. SessionCookieSameSite is "lax", "strict" or "none".
+	SessionCookies        bool
+	SessionCookieDomain   string
+	SessionCookieSecure   bool
+	SessionCookieSameSite string
+	CSRFSecret            string
+
+	// Password policy for new passwords. PasswordMinScore is a zxcvbn
+	// score from 0 to 4. BreachedPasswordsFile optionally lists passwords
+	// known from breaches, one per line (plain or SHA-1).
+	PasswordMinLength     int
+	PasswordMaxLength     int
+	PasswordMinScore      int
+	BreachedPasswordsFile string
+
+	EmailVerificationTTL       time.Duration
+	RequireVerifiedEmail       bool
+	VerificationResendCooldown time.Duration
+	VerificationResendLimit    int
+
+	// Failed logins per account and per client IP before a temporary
+	// lockout. Below the limit, failures add an exponential delay.
+	LoginMaxAttempts   int
+	LoginIPMaxAttempts int
+	LoginLockoutTTL    time.Duration
+
+	// AccountDeletionGracePeriod is how long a deleted account is kept
+	// before it and all its data are purged.
+	AccountDeletionGracePeriod time.Duration
+
+	// Data exports are written to ExportDir and can be downloaded through
+	// a link signed with ExportSigningSecret until ExportTTL has passed.
+	ExportDir           string
+	ExportTTL           time.Duration
+	ExportSigningSecret string
+
+	// Due reminders are looked for every ReminderInterval. Webhook
+	// deliveries are signed with ReminderWebhookSecret when it is set,
+	// and may only reach private networks with ReminderWebhookAllowPrivate.
+	ReminderInterval            time.Duration
+	ReminderWebhookSecret       string
+	ReminderWebhookAllowPrivate bool
+
+	// OIDCProviders are configured through OIDC_PROVIDERS, a comma
+	// separated list of names, and OIDC_<NAME>_* variables for each.
+	OIDCProviders []OIDCProvider
+	OIDCLoginTTL  time.Duration
+
+	// MFAEncryptionKey is a base64 encoded 32-byte key used to encrypt
+	// TOTP secrets at rest. Two-factor endpoints are disabled without it.
+	MFAEncryptionKey string
+	MFAIssuer        string
+
+	// AppBaseURL is the public URL of the front end, used to build links
+	// in outgoing email.
+	AppBaseURL    string
+	MailDriver    string
+	MailFrom      string
+	MailOutboxDir string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
 }
 
-func Load() (*Config, error){
+func Load() (*Config, error) {
 	var err error = godotenv.Load()
 
 	if err != nil {
 		log.Println("Could not find the environment file")
 	}
-	var config *Config= &Config{
+	var config *Config = &Config{
 		DatabaseURL: os.Getenv("DATABASE_URL"),
-		Port: os.Getenv("PORT"),
-		JWTSecret: os.Getenv("JWT_SECRET"),
+		Port:        os.Getenv("PORT"),
+		JWTSecret:   os.Getenv("JWT_SECRET"),
+
+		JWTKeysDir:      os.Getenv("JWT_KEYS_DIR"),
+		JWTSigningKeyID: os.Getenv("JWT_SIGNING_KEY_ID"),
+
+		AccessTokenTTL:     getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:    getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		RevocationCacheTTL: getEnvDuration("REVOCATION_CACHE_TTL", 30*time.Second),
+
+		PasswordResetTTL: getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		ImpersonationTTL: getEnvDuration("IMPERSONATION_TTL", 15*time.Minute),
+
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		Argon2Memory:          uint32(getEnvInt("ARGON2_MEMORY_KIB", 64*1024)),
+		Argon2Iterations:      uint32(getEnvInt("ARGON2_ITERATIONS", 3)),
+		Argon2Parallelism:     uint8(getEnvInt("ARGON2_PARALLELISM", 4)),
+		BcryptCost:            getEnvInt("BCRYPT_COST", 10),
+
+		SessionCookies:        getEnvBool("SESSION_COOKIES", false),
+		SessionCookieDomain:   os.Getenv("SESSION_COOKIE_DOMAIN"),
+		SessionCookieSecure:   getEnvBool("SESSION_COOKIE_SECURE", true),
+		SessionCookieSameSite: getEnv("SESSION_COOKIE_SAMESITE", "lax"),
+		CSRFSecret:            os.Getenv("CSRF_SECRET"),
+
+		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:     getEnvInt("PASSWORD_MAX_LENGTH", 128),
+		PasswordMinScore:      getEnvInt("PASSWORD_MIN_SCORE", 2),
+		BreachedPasswordsFile: os.Getenv("BREACHED_PASSWORDS_FILE"),
+
+		EmailVerificationTTL:       getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		RequireVerifiedEmail:       getEnvBool("REQUIRE_VERIFIED_EMAIL", false),
+		VerificationResendCooldown: getEnvDuration("VERIFICATION_RESEND_COOLDOWN", time.Minute),
+		VerificationResendLimit:    getEnvInt("VERIFICATION_RESEND_LIMIT", 5),
+
+		LoginMaxAttempts:   getEnvInt("LOGIN_MAX_ATTEMPTS", 10),
+		LoginIPMaxAttempts: getEnvInt("LOGIN_IP_MAX_ATTEMPTS", 100),
+		LoginLockoutTTL:    getEnvDuration("LOGIN_LOCKOUT_TTL", 15*time.Minute),
+
+		AccountDeletionGracePeriod: getEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+
+		ExportDir:           getEnv("EXPORT_DIR", "exports"),
+		ExportTTL:           getEnvDuration("EXPORT_TTL", 24*time.Hour),
+		ExportSigningSecret: os.Getenv("EXPORT_SIGNING_SECRET"),
+
+		ReminderInterval:            getEnvDuration("REMINDER_INTERVAL", 30*time.Second),
+		ReminderWebhookSecret:       os.Getenv("REMINDER_WEBHOOK_SECRET"),
+		ReminderWebhookAllowPrivate: getEnvBool("REMINDER_WEBHOOK_ALLOW_PRIVATE", false),
+
+		OIDCProviders: loadOIDCProviders(),
+		OIDCLoginTTL:  getEnvDuration("OIDC_LOGIN_TTL", 10*time.Minute),
+
+		MFAEncryptionKey: os.Getenv("MFA_ENCRYPTION_KEY"),
+		MFAIssuer:        getEnv("MFA_ISSUER", "Todos API"),
+
+		AppBaseURL:    getEnv("APP_BASE_URL", "http://localhost:8080"),
+		MailDriver:    getEnv("MAIL_DRIVER", "outbox"),
+		MailFrom:      getEnv("MAIL_FROM", "Todos API <no-reply@localhost>"),
+		MailOutboxDir: getEnv("MAIL_OUTBOX_DIR", "outbox"),
+		SMTPHost:      os.Getenv("SMTP_HOST"),
+		SMTPPort:      getEnv("SMTP_PORT", "587"),
+		SMTPUsername:  os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:  os.Getenv("SMTP_PASSWORD"),
 	}
 
 	return config, nil
-}
\ No newline at end of file
+}
+
+/*
+loadOIDCProviders reads the identity providers named in OIDC_PROVIDERS.
+
+For a provider named "okta" the settings are OIDC_OKTA_ISSUER_URL,
+OIDC_OKTA_CLIENT_ID, OIDC_OKTA_CLIENT_SECRET, OIDC_OKTA_REDIRECT_URL and
+optionally OIDC_OKTA_SCOPES (space separated, default
+"openid email profile"). Providers without an issuer or client ID are
+skipped with a warning.
+*/
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		provider := OIDCProvider{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER_URL"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		}
+
+		if provider.IssuerURL == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			log.Printf("Skipping OIDC provider %s: %sISSUER_URL, %sCLIENT_ID and %sREDIRECT_URL are required", name, prefix, prefix, prefix)
+			continue
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers
+}
+
+// getEnv reads a string from the environment with a default.
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// getEnvBool reads a boolean ("true", "1", "false", ...) from the environment.
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+
+	if err != nil {
+		log.Printf("Invalid boolean for %s: %v, using default %v", key, err, fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+// getEnvInt reads an integer from the environment with a default.
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil {
+		log.Printf("Invalid integer for %s: %v, using default %v", key, err, fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+// getEnvDuration reads a Go duration string (e.g. "15m", "720h") from the
+// environment, falling back to the given default when unset or invalid.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Printf("Invalid duration for %s: %v, using default %v", key, err, fallback)
+		return fallback
+	}
+
+	return duration
+}
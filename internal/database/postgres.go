@@ -15,7 +15,7 @@ func Connect(databaseURL string)(*pgxpool.Pool, error){
 	config, err = pgxpool.ParseConfig(databaseURL)
 
 	if err != nil {
-		log.Println("Unable to Parse database URL: %v", err)
+		log.Printf("Unable to Parse database URL: %v", err)
 		return nil, err
 	}
 
@@ -30,7 +30,7 @@ func Connect(databaseURL string)(*pgxpool.Pool, error){
 	err = pool.Ping(ctx)
 
 	if err != nil {
-		log.Println("Unable to ping database: %v", err)
+		log.Printf("Unable to ping database: %v", err)
 		pool.Close()
 		return nil, err
 	}
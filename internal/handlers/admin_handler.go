@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/mail"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ListUsersResponse struct {
+	Users   []models.UserWithTodoCounts `json:"users"`
+	Page    int                         `json:"page"`
+	PerPage int                         `json:"per_page"`
+	Total   int                         `json:"total"`
+}
+
+/*
+ListUsersHandler lists users page by page, with their todo counts.
+
+Authentication Required: YES (admin)
+
+Query parameters (all optional):
+  q        - Case-insensitive search on the email address
+  role     - "user" or "admin"
+  status   - "active", "disabled" or "deleted" (scheduled for deletion)
+  page     - Page number, starting at 1 (default 1)
+  per_page - Page size (default 20, max 100)
+
+Possible responses:
+  200 OK            - Returns { users, page, per_page, total }
+  400 Bad Request   - Invalid filter or pagination parameter
+  500 Internal Error - Database error
+*/
+func ListUsersHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, perPage, err := parsePagination(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter := repository.UserFilter{
+			Search: strings.TrimSpace(c.Query("q")),
+			Role:   c.Query("role"),
+			Status: c.Query("status"),
+			Limit:  perPage,
+			Offset: (page - 1) * perPage,
+		}
+
+		if filter.Role != "" && filter.Role != models.RoleUser && filter.Role != models.RoleAdmin {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be \"user\" or \"admin\""})
+			return
+		}
+
+		switch filter.Status {
+		case "", "active", "disabled", "deleted":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be \"active\", \"disabled\" or \"deleted\""})
+			return
+		}
+
+		users, total, err := repository.ListUsers(pool, filter)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, ListUsersResponse{Users: users, Page: page, PerPage: perPage, Total: total})
+	}
+}
+
+/*
+GetUserHandler returns a single user with their todo counts.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - User ID
+
+Possible responses:
+  200 OK            - Returns the user
+  400 Bad Request   - Invalid ID format
+  404 Not Found     - User does not exist
+  500 Internal Error - Database error
+*/
+func GetUserHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		user, err := repository.GetUserWithTodoCounts(pool, id)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+/*
+DisableUserHandler disables an account.
+
+A disabled user cannot log in, refresh tokens or complete a two-factor
+login, and every access token, refresh token and personal access token
+they hold stops working.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - User ID
+
+Possible responses:
+  200 OK            - Account disabled
+  400 Bad Request   - Invalid ID format, or trying to disable yourself
+  404 Not Found     - User does not exist
+  500 Internal Error - Database error
+*/
+func DisableUserHandler(pool *pgxpool.Pool, revocations *auth.RevocationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		if id == c.GetString("user_id") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot disable your own account"})
+			return
+		}
+
+		if !setUserDisabled(c, pool, id, true) {
+			return
+		}
+
+		if err := revocations.RevokeAllForUser(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Account disabled"})
+	}
+}
+
+/*
+EnableUserHandler re-enables a disabled account. Tokens revoked when the
+account was disabled stay revoked; the user has to log in again.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - User ID
+
+Possible responses:
+  200 OK            - Account enabled
+  400 Bad Request   - Invalid ID format
+  404 Not Found     - User does not exist
+  500 Internal Error - Database error
+*/
+func EnableUserHandler(pool *pgxpool.Pool, revocations *auth.RevocationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		if !setUserDisabled(c, pool, id, false) {
+			return
+		}
+
+		revocations.ForgetUser(id)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Account enabled"})
+	}
+}
+
+// setUserDisabled updates the account status and writes the error
+// response if that fails. It returns false if the request must stop.
+func setUserDisabled(c *gin.Context, pool *pgxpool.Pool, id string, disabled bool) bool {
+	err := repository.SetUserDisabled(pool, id, disabled)
+
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+/*
+ForcePasswordResetHandler makes a user choose a new password.
+
+This handler:
+  1. Flags the account so logins are refused until the password is reset
+  2. Revokes every token the user holds
+  3. Emails the user a password reset link
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - User ID
+
+Possible responses:
+  202 Accepted      - Account flagged; the reset email is sent in the background
+  400 Bad Request   - Invalid ID format
+  404 Not Found     - User does not exist
+  500 Internal Error - Database error
+*/
+func ForcePasswordResetHandler(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer, revocations *auth.RevocationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		user, err := repository.GetUserByID(pool, id)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := repository.SetPasswordResetRequired(pool, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := revocations.RevokeAllForUser(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		go sendPasswordResetEmail(pool, cfg, mailer, user.Email)
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "Password reset required; a reset link is being emailed to the user"})
+	}
+}
+
+/*
+RestoreUserHandler cancels the scheduled deletion of an account during
+its grace period. The user can then log in again.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - User ID
+
+Possible responses:
+  200 OK            - Account restored
+  400 Bad Request   - Invalid ID format
+  404 Not Found     - User does not exist or is not scheduled for deletion
+  500 Internal Error - Database error
+*/
+func RestoreUserHandler(pool *pgxpool.Pool, revocations *auth.RevocationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		if err := repository.RestoreUser(pool, id); err != nil {
+			if errors.Is(err, repository.ErrUserNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found or not scheduled for deletion"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		revocations.ForgetUser(id)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Account restored"})
+	}
+}
+
+/*
+UnlockUserHandler lifts a login lockout (and any backoff) on an account
+before it expires on its own. Only blocks on the account are lifted;
+blocks on client IPs stay in place.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - User ID
+
+Possible responses:
+  200 OK            - Returns { "unlocked": true } if the account was locked
+  400 Bad Request   - Invalid ID format
+  404 Not Found     - User does not exist
+  500 Internal Error - Database error
+*/
+func UnlockUserHandler(pool *pgxpool.Pool, throttle *auth.LoginThrottle) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		user, err := repository.GetUserByID(pool, id)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		unlocked, err := throttle.Unlock(user, c.GetString("user_id"))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"unlocked": unlocked})
+	}
+}
+
+// maxLockoutEvents is how many lockout events GetLockoutEventsHandler
+// returns.
+const maxLockoutEvents = 100
+
+/*
+GetLockoutEventsHandler lists the most recent lockouts and unlocks of an
+account, newest first.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - User ID
+
+Possible responses:
+  200 OK            - Returns list of events
+  400 Bad Request   - Invalid ID format
+  500 Internal Error - Database error
+*/
+func GetLockoutEventsHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		events, err := repository.GetLockoutEvents(pool, id, maxLockoutEvents)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, events)
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+/*
+RefreshHandler exchanges a refresh token for a new access/refresh token pair.
+
+Refresh tokens are single use. Every successful call rotates the refresh
+token, and the previous one stops working. Presenting a refresh token that
+has already been rotated is treated as theft: the entire token family is
+revoked and the client must log in again with credentials.
+
+Browser sessions send no body: the refresh token is read from the
+refresh_token cookie, the request must carry the CSRF token in the
+X-CSRF-Token header, and the new pair is set as cookies again.
+
+Authentication Required: NO (the refresh token is the credential)
+
+Request body (optional for cookie sessions):
+  { "refresh_token": "<opaque token>" }
+
+Possible responses:
+  200 OK            - Returns a new token pair, or renews the cookie session
+  400 Bad Request   - Missing refresh_token
+  401 Unauthorized  - Unknown, expired, revoked or reused refresh token
+  403 Forbidden     - Account disabled, deleted or password reset required,
+                      or missing/invalid CSRF token for a cookie session
+  500 Internal Error - Database or signing error
+*/
+func RefreshHandler(pool *pgxpool.Pool, cfg *config.Config, keys *auth.KeySet, csrf *auth.CSRFProtector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var refreshRequest RefreshRequest
+
+		// The body is optional for cookie sessions, so binding errors are
+		// ignored and a missing token is reported below.
+		_ = c.ShouldBindJSON(&refreshRequest)
+
+		session := false
+		csrfToken := ""
+
+		if refreshRequest.RefreshToken == "" && csrf != nil {
+			if cookie, err := c.Cookie(auth.RefreshTokenCookie); err == nil && cookie != "" {
+				var ok bool
+
+				if csrfToken, ok = hasDoubleSubmittedCSRFToken(c); !ok {
+					c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+					return
+				}
+
+				refreshRequest.RefreshToken = cookie
+				session = true
+			}
+		}
+
+		if refreshRequest.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+			return
+		}
+
+		newRefreshToken, newHash, err := auth.GenerateOpaqueToken()
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+			return
+		}
+
+		rotated, err := repository.RotateRefreshToken(
+			pool,
+			auth.HashToken(refreshRequest.RefreshToken),
+			newHash,
+			time.Now().Add(cfg.RefreshTokenTTL),
+		)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrRefreshTokenReused):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, please log in again"})
+			case errors.Is(err, repository.ErrRefreshTokenNotFound), errors.Is(err, repository.ErrRefreshTokenExpired):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		user, err := repository.GetUserByID(pool, rotated.UserID)
+
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+
+		// The token family has already been rotated at this point, but a
+		// forged request does not get to see the new pair either way.
+		if session && !csrf.Valid(csrfToken, user.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+			return
+		}
+
+		if rejectInactiveAccount(c, user) {
+			return
+		}
+
+		// Refresh tokens issued before scopes existed have none stored and
+		// keep full access.
+		scopes, err := auth.ResolveScopes(rotated.Scopes)
+
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+
+		// The refresh token family is the session.
+		accessToken, expiresAt, err := auth.GenerateAccessToken(cfg, keys, user, rotated.FamilyID, scopes)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token: " + err.Error()})
+			return
+		}
+
+		response := &LoginResponse{
+			Token:        accessToken,
+			RefreshToken: newRefreshToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+		}
+
+		respondWithTokens(c, cfg, csrf, user, response, session)
+	}
+}
+
+/*
+issueTokenPair starts a new session for a user, recording the client's
+user agent and IP address, and creates its first access token and refresh
+token. The session ID is the sid claim of the access token and the
+family of the refresh token.
+
+The refresh token remembers the granted scopes so that rotations keep
+issuing access tokens with the same scopes. The raw refresh token is only
+ever returned here; the database keeps its hash.
+*/
+func issueTokenPair(c *gin.Context, pool *pgxpool.Pool, cfg *config.Config, keys *auth.KeySet, user *models.User, scopes []string) (*LoginResponse, error) {
+	session, err := repository.CreateSession(pool, user.ID, c.Request.UserAgent(), c.ClientIP())
+
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, expiresAt, err := auth.GenerateAccessToken(cfg, keys, user, session.ID, scopes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := auth.GenerateOpaqueToken()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = repository.CreateRefreshToken(pool, user.ID, &session.ID, scopes, refreshHash, time.Now().Add(cfg.RefreshTokenTTL))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+	}, nil
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+/*
+LogoutHandler revokes the access token used to call it, and signs out the
+session it belongs to.
+
+If the client also sends its refresh token, the refresh token family is
+revoked as well so the session cannot be silently renewed. Cookie sessions
+send it in the refresh_token cookie instead, and their cookies are
+cleared.
+
+Authentication Required: YES
+
+Request body (optional):
+  { "refresh_token": "<opaque token>" }
+
+Possible responses:
+  200 OK            - Token revoked
+  500 Internal Error - Database error
+*/
+func LogoutHandler(pool *pgxpool.Pool, cfg *config.Config, revocations *auth.RevocationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := tokenClaims(c)
+
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Personal access tokens cannot log out, revoke them via /auth/tokens instead"})
+			return
+		}
+
+		var logoutRequest LogoutRequest
+
+		// The body is optional, so binding errors are ignored.
+		_ = c.ShouldBindJSON(&logoutRequest)
+
+		if c.GetBool("session_cookie") {
+			logoutRequest.RefreshToken, _ = c.Cookie(auth.RefreshTokenCookie)
+			clearSessionCookies(c, cfg)
+		}
+
+		if logoutRequest.RefreshToken != "" {
+			err := repository.RevokeRefreshTokenFamilyByHash(pool, claims.UserID, auth.HashToken(logoutRequest.RefreshToken))
+
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if claims.SessionID != "" {
+			err := revocations.RevokeSession(claims.UserID, claims.SessionID)
+
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := revocations.RevokeToken(claims); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
+	}
+}
+
+/*
+LogoutAllHandler revokes every access and refresh token of the
+authenticated user, signing them out on all devices.
+
+Personal access tokens are not affected; they are managed separately via
+/auth/tokens. The cookies of the calling browser session are cleared.
+
+Authentication Required: YES
+
+Possible responses:
+  200 OK            - All tokens revoked
+  500 Internal Error - Database error
+*/
+func LogoutAllHandler(cfg *config.Config, revocations *auth.RevocationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		if err := revocations.RevokeAllForUser(UserID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if c.GetBool("session_cookie") {
+			clearSessionCookies(c, cfg)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out of all sessions"})
+	}
+}
+
+// tokenClaims returns the access token claims stored by AuthMiddleware.
+func tokenClaims(c *gin.Context) (*auth.AccessClaims, bool) {
+	claimsInterface, exists := c.Get("token_claims")
+
+	if !exists {
+		return nil, false
+	}
+
+	claims, ok := claimsInterface.(*auth.AccessClaims)
+
+	return claims, ok
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/mail"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+/*
+VerifyEmailHandler marks the user's email address as verified.
+
+The token comes from the link mailed at registration (or by the resend
+endpoint) and can be used once. Tokens mailed by an email change move the
+account to the new address.
+
+Authentication Required: NO (the verification token is the credential)
+
+Request body:
+  { "token": "<token from email>" }
+
+Possible responses:
+  200 OK            - Email verified
+  400 Bad Request   - Invalid, used or expired token
+  409 Conflict      - The new address was registered by someone else meanwhile
+  500 Internal Error - Database error
+*/
+func VerifyEmailHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var verifyRequest VerifyEmailRequest
+
+		if err := c.ShouldBindJSON(&verifyRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err := repository.VerifyEmailWithToken(pool, auth.HashToken(verifyRequest.Token))
+
+		if err != nil {
+			if errors.Is(err, repository.ErrVerificationTokenInvalid) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+				return
+			}
+
+			if errors.Is(err, repository.ErrEmailTaken) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+	}
+}
+
+/*
+ResendVerificationEmailHandler sends a fresh verification link to the
+authenticated user.
+
+Resending is rate limited per user: at most one email per
+cfg.VerificationResendCooldown and cfg.VerificationResendLimit emails per
+hour. The limit is enforced from the tokens table, so it holds across API
+replicas and restarts.
+
+Authentication Required: YES
+
+Possible responses:
+  202 Accepted          - Verification email queued
+  400 Bad Request       - Email already verified
+  429 Too Many Requests - Rate limit hit, see Retry-After header
+  500 Internal Error    - Database error
+*/
+func ResendVerificationEmailHandler(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		user, err := repository.GetUserByID(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if user.EmailVerifiedAt != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already verified"})
+			return
+		}
+
+		if rejectVerificationEmailFlood(c, pool, cfg, user.ID) {
+			return
+		}
+
+		if err := createAndSendVerificationEmail(pool, cfg, mailer, user.ID, user.Email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+	}
+}
+
+/*
+rejectVerificationEmailFlood enforces the per-user limit on verification
+emails (both address verification and email change), answering 429 with
+a Retry-After header when it is hit. It returns true if the request must
+stop.
+*/
+func rejectVerificationEmailFlood(c *gin.Context, pool *pgxpool.Pool, cfg *config.Config, userID string) bool {
+	now := time.Now()
+	sentLastHour, lastSentAt, err := repository.GetVerificationEmailStats(pool, userID, now.Add(-time.Hour))
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	var retryAfter time.Duration
+
+	if lastSentAt != nil && now.Sub(*lastSentAt) < cfg.VerificationResendCooldown {
+		retryAfter = cfg.VerificationResendCooldown - now.Sub(*lastSentAt)
+	} else if sentLastHour >= cfg.VerificationResendLimit {
+		retryAfter = time.Hour
+	}
+
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many verification emails requested, please try again later"})
+		return true
+	}
+
+	return false
+}
+
+/*
+sendVerificationEmail is the fire-and-forget variant used right after
+registration; failures are logged and the user can ask for a resend.
+*/
+func sendVerificationEmail(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer, userID string, email string) {
+	if err := createAndSendVerificationEmail(pool, cfg, mailer, userID, email); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+}
+
+// createAndSendVerificationEmail stores a verification token for the
+// address and mails the link to it.
+func createAndSendVerificationEmail(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer, userID string, email string) error {
+	link, err := createVerificationLink(pool, cfg, userID, email, repository.VerificationPurposeVerify)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: "Please confirm your email address by opening the link below. It expires in " + cfg.EmailVerificationTTL.String() + ".\n\n" +
+			link + "\n\n" +
+			"If you did not create an account, you can ignore this email.\n",
+	})
+}
+
+/*
+createAndSendEmailChangeEmail starts an email change: it mails a
+confirmation link to the new address, and a notice to the current one so
+the owner learns about a change they did not ask for.
+*/
+func createAndSendEmailChangeEmail(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer, userID string, currentEmail string, newEmail string) error {
+	link, err := createVerificationLink(pool, cfg, userID, newEmail, repository.VerificationPurposeChangeEmail)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err = mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: "Please confirm that you want to use this address for your account by opening the link below. It expires in " + cfg.EmailVerificationTTL.String() + ".\n\n" +
+			link + "\n\n" +
+			"If you did not ask for this, you can ignore this email.\n",
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := mailer.Send(ctx, mail.Message{
+		To:      currentEmail,
+		Subject: "Your email address is being changed",
+		Body: "Someone asked to change the email address of your account to " + newEmail + ".\n\n" +
+			"The change only takes effect once the new address is confirmed. If this was not you, change your password now.\n",
+	}); err != nil {
+		log.Printf("Failed to send email change notice: %v", err)
+	}
+
+	return nil
+}
+
+// createVerificationLink stores a verification token for the address and
+// returns the link that redeems it.
+func createVerificationLink(pool *pgxpool.Pool, cfg *config.Config, userID string, email string, purpose string) (string, error) {
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := repository.CreateEmailVerificationToken(pool, userID, email, purpose, tokenHash, time.Now().Add(cfg.EmailVerificationTTL)); err != nil {
+		return "", err
+	}
+
+	return cfg.AppBaseURL + "/verify-email?token=" + url.QueryEscape(token), nil
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/jobs"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DataExportResponse is an export with a signed download link once the
+// archive is ready.
+type DataExportResponse struct {
+	models.DataExport
+	DownloadURL *string `json:"download_url,omitempty"`
+}
+
+// exportResponse adds the download link to a completed export.
+func exportResponse(signer *auth.URLSigner, export *models.DataExport) DataExportResponse {
+	response := DataExportResponse{DataExport: *export}
+
+	if export.Status == models.DataExportCompleted && export.ExpiresAt != nil {
+		query := url.Values{}
+		query.Set("expires", strconv.FormatInt(export.ExpiresAt.Unix(), 10))
+		query.Set("signature", signer.Sign(export.ID, *export.ExpiresAt))
+
+		link := "/exports/" + export.ID + "/download?" + query.Encode()
+		response.DownloadURL = &link
+	}
+
+	return response
+}
+
+/*
+RequestExportHandler queues an export of all the authenticated user's
+data: profile, todos (JSON and CSV), personal access tokens, linked
+identities, active sessions and login lockouts, in a zip archive.
+
+The archive is built in the background. Poll GET /me/export/:id until the
+status is "completed"; the response then carries a signed download link
+that works without a token until the export expires.
+
+Authentication Required: YES
+
+Possible responses:
+  202 Accepted       - Export queued; returns the export
+  409 Conflict       - An export is already pending or running
+  500 Internal Error - Database error
+*/
+func RequestExportHandler(pool *pgxpool.Pool, worker *jobs.ExportWorker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		export, err := repository.CreateDataExport(pool, UserID)
+
+		if err != nil {
+			if errors.Is(err, repository.ErrExportInProgress) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		worker.Enqueue()
+
+		c.JSON(http.StatusAccepted, export)
+	}
+}
+
+/*
+ListExportsHandler lists the authenticated user's exports, newest first.
+
+Authentication Required: YES
+
+Possible responses:
+  200 OK             - Returns list of exports
+  500 Internal Error - Database error
+*/
+func ListExportsHandler(pool *pgxpool.Pool, signer *auth.URLSigner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		exports, err := repository.GetDataExports(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var response []DataExportResponse = []DataExportResponse{}
+
+		for i := range exports {
+			response = append(response, exportResponse(signer, &exports[i]))
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+/*
+GetExportHandler returns one of the authenticated user's exports.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Export ID
+
+Possible responses:
+  200 OK             - Returns the export, with download_url once completed
+  400 Bad Request    - Invalid ID format
+  404 Not Found      - Export does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func GetExportHandler(pool *pgxpool.Pool, signer *auth.URLSigner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+			return
+		}
+
+		export, err := repository.GetDataExport(pool, id, UserID)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, exportResponse(signer, export))
+	}
+}
+
+/*
+DownloadExportHandler serves an export archive through a signed link.
+
+Authentication Required: NO (the signature grants access)
+
+Query parameters:
+  expires   - Unix time the link expires at
+  signature - Signature of the export ID and expiry
+
+Possible responses:
+  200 OK             - The zip archive
+  403 Forbidden      - Invalid or expired signature
+  404 Not Found      - Export does not exist or is no longer available
+  500 Internal Error - Database error
+*/
+func DownloadExportHandler(pool *pgxpool.Pool, signer *auth.URLSigner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) || !signer.Verify(id, c.Query("expires"), c.Query("signature")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired download link"})
+			return
+		}
+
+		export, err := repository.GetDataExportByID(pool, id)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if export.Status != models.DataExportCompleted || export.FilePath == nil || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export is no longer available"})
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.FileAttachment(*export.FilePath, "todos-export-"+export.CreatedAt.Format("2006-01-02")+".zip")
+	}
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ImpersonateRequest struct {
+	Reason string   `json:"reason" binding:"required"`
+	Scopes []string `json:"scopes"`
+}
+
+type ImpersonationResponse struct {
+	Token         string                `json:"token"`
+	TokenType     string                `json:"token_type"`
+	ExpiresIn     int64                 `json:"expires_in"`
+	Impersonation *models.Impersonation `json:"impersonation"`
+}
+
+/*
+ImpersonateUserHandler issues a short-lived token that lets an admin see
+the API exactly as a user does, for support.
+
+The token is a normal access token of the user that also names the admin.
+Every request made with it is written to the audit log before it is
+handled, and handlers can refuse destructive actions while impersonating.
+The token cannot get the account:admin scope, so the user's password,
+email, tokens and two-factor settings stay out of reach.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - User to impersonate
+
+Request body:
+  { "reason": "Ticket #1234: todos missing", "scopes": ["todos:read"] }
+
+  scopes is optional and defaults to ["todos:read"].
+
+Possible responses:
+  200 OK             - Returns the token and the impersonation record
+  400 Bad Request    - Invalid ID, missing reason, unknown or forbidden
+                       scope, or trying to impersonate yourself
+  403 Forbidden      - The user is an admin, or the caller is impersonating
+  404 Not Found      - User does not exist
+  409 Conflict       - The account is disabled or scheduled for deletion
+  500 Internal Error - Database or signing error
+*/
+func ImpersonateUserHandler(pool *pgxpool.Pool, cfg *config.Config, keys *auth.KeySet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectWhileImpersonating(c) {
+			return
+		}
+
+		adminID := c.GetString("user_id")
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		if id == adminID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot impersonate yourself"})
+			return
+		}
+
+		var input ImpersonateRequest
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		reason := strings.TrimSpace(input.Reason)
+
+		if reason == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+			return
+		}
+
+		scopes, err := impersonationScopes(input.Scopes)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := repository.GetUserByID(pool, id)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// An admin's token would pass RequireAdmin, which reads the role of
+		// the token's user.
+		if user.Role == models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Administrators cannot be impersonated"})
+			return
+		}
+
+		if user.DisabledAt != nil || user.DeletedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "The account is disabled or scheduled for deletion"})
+			return
+		}
+
+		impersonation, err := repository.CreateImpersonation(pool, adminID, user.ID, reason, scopes, time.Now().Add(cfg.ImpersonationTTL))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, err := auth.GenerateImpersonationToken(keys, user, impersonation)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token: " + err.Error()})
+			return
+		}
+
+		log.Printf("Admin %s started impersonation %s of user %s", adminID, impersonation.ID, user.ID)
+
+		c.JSON(http.StatusOK, ImpersonationResponse{
+			Token:         token,
+			TokenType:     "Bearer",
+			ExpiresIn:     int64(time.Until(impersonation.ExpiresAt).Seconds()),
+			Impersonation: impersonation,
+		})
+	}
+}
+
+// impersonationScopes resolves the scopes requested for an impersonation
+// token. Read access is the default; account:admin is never granted.
+func impersonationScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return []string{auth.ScopeTodosRead}, nil
+	}
+
+	scopes, err := auth.ResolveScopes(requested)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scope := range scopes {
+		if scope == auth.ScopeAccountAdmin {
+			return nil, errors.New("Impersonation tokens cannot have the account:admin scope")
+		}
+	}
+
+	return scopes, nil
+}
+
+/*
+rejectWhileImpersonating answers 403 if the request was made with an
+impersonation token. Handlers of destructive actions call it first; it
+returns true if the request must stop.
+*/
+func rejectWhileImpersonating(c *gin.Context) bool {
+	if c.GetString("impersonator_id") == "" {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{"error": "This action is not allowed while impersonating a user"})
+	return true
+}
+
+// maxImpersonations is how many impersonations GetImpersonationsHandler
+// returns.
+const maxImpersonations = 100
+
+/*
+GetImpersonationsHandler lists the most recent impersonations of a user,
+newest first.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - User ID
+
+Possible responses:
+  200 OK             - Returns list of impersonations
+  400 Bad Request    - Invalid ID format
+  500 Internal Error - Database error
+*/
+func GetImpersonationsHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		impersonations, err := repository.GetImpersonations(pool, id, maxImpersonations)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, impersonations)
+	}
+}
+
+/*
+GetImpersonationEventsHandler lists the requests made during an
+impersonation, oldest first.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - Impersonation ID
+
+Query parameters (all optional):
+  page     - Page number, starting at 1 (default 1)
+  per_page - Page size (default 20, max 100)
+
+Possible responses:
+  200 OK             - Returns list of audit events
+  400 Bad Request    - Invalid ID format or pagination parameter
+  500 Internal Error - Database error
+*/
+func GetImpersonationEventsHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid impersonation ID"})
+			return
+		}
+
+		page, perPage, err := parsePagination(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		events, err := repository.GetImpersonationAuditEvents(pool, id, perPage, (page-1)*perPage)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, events)
+	}
+}
+
+/*
+EndImpersonationHandler stops an impersonation before its token expires.
+Requests made with the token are refused from then on.
+
+Authentication Required: YES (admin)
+
+URL Parameter:
+  id (uuid) - Impersonation ID
+
+Possible responses:
+  200 OK             - Impersonation ended
+  400 Bad Request    - Invalid ID format
+  404 Not Found      - No such impersonation, or it has already ended
+  500 Internal Error - Database error
+*/
+func EndImpersonationHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid impersonation ID"})
+			return
+		}
+
+		if err := repository.EndImpersonation(pool, id); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation not found or already ended"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+	"todos_api/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+JWKSHandler publishes the public keys used to sign access tokens, in JSON
+Web Key Set format, so other services can verify tokens locally.
+
+Keys are matched by the kid in the token header. Retired keys stay in the
+set while tokens signed with them may still be in use. The set is empty
+when tokens are signed with HS256.
+
+Authentication Required: NO
+
+Possible responses:
+  200 OK - { "keys": [ { "kty": "OKP", "crv": "Ed25519", "kid": "...", ... } ] }
+*/
+func JWKSHandler(keys *auth.KeySet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, gin.H{"keys": keys.JWKS()})
+	}
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/mail"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxDisplayNameLength matches the VARCHAR size of users.display_name.
+const maxDisplayNameLength = 100
+
+// maxTimeZoneLength matches the VARCHAR size of users.time_zone.
+const maxTimeZoneLength = 64
+
+type UpdateMeRequest struct {
+	DisplayName models.Nullable[string] `json:"display_name"`
+	TimeZone    *string                 `json:"time_zone"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type DeleteMeRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+/*
+GetMeHandler returns the authenticated user's account.
+
+Authentication Required: YES
+
+Possible responses:
+  200 OK            - Returns the user
+  500 Internal Error - Database error
+*/
+func GetMeHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		user, err := repository.GetUserByID(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+/*
+UpdateMeHandler updates the authenticated user's profile.
+
+Only the display name and time zone can be edited here; the email address
+and password have their own endpoints because they need the current
+password. Fields that are not sent keep their value.
+
+The time zone is an IANA name such as "Europe/Berlin". It decides when the
+user's day starts for the due date filters of GET /todos.
+
+Authentication Required: YES
+
+Request body:
+  { "display_name": "Ada", "time_zone": "Europe/Berlin" }
+
+  display_name: empty string or null clears it
+
+Possible responses:
+  200 OK            - Returns the updated user
+  400 Bad Request   - Invalid JSON, display name too long or unknown time
+                      zone
+  500 Internal Error - Database error
+*/
+func UpdateMeHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		var input UpdateMeRequest
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var displayName models.Nullable[string] = models.Nullable[string]{Set: input.DisplayName.Set}
+
+		if input.DisplayName.Value != nil {
+			trimmed := strings.TrimSpace(*input.DisplayName.Value)
+
+			if len(trimmed) > maxDisplayNameLength {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Display name must be at most 100 characters"})
+				return
+			}
+
+			if trimmed != "" {
+				displayName.Value = &trimmed
+			}
+		}
+
+		if input.TimeZone != nil {
+			// LoadLocation also accepts "" and "Local", which mean UTC and
+			// the server's zone.
+			name := strings.TrimSpace(*input.TimeZone)
+			_, err := time.LoadLocation(name)
+
+			if err != nil || name == "" || name == "Local" || len(name) > maxTimeZoneLength {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone, use an IANA name such as \"Europe/Berlin\""})
+				return
+			}
+
+			input.TimeZone = &name
+		}
+
+		user, err := repository.UpdateUserProfile(pool, UserID, displayName, input.TimeZone)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Reminders on whole-day due dates fire relative to the start of
+		// the day in the user's time zone.
+		if input.TimeZone != nil {
+			if err := repository.RescheduleReminders(pool, UserID, nil, time.Now()); err != nil {
+				log.Printf("Failed to reschedule reminders of user %s: %v", UserID, err)
+			}
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+/*
+ChangePasswordHandler changes the authenticated user's password.
+
+The current password is required, and wrong guesses are throttled like
+failed logins. Every other session of the user is signed out: all access
+and refresh tokens are revoked and, when the request was made with a JWT,
+a fresh token pair with the same scopes is returned so this client stays
+signed in. Personal access tokens are not affected.
+
+Authentication Required: YES
+
+Request body:
+  { "current_password": "...", "new_password": "..." }
+
+Possible responses:
+  200 OK                - Password changed; returns a new token pair (JWT only),
+                          or renews the cookies of a cookie session
+  400 Bad Request       - Missing fields or new password rejected by the policy
+  401 Unauthorized      - Current password is wrong
+  429 Too Many Requests - Too many wrong passwords, see Retry-After header
+  500 Internal Error    - Database, hashing or signing error
+*/
+func ChangePasswordHandler(pool *pgxpool.Pool, cfg *config.Config, keys *auth.KeySet, revocations *auth.RevocationStore, throttle *auth.LoginThrottle, hasher auth.PasswordHasher, policy *auth.PasswordPolicy, csrf *auth.CSRFProtector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ChangePasswordRequest
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := checkCurrentPassword(c, pool, throttle, hasher, input.CurrentPassword)
+
+		if !ok {
+			return
+		}
+
+		if err := policy.Check(input.NewPassword, user.Email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		hashedPassword, err := hasher.Hash(input.NewPassword)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		if err := repository.UpdatePassword(pool, user.ID, hashedPassword); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := revocations.RevokeAllForUser(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if c.GetString("auth_method") != "jwt" {
+			c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+			return
+		}
+
+		scopes, _ := c.Get("token_scopes")
+
+		response, err := issueTokenPair(c, pool, cfg, keys, user, scopes.([]string))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token: " + err.Error()})
+			return
+		}
+
+		respondWithTokens(c, cfg, csrf, user, response, c.GetBool("session_cookie"))
+	}
+}
+
+/*
+ChangeEmailHandler starts moving the authenticated user to a new email
+address.
+
+Nothing changes until the link mailed to the new address is opened (it is
+redeemed through /auth/verify-email). The current address is told about
+the request. Emails are rate limited together with verification emails.
+
+Authentication Required: YES
+
+Request body:
+  { "new_email": "new@example.com", "password": "..." }
+
+Possible responses:
+  202 Accepted          - Confirmation email sent to the new address
+  400 Bad Request       - Invalid address, or same as the current one
+  401 Unauthorized      - Password is wrong
+  409 Conflict          - Address already registered
+  429 Too Many Requests - Too many emails or wrong passwords, see Retry-After
+  500 Internal Error    - Database or mail error
+*/
+func ChangeEmailHandler(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer, throttle *auth.LoginThrottle, hasher auth.PasswordHasher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input ChangeEmailRequest
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		newEmail, err := normalizeEmail(input.NewEmail)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := checkCurrentPassword(c, pool, throttle, hasher, input.Password)
+
+		if !ok {
+			return
+		}
+
+		if strings.EqualFold(newEmail, user.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "New email is the same as the current one"})
+			return
+		}
+
+		if _, err := repository.GetUserByEmail(pool, newEmail); err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
+
+		if rejectVerificationEmailFlood(c, pool, cfg, user.ID) {
+			return
+		}
+
+		if err := createAndSendEmailChangeEmail(pool, cfg, mailer, user.ID, user.Email, newEmail); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "Check your new email address to confirm the change"})
+	}
+}
+
+/*
+DeleteMeHandler deletes the authenticated user's account.
+
+The account is soft-deleted: it is signed out everywhere and can no longer
+sign in, and after cfg.AccountDeletionGracePeriod it is purged together
+with all its todos. Until then an admin can restore it.
+
+Authentication Required: YES
+
+Request body:
+  { "password": "..." }
+
+Possible responses:
+  202 Accepted          - Account scheduled for deletion; returns purge_after
+  400 Bad Request       - Missing password
+  401 Unauthorized      - Password is wrong
+  429 Too Many Requests - Too many wrong passwords, see Retry-After header
+  500 Internal Error    - Database error
+*/
+func DeleteMeHandler(pool *pgxpool.Pool, cfg *config.Config, revocations *auth.RevocationStore, throttle *auth.LoginThrottle, hasher auth.PasswordHasher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input DeleteMeRequest
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, ok := checkCurrentPassword(c, pool, throttle, hasher, input.Password)
+
+		if !ok {
+			return
+		}
+
+		deletedAt, err := repository.SoftDeleteUser(pool, user.ID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := revocations.RevokeAllForUser(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":     "Account scheduled for deletion",
+			"purge_after": deletedAt.Add(cfg.AccountDeletionGracePeriod).Format(time.RFC3339),
+		})
+	}
+}
+
+/*
+checkCurrentPassword loads the authenticated user and verifies the
+password they re-entered to confirm a sensitive change.
+
+Wrong passwords count against the account's login throttle, so a stolen
+access token cannot be used to guess the password. On failure the error
+response has been written and false is returned.
+*/
+func checkCurrentPassword(c *gin.Context, pool *pgxpool.Pool, throttle *auth.LoginThrottle, hasher auth.PasswordHasher, password string) (*models.User, bool) {
+	user, err := repository.GetUserByID(pool, c.GetString("user_id"))
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	ip := c.ClientIP()
+
+	attempt, ok := reserveLoginAttempt(c, throttle, auth.AccountThrottleKey(user.Email), auth.IPThrottleKey(ip))
+
+	if !ok {
+		return nil, false
+	}
+
+	if !verifyPassword(hasher, user, password) {
+		recordLoginFailure(attempt, &user.ID, ip)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return nil, false
+	}
+
+	if err := attempt.Release(); err != nil {
+		log.Printf("Failed to release login attempt: %v", err)
+	}
+
+	return user, true
+}
@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/skip2/go-qrcode"
+)
+
+// recoveryCodeCount is how many recovery codes are issued on enrollment.
+const recoveryCodeCount = 10
+
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCodePNG  string `json:"qr_code_png"`
+}
+
+type TOTPConfirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TOTPDisableRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	Session      bool   `json:"session"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+/*
+EnrollTOTPHandler starts TOTP enrollment for the authenticated user.
+
+A new secret is generated and stored encrypted, but two-factor login is
+not enabled until the user proves their authenticator works via
+ConfirmTOTPHandler. Calling this again before confirming replaces the
+pending secret.
+
+Authentication Required: YES
+
+Response:
+  secret      - Base32 secret for manual entry
+  otpauth_uri - otpauth:// URI for authenticator apps
+  qr_code_png - Base64 encoded PNG of the URI as a QR code
+
+Possible responses:
+  200 OK                  - Enrollment started
+  409 Conflict            - TOTP already enabled
+  503 Service Unavailable - MFA_ENCRYPTION_KEY not configured
+  500 Internal Error      - Database or encryption error
+*/
+func EnrollTOTPHandler(pool *pgxpool.Pool, cfg *config.Config, box *auth.SecretBox) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if box == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Two-factor authentication is not configured"})
+			return
+		}
+
+		user, err := repository.GetUserByID(pool, c.GetString("user_id"))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		secret, err := auth.GenerateTOTPSecret()
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+
+		sealed, err := box.Seal([]byte(secret), []byte(user.ID))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt secret"})
+			return
+		}
+
+		saved, err := repository.SavePendingTOTP(pool, user.ID, sealed)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !saved {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		uri := auth.TOTPURI(cfg.MFAIssuer, user.Email, secret)
+
+		png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+			return
+		}
+
+		c.JSON(http.StatusOK, TOTPEnrollResponse{
+			Secret:     secret,
+			OTPAuthURI: uri,
+			QRCodePNG:  base64.StdEncoding.EncodeToString(png),
+		})
+	}
+}
+
+/*
+ConfirmTOTPHandler enables two-factor login once the user submits a valid
+code from their authenticator app, and returns one-time recovery codes.
+
+The recovery codes are only shown in this response; they are stored
+hashed.
+
+Authentication Required: YES
+
+Request body:
+  { "code": "123456" }
+
+Possible responses:
+  200 OK                  - Returns recovery_codes
+  400 Bad Request         - Invalid code or no pending enrollment
+  409 Conflict            - TOTP already enabled
+  503 Service Unavailable - MFA_ENCRYPTION_KEY not configured
+  500 Internal Error      - Database or encryption error
+*/
+func ConfirmTOTPHandler(pool *pgxpool.Pool, box *auth.SecretBox) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if box == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Two-factor authentication is not configured"})
+			return
+		}
+
+		UserID := c.GetString("user_id")
+
+		var confirmRequest TOTPConfirmRequest
+
+		if err := c.ShouldBindJSON(&confirmRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		totp, err := repository.GetTOTP(pool, UserID)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "No pending two-factor enrollment"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if totp.ConfirmedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := box.Open(totp.SecretCiphertext, []byte(UserID))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		step, valid := auth.ValidateTOTP(string(secret), confirmRequest.Code, time.Now())
+
+		if !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+			return
+		}
+
+		codes, hashes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+
+		if err := repository.ConfirmTOTP(pool, UserID, step, hashes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Two-factor authentication enabled",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+/*
+DisableTOTPHandler turns two-factor authentication off.
+
+Requires the current password and either a valid TOTP code or an unused
+recovery code, so a stolen access token alone cannot downgrade the account.
+Wrong passwords count against the account's login throttle.
+
+Authentication Required: YES
+
+Request body:
+  { "password": "...", "code": "123456" }
+  { "password": "...", "recovery_code": "abcde-fghij" }
+
+Possible responses:
+  200 OK                  - Two-factor authentication disabled
+  400 Bad Request         - TOTP not enabled
+  401 Unauthorized        - Wrong password or code
+  429 Too Many Requests   - Too many wrong passwords, see Retry-After header
+  503 Service Unavailable - MFA_ENCRYPTION_KEY not configured
+  500 Internal Error      - Database error
+*/
+func DisableTOTPHandler(pool *pgxpool.Pool, box *auth.SecretBox, throttle *auth.LoginThrottle, hasher auth.PasswordHasher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if box == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Two-factor authentication is not configured"})
+			return
+		}
+
+		UserID := c.GetString("user_id")
+
+		var disableRequest TOTPDisableRequest
+
+		if err := c.ShouldBindJSON(&disableRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, ok := checkCurrentPassword(c, pool, throttle, hasher, disableRequest.Password); !ok {
+			return
+		}
+
+		totp, err := repository.GetTOTP(pool, UserID)
+
+		if err != nil || totp.ConfirmedAt == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+			return
+		}
+
+		valid, err := verifySecondFactor(pool, box, totp, disableRequest.Code, disableRequest.RecoveryCode)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !valid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password or code"})
+			return
+		}
+
+		if err := repository.DeleteTOTP(pool, UserID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	}
+}
+
+/*
+VerifyMFAHandler completes a two-step login.
+
+The client exchanges the mfa_token returned by /auth/login together with a
+TOTP code (or a recovery code) for the normal access/refresh token pair.
+Each TOTP code is accepted only once and each recovery code can be used
+only once. Wrong codes are throttled per user like failed logins. An
+mfa_token can be exchanged only once, and not at all once the user
+changed their password or logged out everywhere after it was issued.
+
+Authentication Required: NO (the mfa_token is the credential)
+
+Request body ("session" works as on /auth/login):
+  { "mfa_token": "...", "code": "123456" }
+  { "mfa_token": "...", "recovery_code": "abcde-fghij", "session": true }
+
+Possible responses:
+  200 OK                  - Returns a token pair or a cookie session like /auth/login
+  400 Bad Request         - Missing fields or sessions disabled
+  401 Unauthorized        - Invalid/expired mfa_token or wrong code
+  403 Forbidden           - Account disabled, deleted or password reset required
+  429 Too Many Requests   - Too many wrong codes, see Retry-After header
+  503 Service Unavailable - MFA_ENCRYPTION_KEY not configured
+  500 Internal Error      - Database or signing error
+*/
+func VerifyMFAHandler(pool *pgxpool.Pool, cfg *config.Config, keys *auth.KeySet, box *auth.SecretBox, throttle *auth.LoginThrottle, csrf *auth.CSRFProtector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if box == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Two-factor authentication is not configured"})
+			return
+		}
+
+		var verifyRequest MFAVerifyRequest
+
+		if err := c.ShouldBindJSON(&verifyRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if rejectSessionUnavailable(c, csrf, verifyRequest.Session) {
+			return
+		}
+
+		claims, err := auth.ParseMFAToken(keys, verifyRequest.MFAToken)
+
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+			return
+		}
+
+		if rejectRevokedMFAToken(c, pool, claims) {
+			return
+		}
+
+		userID := claims.UserID
+
+		throttleKey := auth.MFAThrottleKey(userID)
+
+		attempt, ok := reserveLoginAttempt(c, throttle, throttleKey)
+
+		if !ok {
+			return
+		}
+
+		totp, err := repository.GetTOTP(pool, userID)
+
+		if err != nil || totp.ConfirmedAt == nil {
+			if err := attempt.Release(); err != nil {
+				log.Printf("Failed to release MFA attempt: %v", err)
+			}
+
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+			return
+		}
+
+		valid, err := verifySecondFactor(pool, box, totp, verifyRequest.Code, verifyRequest.RecoveryCode)
+
+		if err != nil {
+			if err := attempt.Release(); err != nil {
+				log.Printf("Failed to release MFA attempt: %v", err)
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !valid {
+			if err := attempt.Failure(&userID, c.ClientIP()); err != nil {
+				log.Printf("Failed to record failed MFA attempt: %v", err)
+			}
+
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+			return
+		}
+
+		if err := attempt.Success(); err != nil {
+			log.Printf("Failed to clear MFA throttle: %v", err)
+		}
+
+		user, err := repository.GetUserByID(pool, userID)
+
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+			return
+		}
+
+		if rejectInactiveAccount(c, user) {
+			return
+		}
+
+		consumed, err := repository.ConsumeTokenID(pool, claims.JTI, userID, claims.ExpiresAt)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !consumed {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+			return
+		}
+
+		response, err := issueTokenPair(c, pool, cfg, keys, user, claims.Scopes)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token: " + err.Error()})
+			return
+		}
+
+		respondWithTokens(c, cfg, csrf, user, response, verifyRequest.Session)
+	}
+}
+
+/*
+rejectRevokedMFAToken answers 401 if an mfa_token was already exchanged
+or was issued before the user's tokens_invalid_before cutoff, the way
+RevocationStore.IsRevoked treats access tokens. It is checked before the
+code, so a dead token does not use up a recovery code. It returns true
+if the request must stop; database errors fail closed.
+*/
+func rejectRevokedMFAToken(c *gin.Context, pool *pgxpool.Pool, claims *auth.MFAClaims) bool {
+	revoked, err := repository.IsTokenRevoked(pool, claims.JTI)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	cutoff, _, err := repository.GetUserTokenState(pool, claims.UserID)
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+
+	if revoked || err != nil || (cutoff != nil && claims.IssuedAt.Before(cutoff.Truncate(time.Second))) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return true
+	}
+
+	return false
+}
+
+/*
+verifySecondFactor checks a TOTP code or, if none is given, a recovery
+code for a confirmed enrollment. Successful codes are consumed so they
+cannot be replayed.
+*/
+func verifySecondFactor(pool *pgxpool.Pool, box *auth.SecretBox, totp *models.UserTOTP, code string, recoveryCode string) (bool, error) {
+	if code != "" {
+		secret, err := box.Open(totp.SecretCiphertext, []byte(totp.UserID))
+
+		if err != nil {
+			return false, err
+		}
+
+		step, valid := auth.ValidateTOTP(string(secret), code, time.Now())
+
+		if !valid {
+			return false, nil
+		}
+
+		return repository.UseTOTPStep(pool, totp.UserID, step)
+	}
+
+	if recoveryCode != "" {
+		return repository.UseRecoveryCode(pool, totp.UserID, auth.HashRecoveryCode(recoveryCode))
+	}
+
+	return false, nil
+}
+
+/*
+mfaChallenge reports whether the user must complete a second factor and,
+if so, returns the challenge to send instead of a token pair.
+*/
+func mfaChallenge(pool *pgxpool.Pool, keys *auth.KeySet, user *models.User, scopes []string) (*MFAChallengeResponse, error) {
+	totp, err := repository.GetTOTP(pool, user.ID)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if totp.ConfirmedAt == nil {
+		return nil, nil
+	}
+
+	mfaToken, expiresAt, err := auth.GenerateMFAToken(keys, user.ID, scopes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresIn:   int64(time.Until(expiresAt).Seconds()),
+	}, nil
+}
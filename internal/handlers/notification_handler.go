@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+GetNotificationsHandler lists the authenticated user's in-app
+notifications, newest first.
+
+Authentication Required: YES
+
+Query parameters (all optional):
+  unread   - "true" to list unread notifications only
+  page     - Page number, starting at 1 (default 1)
+  per_page - Page size (default 20, max 100)
+
+Possible responses:
+  200 OK             - Returns list of notifications
+  400 Bad Request    - Invalid pagination parameter
+  500 Internal Error - Database error
+*/
+func GetNotificationsHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		page, perPage, err := parsePagination(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		notifications, err := repository.GetNotifications(pool, UserID, c.Query("unread") == "true", perPage, (page-1)*perPage)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, notifications)
+	}
+}
+
+/*
+MarkNotificationReadHandler marks one of the authenticated user's
+notifications as read. Admins impersonating the user cannot mark
+notifications read.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Notification ID
+
+Possible responses:
+  200 OK             - Notification marked as read
+  400 Bad Request    - Invalid ID format
+  403 Forbidden      - The caller is impersonating the user
+  404 Not Found      - Notification does not exist or belongs to someone
+                       else
+  500 Internal Error - Database error
+*/
+func MarkNotificationReadHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectWhileImpersonating(c) {
+			return
+		}
+
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+			return
+		}
+
+		if err := repository.MarkNotificationRead(pool, id, UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+	}
+}
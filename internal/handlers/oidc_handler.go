@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/oauth2"
+)
+
+// oidcStateCookie binds a login to the browser that started it, so a
+// victim cannot be signed in to an attacker's account by following a
+// crafted callback link (login CSRF).
+const oidcStateCookie = "oidc_state"
+
+// oidcTimeout bounds calls to the identity provider.
+const oidcTimeout = 10 * time.Second
+
+// oidcUserStore finds the account behind a provider identity, first by
+// the linked subject and then by email, and records new links and the
+// accounts created on a first login.
+type oidcUserStore interface {
+	GetUserByIdentity(provider string, subject string) (*models.User, error)
+	TouchUserIdentity(provider string, subject string, email string) error
+	GetUserByEmail(email string) (*models.User, error)
+	CreateUserIdentity(userID string, provider string, subject string, email string) error
+	CreateUserWithIdentity(email string, passwordHash string, provider string, subject string) (*models.User, error)
+}
+
+// poolOIDCUserStore is the oidcUserStore backed by the repository.
+type poolOIDCUserStore struct {
+	pool *pgxpool.Pool
+}
+
+func (s poolOIDCUserStore) GetUserByIdentity(provider string, subject string) (*models.User, error) {
+	return repository.GetUserByIdentity(s.pool, provider, subject)
+}
+
+func (s poolOIDCUserStore) TouchUserIdentity(provider string, subject string, email string) error {
+	return repository.TouchUserIdentity(s.pool, provider, subject, email)
+}
+
+func (s poolOIDCUserStore) GetUserByEmail(email string) (*models.User, error) {
+	return repository.GetUserByEmail(s.pool, email)
+}
+
+func (s poolOIDCUserStore) CreateUserIdentity(userID string, provider string, subject string, email string) error {
+	return repository.CreateUserIdentity(s.pool, userID, provider, subject, email)
+}
+
+func (s poolOIDCUserStore) CreateUserWithIdentity(email string, passwordHash string, provider string, subject string) (*models.User, error) {
+	return repository.CreateUserWithIdentity(s.pool, email, passwordHash, provider, subject)
+}
+
+/*
+OIDCLoginHandler starts a login through an external identity provider.
+
+This handler:
+  1. Generates a state, a nonce and a PKCE code verifier
+  2. Stores them (the state hashed) until the callback
+  3. Sets a short-lived cookie with the state
+  4. Redirects to the provider's authorization endpoint
+
+Authentication Required: NO
+
+URL Parameter:
+  provider - Configured provider name
+
+Query parameters:
+  scopes  - Optional space or comma separated API scopes for the tokens
+            issued at the end of the login (default: all scopes)
+  session - "true" to end the login in a cookie session, as on /auth/login
+
+Possible responses:
+  302 Found          - Redirect to the identity provider
+  400 Bad Request    - Unknown scope or sessions disabled
+  404 Not Found      - Unknown provider
+  502 Bad Gateway    - Identity provider unreachable
+  500 Internal Error - Database error
+*/
+func OIDCLoginHandler(pool *pgxpool.Pool, cfg *config.Config, providers map[string]*auth.OIDCProvider, csrf *auth.CSRFProtector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := providers[c.Param("provider")]
+
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+			return
+		}
+
+		scopes, err := auth.ResolveScopes(strings.FieldsFunc(c.Query("scopes"), func(r rune) bool { return r == ' ' || r == ',' }))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		session := c.Query("session") == "true"
+
+		if rejectSessionUnavailable(c, csrf, session) {
+			return
+		}
+
+		state, stateHash, err := auth.GenerateOpaqueToken()
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		nonce, err := auth.GenerateTokenID()
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		verifier := oauth2.GenerateVerifier()
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), oidcTimeout)
+		defer cancel()
+
+		authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+
+		if err != nil {
+			log.Printf("OIDC provider %s unavailable: %v", provider.Name, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+			return
+		}
+
+		loginState := &models.OIDCLoginState{
+			Provider:     provider.Name,
+			CodeVerifier: verifier,
+			Nonce:        nonce,
+			Scopes:       scopes,
+			Session:      session,
+		}
+
+		if err := repository.CreateOIDCLoginState(pool, stateHash, loginState, time.Now().Add(cfg.OIDCLoginTTL)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcStateCookie, state, int(cfg.OIDCLoginTTL.Seconds()), "/auth/oidc", "", c.Request.TLS != nil, true)
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+/*
+OIDCCallbackHandler completes a login through an external identity
+provider and returns the same response as LoginHandler.
+
+The identity is matched to an account in this order:
+  1. An identity already linked to a user (same provider and subject)
+  2. An existing user with the same email address, if the provider says
+     the address is verified and the local account has verified it too;
+     the identity is then linked to that user
+  3. Otherwise a new user is created with the provider's verified email
+
+Authentication Required: NO
+
+URL Parameter:
+  provider - Configured provider name
+
+Query parameters (set by the identity provider):
+  code  - Authorization code
+  state - State from OIDCLoginHandler
+
+Possible responses:
+  200 OK             - Returns a token pair, a cookie session, or an MFA challenge
+  400 Bad Request    - Missing, invalid, expired or foreign state, or the
+                       provider reported an error
+  401 Unauthorized   - Code exchange or ID token verification failed
+  403 Forbidden      - Email not verified, account inactive
+  404 Not Found      - Unknown provider
+  409 Conflict       - Email belongs to an account that cannot be linked
+  500 Internal Error - Database or signing error
+*/
+func OIDCCallbackHandler(pool *pgxpool.Pool, cfg *config.Config, keys *auth.KeySet, providers map[string]*auth.OIDCProvider, hasher auth.PasswordHasher, csrf *auth.CSRFProtector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := providers[c.Param("provider")]
+
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+			return
+		}
+
+		if errorCode := c.Query("error"); errorCode != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Identity provider returned an error: " + errorCode})
+			return
+		}
+
+		state := c.Query("state")
+		cookieState, _ := c.Cookie(oidcStateCookie)
+		c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", c.Request.TLS != nil, true)
+
+		if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state, please start the login again"})
+			return
+		}
+
+		loginState, err := repository.ConsumeOIDCLoginState(pool, auth.HashToken(state))
+
+		if err != nil {
+			if errors.Is(err, repository.ErrOIDCStateInvalid) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state, please start the login again"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if loginState.Provider != provider.Name {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state, please start the login again"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), oidcTimeout)
+		defer cancel()
+
+		claims, err := provider.Exchange(ctx, c.Query("code"), loginState.CodeVerifier, loginState.Nonce)
+
+		if err != nil {
+			log.Printf("OIDC login through %s failed: %v", provider.Name, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login with the identity provider failed"})
+			return
+		}
+
+		user, ok := resolveOIDCUser(c, poolOIDCUserStore{pool}, hasher, provider.Name, claims)
+
+		if !ok {
+			return
+		}
+
+		if rejectInactiveAccount(c, user) {
+			return
+		}
+
+		challenge, err := mfaChallenge(pool, keys, user, loginState.Scopes)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if challenge != nil {
+			c.JSON(http.StatusOK, challenge)
+			return
+		}
+
+		response, err := issueTokenPair(c, pool, cfg, keys, user, loginState.Scopes)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token: " + err.Error()})
+			return
+		}
+
+		respondWithTokens(c, cfg, csrf, user, response, loginState.Session && csrf != nil)
+	}
+}
+
+/*
+resolveOIDCUser finds or creates the user for a verified identity, as
+described on OIDCCallbackHandler. On failure the error response has been
+written and false is returned.
+
+Security:
+  Linking by email requires both sides to have verified the address.
+  Otherwise someone could register the victim's address locally before
+  the victim first uses single sign-on, and be handed the linked account.
+*/
+func resolveOIDCUser(c *gin.Context, store oidcUserStore, hasher auth.PasswordHasher, provider string, claims *auth.OIDCClaims) (*models.User, bool) {
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+
+	user, err := store.GetUserByIdentity(provider, claims.Subject)
+
+	if err == nil {
+		if err := store.TouchUserIdentity(provider, claims.Subject, email); err != nil {
+			log.Printf("Failed to record identity login: %v", err)
+		}
+
+		return user, true
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if email == "" || !claims.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The identity provider did not confirm a verified email address"})
+		return nil, false
+	}
+
+	if _, err := normalizeEmail(email); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	user, err = store.GetUserByEmail(email)
+
+	if err == nil {
+		if user.EmailVerifiedAt == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email exists; verify its email address before signing in with " + provider})
+			return nil, false
+		}
+
+		if err := store.CreateUserIdentity(user.ID, provider, claims.Subject, email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+
+		return user, true
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	// The account gets a random password nobody knows. The user can set
+	// one through the password reset flow to also sign in locally.
+	randomPassword, _, err := auth.GenerateOpaqueToken()
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	passwordHash, err := hasher.Hash(randomPassword)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return nil, false
+	}
+
+	user, err = store.CreateUserWithIdentity(email, passwordHash, provider, claims.Subject)
+
+	if err != nil {
+		if errors.Is(err, repository.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered, please try again"})
+			return nil, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return user, true
+}
+
+/*
+GetIdentitiesHandler lists the identity provider accounts linked to the
+authenticated user.
+
+Authentication Required: YES
+
+Possible responses:
+  200 OK             - Returns list of identities
+  500 Internal Error - Database error
+*/
+func GetIdentitiesHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		identities, err := repository.GetUserIdentities(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, identities)
+	}
+}
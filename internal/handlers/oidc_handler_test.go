@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeOIDCUserStore keeps users and linked identities in memory.
+type fakeOIDCUserStore struct {
+	users      map[string]*models.User // by email
+	identities map[string]string       // provider + " " + subject to user ID
+	linked     []string
+	touched    []string
+}
+
+func newFakeOIDCUserStore(users ...*models.User) *fakeOIDCUserStore {
+	store := &fakeOIDCUserStore{users: make(map[string]*models.User), identities: make(map[string]string)}
+
+	for _, user := range users {
+		store.users[user.Email] = user
+	}
+
+	return store
+}
+
+func (s *fakeOIDCUserStore) GetUserByIdentity(provider string, subject string) (*models.User, error) {
+	userID, ok := s.identities[provider+" "+subject]
+
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+
+	for _, user := range s.users {
+		if user.ID == userID {
+			return user, nil
+		}
+	}
+
+	return nil, pgx.ErrNoRows
+}
+
+func (s *fakeOIDCUserStore) TouchUserIdentity(provider string, subject string, email string) error {
+	s.touched = append(s.touched, provider+" "+subject)
+	return nil
+}
+
+func (s *fakeOIDCUserStore) GetUserByEmail(email string) (*models.User, error) {
+	user, ok := s.users[email]
+
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+
+	return user, nil
+}
+
+func (s *fakeOIDCUserStore) CreateUserIdentity(userID string, provider string, subject string, email string) error {
+	s.identities[provider+" "+subject] = userID
+	s.linked = append(s.linked, provider+" "+subject)
+	return nil
+}
+
+func (s *fakeOIDCUserStore) CreateUserWithIdentity(email string, passwordHash string, provider string, subject string) (*models.User, error) {
+	user := &models.User{ID: "new-user", Email: email, Password: passwordHash}
+	s.users[email] = user
+	s.identities[provider+" "+subject] = user.ID
+
+	return user, nil
+}
+
+func newTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	return c, recorder
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	providers := auth.NewOIDCProviders(&config.Config{OIDCProviders: []config.OIDCProvider{{
+		Name:      "test",
+		IssuerURL: "http://127.0.0.1:1",
+		ClientID:  "todos-client",
+	}}})
+
+	// A nil pool shows that the state is rejected before anything is
+	// looked up or redeemed.
+	router := gin.New()
+	router.GET("/auth/oidc/:provider/callback", OIDCCallbackHandler(nil, &config.Config{}, nil, providers, nil, nil))
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+	}{
+		{"cookie of another login", "?code=abc&state=state-1", "state-2"},
+		{"no cookie", "?code=abc&state=state-1", ""},
+		{"no state", "?code=abc", "state-1"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/auth/oidc/test/callback"+test.query, nil)
+
+		if test.cookie != "" {
+			request.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: test.cookie})
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", test.name, recorder.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestResolveOIDCUserDoesNotLinkUnverifiedEmail(t *testing.T) {
+	verifiedAt := time.Now()
+	store := newFakeOIDCUserStore(&models.User{ID: "ann", Email: "ann@example.com", EmailVerifiedAt: &verifiedAt})
+	c, recorder := newTestContext()
+
+	claims := &auth.OIDCClaims{Subject: "sub-1", Email: "ann@example.com", EmailVerified: false}
+
+	if user, ok := resolveOIDCUser(c, store, nil, "test", claims); ok {
+		t.Fatalf("signed in as %s with an unverified email", user.ID)
+	}
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+
+	if len(store.linked) != 0 {
+		t.Errorf("linked %v", store.linked)
+	}
+}
+
+func TestResolveOIDCUserDoesNotLinkLocallyUnverifiedAccount(t *testing.T) {
+	store := newFakeOIDCUserStore(&models.User{ID: "ann", Email: "ann@example.com"})
+	c, recorder := newTestContext()
+
+	claims := &auth.OIDCClaims{Subject: "sub-1", Email: "ann@example.com", EmailVerified: true}
+
+	if user, ok := resolveOIDCUser(c, store, nil, "test", claims); ok {
+		t.Fatalf("signed in as %s through an account that never verified its email", user.ID)
+	}
+
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusConflict)
+	}
+
+	if len(store.linked) != 0 {
+		t.Errorf("linked %v", store.linked)
+	}
+}
+
+func TestResolveOIDCUserLinksByVerifiedEmail(t *testing.T) {
+	verifiedAt := time.Now()
+	store := newFakeOIDCUserStore(&models.User{ID: "ann", Email: "ann@example.com", EmailVerifiedAt: &verifiedAt})
+	c, _ := newTestContext()
+
+	claims := &auth.OIDCClaims{Subject: "sub-1", Email: " Ann@Example.com ", EmailVerified: true}
+
+	user, ok := resolveOIDCUser(c, store, nil, "test", claims)
+
+	if !ok {
+		t.Fatal("login failed")
+	}
+
+	if user.ID != "ann" {
+		t.Errorf("signed in as %s, want ann", user.ID)
+	}
+
+	if len(store.linked) != 1 || store.identities["test sub-1"] != "ann" {
+		t.Errorf("linked %v to %q", store.linked, store.identities["test sub-1"])
+	}
+}
+
+func TestResolveOIDCUserFindsReturningUserBySubject(t *testing.T) {
+	verifiedAt := time.Now()
+	store := newFakeOIDCUserStore(
+		&models.User{ID: "ann", Email: "ann@example.com", EmailVerifiedAt: &verifiedAt},
+		&models.User{ID: "bob", Email: "bob@example.com", EmailVerifiedAt: &verifiedAt},
+	)
+	store.identities["test sub-1"] = "ann"
+	c, _ := newTestContext()
+
+	// The subject decides, even after the email changed at the provider
+	// and is no longer verified there.
+	claims := &auth.OIDCClaims{Subject: "sub-1", Email: "bob@example.com", EmailVerified: false}
+
+	user, ok := resolveOIDCUser(c, store, nil, "test", claims)
+
+	if !ok {
+		t.Fatal("login failed")
+	}
+
+	if user.ID != "ann" {
+		t.Errorf("signed in as %s, want ann", user.ID)
+	}
+
+	if len(store.linked) != 0 {
+		t.Errorf("linked %v again", store.linked)
+	}
+
+	if len(store.touched) != 1 {
+		t.Errorf("touched %v, want the identity once", store.touched)
+	}
+}
+
+func TestResolveOIDCUserSameSubjectOtherProvider(t *testing.T) {
+	store := newFakeOIDCUserStore()
+	store.identities["other sub-1"] = "ann"
+	c, recorder := newTestContext()
+
+	claims := &auth.OIDCClaims{Subject: "sub-1"}
+
+	if user, ok := resolveOIDCUser(c, store, nil, "test", claims); ok {
+		t.Fatalf("signed in as %s with a subject of another provider", user.ID)
+	}
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+}
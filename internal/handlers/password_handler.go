@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/mail"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+/*
+ForgotPasswordHandler starts the password reset flow.
+
+If the email belongs to an account, a single-use reset token is created
+and a link containing it is mailed to the user. The response is identical
+whether or not the email is registered, and the lookup and delivery happen
+after the response is sent so response timing does not reveal it either.
+
+Authentication Required: NO
+
+Request body:
+  { "email": "user@example.com" }
+
+Possible responses:
+  202 Accepted     - Always, unless the body is malformed
+  400 Bad Request  - Missing email
+*/
+func ForgotPasswordHandler(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var forgotRequest ForgotPasswordRequest
+
+		if err := c.ShouldBindJSON(&forgotRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		go sendPasswordResetEmail(pool, cfg, mailer, forgotRequest.Email)
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "If that email is registered, a password reset link has been sent"})
+	}
+}
+
+/*
+ResetPasswordHandler completes the password reset flow.
+
+The token is consumed atomically together with the password update, so a
+reset link works exactly once. Afterwards every access and refresh token
+of the user is revoked, signing out any session an attacker may hold.
+
+Authentication Required: NO (the reset token is the credential)
+
+Request body:
+  { "token": "<token from email>", "password": "<new password>" }
+
+Possible responses:
+  200 OK            - Password changed
+  400 Bad Request   - Invalid/expired token or password rejected by the policy
+  500 Internal Error - Database or hashing error
+*/
+func ResetPasswordHandler(pool *pgxpool.Pool, revocations *auth.RevocationStore, hasher auth.PasswordHasher, policy *auth.PasswordPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var resetRequest ResetPasswordRequest
+
+		if err := c.ShouldBindJSON(&resetRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tokenHash := auth.HashToken(resetRequest.Token)
+
+		email, err := repository.GetPasswordResetTokenEmail(pool, tokenHash)
+
+		if err != nil {
+			if errors.Is(err, repository.ErrPasswordResetTokenInvalid) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := policy.Check(resetRequest.Password, email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		hashedPassword, err := hasher.Hash(resetRequest.Password)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		userID, err := repository.ResetPasswordWithToken(pool, tokenHash, hashedPassword)
+
+		if err != nil {
+			if errors.Is(err, repository.ErrPasswordResetTokenInvalid) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := revocations.RevokeAllForUser(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+	}
+}
+
+/*
+sendPasswordResetEmail creates a reset token and mails the link.
+
+It runs detached from the request, so failures are only logged. Unknown
+emails are silently ignored.
+*/
+func sendPasswordResetEmail(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer, email string) {
+	user, err := repository.GetUserByEmail(pool, strings.TrimSpace(email))
+
+	if err != nil {
+		return
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+
+	if err != nil {
+		log.Printf("Failed to generate password reset token: %v", err)
+		return
+	}
+
+	if err := repository.CreatePasswordResetToken(pool, user.ID, tokenHash, time.Now().Add(cfg.PasswordResetTTL)); err != nil {
+		log.Printf("Failed to store password reset token: %v", err)
+		return
+	}
+
+	link := cfg.AppBaseURL + "/reset-password?token=" + url.QueryEscape(token)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err = mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Someone requested a password reset for your account.\n\n" +
+			"Use the link below to choose a new password. It expires in " + cfg.PasswordResetTTL.String() + " and can only be used once.\n\n" +
+			link + "\n\n" +
+			"If you did not request this, you can ignore this email.\n",
+	})
+
+	if err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+	}
+}
@@ -0,0 +1,669 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// maxProjectsPerUser limits how many projects, archived or not, a user
+	// can have.
+	maxProjectsPerUser = 200
+
+	// maxProjectNameLength matches the projects.name column.
+	maxProjectNameLength = 100
+
+	// maxMovedTodos limits how many todos one request can move.
+	maxMovedTodos = 500
+)
+
+type CreateProjectInput struct {
+	Name  string  `json:"name" binding:"required"`
+	Color *string `json:"color"`
+}
+
+type UpdateProjectInput struct {
+	Name     *string                 `json:"name"`
+	Color    models.Nullable[string] `json:"color"`
+	Archived *bool                   `json:"archived"`
+}
+
+type ReorderProjectsInput struct {
+	ProjectIDs []string `json:"project_ids" binding:"required"`
+}
+
+type MoveTodosInput struct {
+	TodoIDs []int `json:"todo_ids" binding:"required"`
+}
+
+// InboxSummary counts the todos of a user that are in no project.
+type InboxSummary struct {
+	TodoCount int `json:"todo_count"`
+	OpenCount int `json:"open_count"`
+}
+
+// ProjectList is the response of GET /projects.
+type ProjectList struct {
+	Inbox    InboxSummary     `json:"inbox"`
+	Projects []models.Project `json:"projects"`
+}
+
+// projectName trims a project name and checks its length.
+func projectName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" || len([]rune(name)) > maxProjectNameLength {
+		return "", errors.New("name must be between 1 and 100 characters")
+	}
+
+	return name, nil
+}
+
+/*
+checkProject verifies that a project_id sent for a todo names one of the
+user's projects that is not archived. It answers 400 itself and returns
+false if the request must stop.
+*/
+func checkProject(c *gin.Context, pool *pgxpool.Pool, userID string, projectID string) bool {
+	if !isUUID(projectID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return false
+	}
+
+	if err := repository.CheckProject(pool, projectID, userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Project not found"})
+			return false
+		}
+
+		if errors.Is(err, repository.ErrProjectArchived) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Todos cannot be added to an archived project"})
+			return false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+/*
+GetProjectsHandler lists the authenticated user's projects in their
+order, with the number of todos in each and in the Inbox.
+
+Authentication Required: YES
+
+Query parameters (all optional):
+  archived - "true" to list archived projects too
+
+Possible responses:
+  200 OK             - Returns { "inbox": {...}, "projects": [...] }
+  400 Bad Request    - Invalid archived parameter
+  500 Internal Error - Database error
+*/
+func GetProjectsHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		includeArchived, err := strconv.ParseBool(c.DefaultQuery("archived", "false"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "archived must be true or false"})
+			return
+		}
+
+		projects, err := repository.GetProjects(pool, UserID, includeArchived)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		todoCount, openCount, err := repository.GetInboxCounts(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, ProjectList{
+			Inbox:    InboxSummary{TodoCount: todoCount, OpenCount: openCount},
+			Projects: projects,
+		})
+	}
+}
+
+/*
+CreateProjectHandler creates a project for the authenticated user. New
+projects come after the user's other projects.
+
+Authentication Required: YES
+
+Request body:
+  { "name": "Home renovation", "color": "#43a047" }
+
+  color is optional.
+
+Possible responses:
+  201 Created        - Project created
+  400 Bad Request    - Invalid JSON, name or color, or the user already
+                       has 200 projects
+  500 Internal Error - Database error
+*/
+func CreateProjectHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		var input CreateProjectInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		name, err := projectName(input.Name)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		project := &models.Project{UserID: UserID, Name: name}
+
+		if input.Color != nil {
+			color, err := parseColor(*input.Color)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			project.Color = &color
+		}
+
+		existing, err := repository.GetProjects(pool, UserID, true)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(existing) >= maxProjectsPerUser {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A user can have at most " + strconv.Itoa(maxProjectsPerUser) + " projects"})
+			return
+		}
+
+		project, err = repository.CreateProject(pool, project)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, project)
+	}
+}
+
+/*
+GetProjectHandler retrieves one of the authenticated user's projects with
+its todo counts.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Project ID
+
+Possible responses:
+  200 OK             - Returns the project
+  400 Bad Request    - Invalid ID format
+  404 Not Found      - Project does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func GetProjectHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+			return
+		}
+
+		project, err := repository.GetProject(pool, id, UserID)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, project)
+	}
+}
+
+/*
+UpdateProjectHandler renames, recolors, archives or unarchives a project.
+
+Archiving hides the project's todos from GET /todos without deleting
+them; they can still be listed with GET /projects/:id/todos, and come
+back when the project is unarchived.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Project ID
+
+Request body (at least one field):
+  { "name": "Garden", "color": null, "archived": true }
+
+  A null color removes the color.
+
+Possible responses:
+  200 OK             - Returns the updated project
+  400 Bad Request    - Invalid ID, JSON, name or color, or no field given
+  404 Not Found      - Project does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func UpdateProjectHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+			return
+		}
+
+		var input UpdateProjectInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if input.Name == nil && !input.Color.Set && input.Archived == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one field is required (name/color/archived)"})
+			return
+		}
+
+		if input.Name != nil {
+			name, err := projectName(*input.Name)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			input.Name = &name
+		}
+
+		if input.Color.Value != nil {
+			color, err := parseColor(*input.Color.Value)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			input.Color.Value = &color
+		}
+
+		project, err := repository.UpdateProject(pool, id, UserID, input.Name, input.Color, input.Archived)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, project)
+	}
+}
+
+/*
+DeleteProjectHandler deletes a project. Its todos are kept and move to the
+Inbox. Admins impersonating the user cannot delete projects.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Project ID
+
+Possible responses:
+  200 OK             - Project deleted
+  400 Bad Request    - Invalid ID format
+  403 Forbidden      - The caller is impersonating the user
+  404 Not Found      - Project does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func DeleteProjectHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectWhileImpersonating(c) {
+			return
+		}
+
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+			return
+		}
+
+		if err := repository.DeleteProject(pool, id, UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Project successfully deleted"})
+	}
+}
+
+/*
+ReorderProjectsHandler sets the order of the authenticated user's
+projects. The listed projects come first, in the given order; projects
+left out keep their relative order after them.
+
+Authentication Required: YES
+
+Request body:
+  { "project_ids": ["3c6e0b8a-...", "9f1d2e4b-..."] }
+
+Possible responses:
+  200 OK             - Returns the projects, archived ones included, in
+                       their new order
+  400 Bad Request    - Invalid JSON or ID, a repeated ID, or an ID that is
+                       not one of the user's projects
+  500 Internal Error - Database error
+*/
+func ReorderProjectsHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		var input ReorderProjectsInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(input.ProjectIDs) > maxProjectsPerUser {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Too many project IDs"})
+			return
+		}
+
+		seen := make(map[string]bool)
+
+		for i, id := range input.ProjectIDs {
+			if !isUUID(id) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID: " + id})
+				return
+			}
+
+			id = strings.ToLower(id)
+
+			if seen[id] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Project ID listed twice: " + id})
+				return
+			}
+
+			seen[id] = true
+			input.ProjectIDs[i] = id
+		}
+
+		if err := repository.ReorderProjects(pool, UserID, input.ProjectIDs); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "project_ids must only contain your own projects"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		projects, err := repository.GetProjects(pool, UserID, true)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, projects)
+	}
+}
+
+// projectParam reads the :id of a /projects/:id/todos route, which is
+// either a project ID or "inbox". It answers 400 or 404 itself and returns
+// false if the request must stop.
+func projectParam(c *gin.Context, pool *pgxpool.Pool, userID string) (string, bool) {
+	id := c.Param("id")
+
+	if id == repository.ProjectInbox {
+		return id, true
+	}
+
+	if !isUUID(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return "", false
+	}
+
+	if _, err := repository.GetProject(pool, id, userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return "", false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+
+	return id, true
+}
+
+/*
+GetProjectTodosHandler lists the todos of one project, or of the Inbox,
+newest first. The todos of an archived project are listed too.
+
+Authentication Required: YES
+
+URL Parameter:
+  id - Project ID, or "inbox" for the todos in no project
+
+Query parameters (all optional):
+  due, priority, tag, q, notes_format - As for GET /todos
+
+Possible responses:
+  200 OK             - Returns list of ToDos
+  400 Bad Request    - Invalid ID or filter
+  404 Not Found      - Project does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func GetProjectTodosHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		project, ok := projectParam(c, pool, UserID)
+
+		if !ok {
+			return
+		}
+
+		filter, ok := todoFilter(c, pool, UserID)
+
+		if !ok {
+			return
+		}
+
+		filter.Project = project
+
+		asHTML, ok := notesAsHTML(c)
+
+		if !ok {
+			return
+		}
+
+		todos, err := repository.GetAllTodos(pool, UserID, filter)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if asHTML {
+			if err := renderNotes(todos); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, todos)
+	}
+}
+
+/*
+MoveTodosHandler moves todos into a project, or back to the Inbox, all at
+once. Todos that do not exist or belong to someone else are skipped.
+
+Authentication Required: YES
+
+URL Parameter:
+  id - Target project ID, or "inbox"
+
+Request body:
+  { "todo_ids": [12, 15, 31] }
+
+Possible responses:
+  200 OK             - Returns { "moved": n }
+  400 Bad Request    - Invalid ID or JSON, too many todos, or the project
+                       is archived
+  404 Not Found      - Project does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func MoveTodosHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		var projectID *string
+
+		if id := c.Param("id"); id != repository.ProjectInbox {
+			if !isUUID(id) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+				return
+			}
+
+			projectID = &id
+		}
+
+		var input MoveTodosInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(input.TodoIDs) > maxMovedTodos {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At most " + strconv.Itoa(maxMovedTodos) + " todos can be moved at once"})
+			return
+		}
+
+		moved, err := repository.MoveTodos(pool, UserID, projectID, input.TodoIDs)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+				return
+			}
+
+			if errors.Is(err, repository.ErrProjectArchived) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Todos cannot be added to an archived project"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"moved": moved})
+	}
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// maxRemindersPerTodo limits how many reminders a todo can have.
+	maxRemindersPerTodo = 10
+
+	// maxReminderOffset is the furthest before the due date a relative
+	// reminder can fire.
+	maxReminderOffset = 365 * 24 * 60
+
+	// maxSnooze is the furthest a reminder can be snoozed.
+	maxSnooze = 365 * 24 * time.Hour
+)
+
+type CreateReminderInput struct {
+	OffsetMinutes *int       `json:"offset_minutes"`
+	RemindAt      *time.Time `json:"remind_at"`
+	Channel       string     `json:"channel" binding:"required"`
+	WebhookURL    string     `json:"webhook_url"`
+}
+
+type SnoozeReminderInput struct {
+	Minutes *int       `json:"minutes"`
+	Until   *time.Time `json:"until"`
+}
+
+// reminderTodoID parses the todo ID of a reminder route and answers 400
+// if it is invalid. It returns false if the request must stop.
+func reminderTodoID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid todo ID"})
+		return 0, false
+	}
+
+	return id, true
+}
+
+/*
+GetRemindersHandler lists the reminders of a todo, in the order they
+fire.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (int) - Todo ID
+
+Possible responses:
+  200 OK             - Returns list of reminders
+  400 Bad Request    - Invalid ID format
+  404 Not Found      - Todo does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func GetRemindersHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		todoID, ok := reminderTodoID(c)
+
+		if !ok {
+			return
+		}
+
+		if _, err := repository.GetTodoByID(pool, todoID, UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "ToDo not Found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		reminders, err := repository.GetReminders(pool, todoID, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, reminders)
+	}
+}
+
+/*
+CreateReminderHandler adds a reminder to a todo.
+
+A reminder is either relative to the todo's due date (offset_minutes
+before it; it follows the due date when that changes and waits while the
+todo has none) or absolute (remind_at). For a whole-day due date the
+offset counts from the start of that day in the user's time zone.
+
+Channels:
+  email   - An email to the account's address
+  webhook - A POST to webhook_url (https only), see notify.WebhookNotifier
+  in_app  - A notification listed under GET /me/notifications
+
+Authentication Required: YES
+
+URL Parameter:
+  id (int) - Todo ID
+
+Request body:
+  { "offset_minutes": 30, "channel": "email" }
+  { "remind_at": "2026-11-01T08:00:00+01:00", "channel": "webhook", "webhook_url": "https://example.com/hook" }
+
+Possible responses:
+  201 Created        - Returns the reminder
+  400 Bad Request    - Invalid JSON, neither or both of offset_minutes and
+                       remind_at, unknown channel or invalid webhook URL
+  404 Not Found      - Todo does not exist or belongs to someone else
+  409 Conflict       - The todo already has the maximum number of reminders
+  500 Internal Error - Database error
+*/
+func CreateReminderHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		todoID, ok := reminderTodoID(c)
+
+		if !ok {
+			return
+		}
+
+		var input CreateReminderInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if (input.OffsetMinutes == nil) == (input.RemindAt == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of offset_minutes and remind_at is required"})
+			return
+		}
+
+		if input.OffsetMinutes != nil && (*input.OffsetMinutes < 0 || *input.OffsetMinutes > maxReminderOffset) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset_minutes must be between 0 and 525600"})
+			return
+		}
+
+		reminder := &models.Reminder{
+			TodoID:        todoID,
+			UserID:        UserID,
+			OffsetMinutes: input.OffsetMinutes,
+			RemindAt:      input.RemindAt,
+			Channel:       input.Channel,
+		}
+
+		switch input.Channel {
+		case models.ReminderChannelEmail, models.ReminderChannelInApp:
+		case models.ReminderChannelWebhook:
+			parsed, err := url.Parse(input.WebhookURL)
+
+			if err != nil || parsed.Scheme != "https" || parsed.Host == "" || parsed.User != nil || len(input.WebhookURL) > 2048 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "webhook_url must be an https URL"})
+				return
+			}
+
+			reminder.WebhookURL = &input.WebhookURL
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "channel must be \"email\", \"webhook\" or \"in_app\""})
+			return
+		}
+
+		existing, err := repository.GetReminders(pool, todoID, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(existing) >= maxRemindersPerTodo {
+			c.JSON(http.StatusConflict, gin.H{"error": "A todo can have at most 10 reminders"})
+			return
+		}
+
+		reminder, err = repository.CreateReminder(pool, reminder)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "ToDo not Found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, reminder)
+	}
+}
+
+/*
+DeleteReminderHandler removes a reminder from a todo. Admins impersonating
+the user cannot delete reminders.
+
+Authentication Required: YES
+
+URL Parameters:
+  id (int)           - Todo ID
+  reminder_id (uuid) - Reminder ID
+
+Possible responses:
+  200 OK             - Reminder deleted
+  400 Bad Request    - Invalid ID format
+  403 Forbidden      - The caller is impersonating the user
+  404 Not Found      - Reminder does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func DeleteReminderHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectWhileImpersonating(c) {
+			return
+		}
+
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		todoID, ok := reminderTodoID(c)
+
+		if !ok {
+			return
+		}
+
+		id := c.Param("reminder_id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reminder ID"})
+			return
+		}
+
+		if err := repository.DeleteReminder(pool, id, todoID, UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Reminder not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Reminder successfully deleted"})
+	}
+}
+
+/*
+SnoozeReminderHandler makes a reminder fire again later, whether it has
+already been sent or not.
+
+Authentication Required: YES
+
+URL Parameters:
+  id (int)           - Todo ID
+  reminder_id (uuid) - Reminder ID
+
+Request body (one of):
+  { "minutes": 10 }
+  { "until": "2026-11-01T09:00:00+01:00" }
+
+Possible responses:
+  200 OK             - Returns the updated reminder
+  400 Bad Request    - Invalid JSON, neither or both fields, or a time that
+                       is not in the coming year
+  404 Not Found      - Reminder does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func SnoozeReminderHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		todoID, ok := reminderTodoID(c)
+
+		if !ok {
+			return
+		}
+
+		id := c.Param("reminder_id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reminder ID"})
+			return
+		}
+
+		var input SnoozeReminderInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if (input.Minutes == nil) == (input.Until == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of minutes and until is required"})
+			return
+		}
+
+		now := time.Now()
+		var until time.Time
+
+		if input.Minutes != nil {
+			if *input.Minutes < 1 || *input.Minutes > maxReminderOffset {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "minutes must be between 1 and 525600"})
+				return
+			}
+
+			until = now.Add(time.Duration(*input.Minutes) * time.Minute)
+		} else {
+			until = *input.Until
+		}
+
+		if !until.After(now) || until.Sub(now) > maxSnooze {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A reminder can be snoozed into the coming year only"})
+			return
+		}
+
+		reminder, err := repository.SnoozeReminder(pool, id, todoID, UserID, until)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Reminder not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, reminder)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionResponse replaces LoginResponse when the tokens are set as
+// cookies. The CSRF token is also in the csrf_token cookie; it is
+// returned here for front ends served from another origin.
+type SessionResponse struct {
+	TokenType string `json:"token_type"`
+	ExpiresIn int64  `json:"expires_in"`
+	CSRFToken string `json:"csrf_token"`
+}
+
+// rejectSessionUnavailable answers 400 if a client asked for a cookie
+// session while they are disabled. It returns true if the request must
+// stop.
+func rejectSessionUnavailable(c *gin.Context, csrf *auth.CSRFProtector, session bool) bool {
+	if session && csrf == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cookie sessions are not enabled"})
+		return true
+	}
+
+	return false
+}
+
+/*
+respondWithTokens writes a freshly issued token pair.
+
+API clients get the tokens in the body. Browser clients that asked for a
+session get them as HttpOnly cookies together with a new CSRF token, and
+the body only says when the access token expires.
+*/
+func respondWithTokens(c *gin.Context, cfg *config.Config, csrf *auth.CSRFProtector, user *models.User, response *LoginResponse, session bool) {
+	if !session {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	csrfToken, err := csrf.NewToken(user.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate CSRF token"})
+		return
+	}
+
+	setSessionCookies(c, cfg, response, csrfToken)
+
+	c.JSON(http.StatusOK, SessionResponse{
+		TokenType: "Cookie",
+		ExpiresIn: response.ExpiresIn,
+		CSRFToken: csrfToken,
+	})
+}
+
+// setSessionCookies stores the token pair and the CSRF token in cookies.
+func setSessionCookies(c *gin.Context, cfg *config.Config, response *LoginResponse, csrfToken string) {
+	refreshMaxAge := int(cfg.RefreshTokenTTL.Seconds())
+
+	http.SetCookie(c.Writer, sessionCookie(cfg, auth.AccessTokenCookie, response.Token, "/", int(response.ExpiresIn), true))
+	http.SetCookie(c.Writer, sessionCookie(cfg, auth.RefreshTokenCookie, response.RefreshToken, "/auth", refreshMaxAge, true))
+	http.SetCookie(c.Writer, sessionCookie(cfg, auth.CSRFCookie, csrfToken, "/", refreshMaxAge, false))
+}
+
+// clearSessionCookies removes the session cookies from the browser.
+func clearSessionCookies(c *gin.Context, cfg *config.Config) {
+	http.SetCookie(c.Writer, sessionCookie(cfg, auth.AccessTokenCookie, "", "/", -1, true))
+	http.SetCookie(c.Writer, sessionCookie(cfg, auth.RefreshTokenCookie, "", "/auth", -1, true))
+	http.SetCookie(c.Writer, sessionCookie(cfg, auth.CSRFCookie, "", "/", -1, false))
+}
+
+func sessionCookie(cfg *config.Config, name string, value string, path string, maxAge int, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cfg.SessionCookieDomain,
+		MaxAge:   maxAge,
+		Secure:   cfg.SessionCookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: sessionSameSite(cfg),
+	}
+
+	if maxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+	}
+
+	return cookie
+}
+
+// sessionSameSite maps SESSION_COOKIE_SAMESITE to a cookie attribute,
+// defaulting to Lax.
+func sessionSameSite(cfg *config.Config) http.SameSite {
+	switch strings.ToLower(cfg.SessionCookieSameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// hasDoubleSubmittedCSRFToken reports whether the CSRF header matches the
+// CSRF cookie. The token's signature is checked separately, once the user
+// is known.
+func hasDoubleSubmittedCSRFToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader(auth.CSRFHeader)
+	cookie, err := c.Cookie(auth.CSRFCookie)
+
+	if err != nil || header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 {
+		return "", false
+	}
+
+	return header, true
+}
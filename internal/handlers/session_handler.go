@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"todos_api/internal/auth"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SessionInfo is a session as listed to its owner.
+type SessionInfo struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+/*
+GetSessionsHandler lists the devices the authenticated user is logged in
+on, most recently seen first.
+
+The last seen time is updated at most once a minute, and only while the
+session's access tokens are used.
+
+Authentication Required: YES
+
+Possible responses:
+  200 OK             - Returns list of sessions; "current" marks the one
+                       the request was made with
+  500 Internal Error - Database error
+*/
+func GetSessionsHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		sessions, err := repository.GetActiveSessions(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		currentSessionID := ""
+
+		if claims, ok := tokenClaims(c); ok {
+			currentSessionID = claims.SessionID
+		}
+
+		var response []SessionInfo = []SessionInfo{}
+
+		for _, session := range sessions {
+			response = append(response, SessionInfo{Session: session, Current: session.ID == currentSessionID})
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+/*
+RevokeSessionHandler signs out one of the authenticated user's sessions,
+for example a lost device.
+
+Its refresh tokens stop working immediately and its access tokens are
+rejected within REVOCATION_CACHE_TTL on every replica. Revoking the
+current session works like /auth/logout.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Session ID
+
+Possible responses:
+  200 OK             - Session revoked
+  400 Bad Request    - Invalid ID format
+  404 Not Found      - Session does not exist, is already revoked or
+                       belongs to someone else
+  500 Internal Error - Database error
+*/
+func RevokeSessionHandler(cfg *config.Config, revocations *auth.RevocationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+			return
+		}
+
+		if err := revocations.RevokeSession(UserID, id); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if claims, ok := tokenClaims(c); ok && claims.SessionID == id && c.GetBool("session_cookie") {
+			clearSessionCookies(c, cfg)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Session successfully revoked"})
+	}
+}
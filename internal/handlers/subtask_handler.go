@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Values of the subtasks query parameter when completing a todo.
+const (
+	keepSubtasks     = "keep"
+	completeSubtasks = "complete"
+)
+
+var errRecurringSubtask = errors.New("A recurring todo cannot be a subtask")
+
+// deleteSubtasksMode reads the subtasks query parameter of a delete. It
+// answers 400 itself and returns false if the request must stop.
+func deleteSubtasksMode(c *gin.Context) (string, bool) {
+	mode := c.DefaultQuery("subtasks", repository.PromoteSubtasks)
+
+	if mode != repository.PromoteSubtasks && mode != repository.DeleteSubtasks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "subtasks must be \"promote\" or \"delete\""})
+		return "", false
+	}
+
+	return mode, true
+}
+
+// completeSubtasksRequested reads the subtasks query parameter of a
+// completion. It answers 400 itself and returns false as its second value
+// if the request must stop.
+func completeSubtasksRequested(c *gin.Context) (bool, bool) {
+	switch c.DefaultQuery("subtasks", keepSubtasks) {
+	case keepSubtasks:
+		return false, true
+	case completeSubtasks:
+		return true, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "subtasks must be \"keep\" or \"complete\""})
+		return false, false
+	}
+}
+
+// subtaskError answers 400 for the errors the repository returns when a
+// parent_id cannot be used. It returns true if it answered.
+func subtaskError(c *gin.Context, err error) bool {
+	if errors.Is(err, repository.ErrParentNotFound) || errors.Is(err, repository.ErrTodoCycle) || errors.Is(err, repository.ErrTodoTooDeep) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return true
+	}
+
+	return false
+}
+
+/*
+GetSubtasksHandler lists the subtasks of a todo, oldest first.
+
+Each todo reports the progress of its own direct subtasks in "subtasks",
+for example { "done": 3, "total": 5 }.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (int) - ToDo ID
+
+Query parameters (all optional):
+  recursive    - "true" to list the subtasks of the subtasks too, each
+                 todo followed by its own subtasks; parent_id tells them
+                 apart
+  notes_format - "markdown" (the default) or "html", as for GET /todos
+
+Possible responses:
+  200 OK             - Returns list of ToDos
+  400 Bad Request    - Invalid ID, recursive or notes_format parameter
+  404 Not Found      - ToDo does not exist or does not belong to user
+  500 Internal Error - Database error
+*/
+func GetSubtasksHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id, err := strconv.Atoi(c.Param("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid todo ID"})
+			return
+		}
+
+		recursive, err := strconv.ParseBool(c.DefaultQuery("recursive", "false"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recursive must be true or false"})
+			return
+		}
+
+		asHTML, ok := notesAsHTML(c)
+
+		if !ok {
+			return
+		}
+
+		todos, err := repository.GetSubtasks(pool, id, UserID, recursive)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "To-Do not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if asHTML {
+			if err := renderNotes(todos); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, todos)
+	}
+}
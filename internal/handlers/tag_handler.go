@@ -0,0 +1,617 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// maxTagsPerUser limits how many tags a user can have.
+	maxTagsPerUser = 500
+
+	// maxTagNameLength matches the tags.name column.
+	maxTagNameLength = 50
+)
+
+// colorPattern accepts colors written as "#rrggbb".
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type CreateTagInput struct {
+	Name  string  `json:"name" binding:"required"`
+	Color *string `json:"color"`
+}
+
+type UpdateTagInput struct {
+	Name  *string                 `json:"name"`
+	Color models.Nullable[string] `json:"color"`
+}
+
+type MergeTagInput struct {
+	Into string `json:"into" binding:"required"`
+}
+
+type ReorderTagsInput struct {
+	TagIDs []string `json:"tag_ids" binding:"required"`
+}
+
+// tagName trims a tag name and checks its length.
+func tagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" || len([]rune(name)) > maxTagNameLength {
+		return "", errors.New("name must be between 1 and 50 characters")
+	}
+
+	return name, nil
+}
+
+// parseColor checks a tag or project color and writes it in lower case.
+func parseColor(color string) (string, error) {
+	if !colorPattern.MatchString(color) {
+		return "", errors.New("color must be written as #rrggbb")
+	}
+
+	return strings.ToLower(color), nil
+}
+
+/*
+GetTagsHandler lists the authenticated user's tags in their order.
+
+Authentication Required: YES
+
+Possible responses:
+  200 OK             - Returns list of tags, each with the number of todos
+                       carrying it
+  500 Internal Error - Database error
+*/
+func GetTagsHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		tags, err := repository.GetTags(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, tags)
+	}
+}
+
+/*
+CreateTagHandler creates a tag for the authenticated user. New tags come
+after the user's other tags.
+
+Tag names are unique per user, ignoring case.
+
+Authentication Required: YES
+
+Request body:
+  { "name": "Work", "color": "#1e88e5" }
+
+  color is optional.
+
+Possible responses:
+  201 Created        - Tag created
+  400 Bad Request    - Invalid JSON, name or color, or the user already
+                       has 500 tags
+  409 Conflict       - The user already has a tag with this name
+  500 Internal Error - Database error
+*/
+func CreateTagHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		var input CreateTagInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		name, err := tagName(input.Name)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tag := &models.Tag{UserID: UserID, Name: name}
+
+		if input.Color != nil {
+			color, err := parseColor(*input.Color)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			tag.Color = &color
+		}
+
+		existing, err := repository.GetTags(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(existing) >= maxTagsPerUser {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A user can have at most " + strconv.Itoa(maxTagsPerUser) + " tags"})
+			return
+		}
+
+		tag, err = repository.CreateTag(pool, tag)
+
+		if err != nil {
+			if errors.Is(err, repository.ErrTagExists) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, tag)
+	}
+}
+
+/*
+UpdateTagHandler renames or recolors a tag. The change shows on every todo
+carrying the tag at once.
+
+To combine two tags, merge them with POST /tags/:id/merge instead of
+renaming one to the other's name.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Tag ID
+
+Request body (at least one field):
+  { "name": "Office", "color": null }
+
+  A null color removes the color.
+
+Possible responses:
+  200 OK             - Returns the updated tag
+  400 Bad Request    - Invalid ID, JSON, name or color, or no field given
+  404 Not Found      - Tag does not exist or belongs to someone else
+  409 Conflict       - The user already has a tag with this name
+  500 Internal Error - Database error
+*/
+func UpdateTagHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+			return
+		}
+
+		var input UpdateTagInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if input.Name == nil && !input.Color.Set {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one field is required (name/color)"})
+			return
+		}
+
+		if input.Name != nil {
+			name, err := tagName(*input.Name)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			input.Name = &name
+		}
+
+		if input.Color.Value != nil {
+			color, err := parseColor(*input.Color.Value)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			input.Color.Value = &color
+		}
+
+		tag, err := repository.UpdateTag(pool, id, UserID, input.Name, input.Color)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+				return
+			}
+
+			if errors.Is(err, repository.ErrTagExists) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, tag)
+	}
+}
+
+/*
+DeleteTagHandler deletes a tag and removes it from every todo. The todos
+themselves are kept. Admins impersonating the user cannot delete tags.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Tag ID
+
+Possible responses:
+  200 OK             - Tag deleted
+  400 Bad Request    - Invalid ID format
+  403 Forbidden      - The caller is impersonating the user
+  404 Not Found      - Tag does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func DeleteTagHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectWhileImpersonating(c) {
+			return
+		}
+
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+			return
+		}
+
+		if err := repository.DeleteTag(pool, id, UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Tag successfully deleted"})
+	}
+}
+
+/*
+MergeTagHandler merges a tag into another: every todo carrying the tag
+gets the other one instead, and the tag is deleted. This happens in one
+transaction, so no todo is ever left without either tag. Admins
+impersonating the user cannot merge tags.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Tag that is merged and deleted
+
+Request body:
+  { "into": "7f9c2a4e-..." }
+
+Possible responses:
+  200 OK             - Returns the kept tag
+  400 Bad Request    - Invalid ID or JSON, or merging a tag into itself
+  403 Forbidden      - The caller is impersonating the user
+  404 Not Found      - One of the tags does not exist or belongs to
+                       someone else
+  500 Internal Error - Database error
+*/
+func MergeTagHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectWhileImpersonating(c) {
+			return
+		}
+
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+			return
+		}
+
+		var input MergeTagInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !isUUID(input.Into) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID in into"})
+			return
+		}
+
+		if strings.EqualFold(input.Into, id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A tag cannot be merged into itself"})
+			return
+		}
+
+		tag, err := repository.MergeTags(pool, id, input.Into, UserID)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, tag)
+	}
+}
+
+/*
+ReorderTagsHandler sets the order of the authenticated user's tags. The
+listed tags come first, in the given order; tags left out keep their
+relative order after them.
+
+Authentication Required: YES
+
+Request body:
+  { "tag_ids": ["7f9c2a4e-...", "0b1d5e8a-..."] }
+
+Possible responses:
+  200 OK             - Returns the tags in their new order
+  400 Bad Request    - Invalid JSON or ID, a repeated ID, or an ID that is
+                       not one of the user's tags
+  500 Internal Error - Database error
+*/
+func ReorderTagsHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		var input ReorderTagsInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(input.TagIDs) > maxTagsPerUser {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Too many tag IDs"})
+			return
+		}
+
+		seen := make(map[string]bool)
+
+		for i, id := range input.TagIDs {
+			if !isUUID(id) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID: " + id})
+				return
+			}
+
+			id = strings.ToLower(id)
+
+			if seen[id] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Tag ID listed twice: " + id})
+				return
+			}
+
+			seen[id] = true
+			input.TagIDs[i] = id
+		}
+
+		if err := repository.ReorderTags(pool, UserID, input.TagIDs); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "tag_ids must only contain your own tags"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		tags, err := repository.GetTags(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, tags)
+	}
+}
+
+// todoTagParams parses the todo and tag IDs of a /todos/:id/tags/:tag_id
+// route and answers 400 if one is invalid. It returns false if the
+// request must stop.
+func todoTagParams(c *gin.Context) (int, string, bool) {
+	todoID, err := strconv.Atoi(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid todo ID"})
+		return 0, "", false
+	}
+
+	tagID := c.Param("tag_id")
+
+	if !isUUID(tagID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return 0, "", false
+	}
+
+	return todoID, tagID, true
+}
+
+/*
+AttachTagHandler puts one of the user's tags on a todo. Attaching a tag
+the todo already carries succeeds without changing anything.
+
+Authentication Required: YES
+
+URL Parameters:
+  id (int)      - ToDo ID
+  tag_id (uuid) - Tag ID
+
+Possible responses:
+  200 OK             - Returns the todo with its tags
+  400 Bad Request    - Invalid ID format
+  404 Not Found      - The todo or the tag does not exist or belongs to
+                       someone else
+  500 Internal Error - Database error
+*/
+func AttachTagHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		todoID, tagID, ok := todoTagParams(c)
+
+		if !ok {
+			return
+		}
+
+		if err := repository.AttachTag(pool, todoID, tagID, UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "To-Do or tag not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		todo, err := repository.GetTodoByID(pool, todoID, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, todo)
+	}
+}
+
+/*
+DetachTagHandler removes a tag from a todo. The tag itself is kept.
+
+Authentication Required: YES
+
+URL Parameters:
+  id (int)      - ToDo ID
+  tag_id (uuid) - Tag ID
+
+Possible responses:
+  200 OK             - Returns the todo with its remaining tags
+  400 Bad Request    - Invalid ID format
+  404 Not Found      - The todo does not exist, belongs to someone else or
+                       does not carry the tag
+  500 Internal Error - Database error
+*/
+func DetachTagHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		todoID, tagID, ok := todoTagParams(c)
+
+		if !ok {
+			return
+		}
+
+		if err := repository.DetachTag(pool, todoID, tagID, UserID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "To-Do does not carry this tag"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		todo, err := repository.GetTodoByID(pool, todoID, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, todo)
+	}
+}
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"todos_api/internal/markdown"
+	"todos_api/internal/models"
 	"todos_api/internal/repository"
 
 	"github.com/gin-gonic/gin"
@@ -10,14 +16,72 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var errStartAfterDue = errors.New("start_at must not be after due_at")
+
 type CreateToDoInput struct {
-	Title     string `json:"title" binding:"required"`
-	Completed bool   `json:"completed"`
+	Title      string               `json:"title" binding:"required"`
+	Notes      *string              `json:"notes"`
+	Completed  bool                 `json:"completed"`
+	Priority   *models.Priority     `json:"priority"`
+	ProjectID  *string              `json:"project_id"`
+	ParentID   *int                 `json:"parent_id"`
+	DueAt      *models.CalendarTime `json:"due_at"`
+	StartAt    *models.CalendarTime `json:"start_at"`
+	Recurrence *RecurrenceInput     `json:"recurrence"`
 }
 
 type UpdateTodoInput struct {
-	Title     *string `json: "title"`
-	Completed *bool   `json: "completed"`
+	Title      *string                              `json:"title"`
+	Notes      models.Nullable[string]              `json:"notes"`
+	Completed  *bool                                `json:"completed"`
+	Priority   *models.Priority                     `json:"priority"`
+	ProjectID  models.Nullable[string]              `json:"project_id"`
+	ParentID   models.Nullable[int]                 `json:"parent_id"`
+	DueAt      models.Nullable[models.CalendarTime] `json:"due_at"`
+	StartAt    models.Nullable[models.CalendarTime] `json:"start_at"`
+	Recurrence *RecurrenceInput                     `json:"recurrence"`
+}
+
+/*
+userLocation returns the time zone chosen by a user. An unknown zone name,
+which can only come from a time zone database older than the one used to
+validate it, falls back to UTC.
+*/
+func userLocation(pool *pgxpool.Pool, userID string) (*time.Location, error) {
+	user, err := repository.GetUserByID(pool, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(user.TimeZone)
+
+	if err != nil {
+		log.Printf("Unknown time zone %q of user %s, using UTC", user.TimeZone, userID)
+		return time.UTC, nil
+	}
+
+	return loc, nil
+}
+
+// validateSchedule checks that a todo does not start after it is due,
+// comparing whole days as the start of that day in the user's zone.
+func validateSchedule(pool *pgxpool.Pool, userID string, startAt *models.CalendarTime, dueAt *models.CalendarTime) error {
+	if startAt == nil || dueAt == nil {
+		return nil
+	}
+
+	loc, err := userLocation(pool, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if startAt.In(loc).After(dueAt.In(loc)) {
+		return errStartAfterDue
+	}
+
+	return nil
 }
 
 /*
@@ -29,11 +93,31 @@ This handler:
  3. Calls the repository layer to insert the ToDo into the database
  4. Returns the created ToDo with HTTP 201 status
 
+due_at and start_at are optional, and each is either a whole day
+("2026-03-29") or an RFC 3339 time ("2026-03-29T14:00:00+02:00").
+priority is "none" (the default), "low", "medium", "high" or "urgent".
+notes is optional Markdown of up to 20000 characters. Without project_id
+the todo goes to the Inbox. With parent_id it is a
+subtask of that todo; subtasks nest at most 3 levels deep.
+Tags are attached afterwards with PUT /todos/:id/tags/:tag_id.
+
+With a recurrence, a recurring series is created instead and the response
+is the todo of its first occurrence from today on. Each occurrence is due
+on its date; completing or skipping it creates the next one. dtstart
+without a time makes an all-day series. time_zone defaults to the user's.
+
 Authentication Required: YES
 
+Request body:
+  { "title": "Pay rent", "priority": "high", "due_at": "2026-11-01", "start_at": "2026-10-28T09:00:00+01:00" }
+  { "title": "Water plants", "recurrence": { "rrule": "FREQ=WEEKLY;BYDAY=MO,TH", "dtstart": "2026-10-19T09:00:00+02:00", "time_zone": "Europe/Berlin" } }
+
 Possible responses:
   201 Created       - ToDo successfully created
-  400 Bad Request   - Invalid JSON or missing required fields
+  400 Bad Request   - Invalid JSON, missing required fields, notes too
+                      long, invalid date or priority, unknown or archived project, unknown
+                      parent or too deep nesting, start_at after due_at,
+                      or invalid recurrence
   500 Internal Error - Database or server error
 */
 func CreateToDoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
@@ -53,9 +137,56 @@ func CreateToDoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		todo, err := repository.CreateTodo(pool, input.Title, input.Completed, UserID)
+		notes, err := normalizeNotes(input.Notes)
 
 		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		input.Notes = notes
+
+		if input.ProjectID != nil && !checkProject(c, pool, UserID, *input.ProjectID) {
+			return
+		}
+
+		if input.Recurrence != nil {
+			createSeries(c, pool, UserID, &input)
+			return
+		}
+
+		if err := validateSchedule(pool, UserID, input.StartAt, input.DueAt); err != nil {
+			if errors.Is(err, errStartAfterDue) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		todo := &models.ToDo{
+			Title:     input.Title,
+			Notes:     input.Notes,
+			Completed: input.Completed,
+			DueAt:     input.DueAt,
+			StartAt:   input.StartAt,
+			ProjectID: input.ProjectID,
+			ParentID:  input.ParentID,
+			UserID:    UserID,
+		}
+
+		if input.Priority != nil {
+			todo.Priority = *input.Priority
+		}
+
+		todo, err = repository.CreateTodo(pool, todo)
+
+		if err != nil {
+			if subtaskError(c, err) {
+				return
+			}
+
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -64,15 +195,126 @@ func CreateToDoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 	}
 }
 
+// maxSearchLength limits the q parameter of todo listings.
+const maxSearchLength = 200
+
+/*
+todoFilter reads the due, priority, tag and search filters of a todo
+listing from the query string. It answers 400 itself and returns false if the request
+must stop.
+*/
+func todoFilter(c *gin.Context, pool *pgxpool.Pool, userID string) (repository.TodoFilter, bool) {
+	filter := repository.TodoFilter{Due: c.Query("due")}
+
+	switch filter.Due {
+	case "":
+	case repository.DueOverdue, repository.DueToday, repository.DueUpcoming:
+		loc, err := userLocation(pool, userID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return filter, false
+		}
+
+		filter.Now = time.Now().In(loc)
+		filter.Today, filter.Tomorrow = models.DayBounds(filter.Now)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "due must be \"overdue\", \"today\" or \"upcoming\""})
+		return filter, false
+	}
+
+	if priorities := c.Query("priority"); priorities != "" {
+		for _, name := range strings.Split(priorities, ",") {
+			priority, err := models.ParsePriority(strings.TrimSpace(name))
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return filter, false
+			}
+
+			filter.Priorities = append(filter.Priorities, priority)
+		}
+	}
+
+	for _, tag := range c.QueryArray("tag") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+
+	filter.Search = strings.TrimSpace(c.Query("q"))
+
+	if len([]rune(filter.Search)) > maxSearchLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must be at most " + strconv.Itoa(maxSearchLength) + " characters"})
+		return filter, false
+	}
+
+	return filter, true
+}
+
+// notesAsHTML reads the notes_format query parameter of a todo read:
+// "markdown" (the default) or "html". It answers 400 itself and returns
+// false as its second value if the request must stop.
+func notesAsHTML(c *gin.Context) (bool, bool) {
+	switch c.DefaultQuery("notes_format", "markdown") {
+	case "markdown":
+		return false, true
+	case "html":
+		return true, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "notes_format must be \"markdown\" or \"html\""})
+		return false, false
+	}
+}
+
+// renderNotes fills in NotesHTML for todos that have notes.
+func renderNotes(todos []models.ToDo) error {
+	for i := range todos {
+		if todos[i].Notes == nil {
+			continue
+		}
+
+		html, err := markdown.HTML(*todos[i].Notes)
+
+		if err != nil {
+			return err
+		}
+
+		todos[i].NotesHTML = &html
+	}
+
+	return nil
+}
+
 /*
 GetAllTodosHandler retrieves all ToDos belonging to the authenticated user.
 
 This handler ensures users only see their own ToDos.
 
+The due filter works on the user's calendar, in the time zone set on their
+profile (PATCH /me), so "today" starts and ends at the user's midnight,
+also on days when daylight saving time begins or ends.
+
 Authentication Required: YES
 
+Query parameters (all optional):
+  due          - "overdue" (not completed and past due), "today" or
+                 "upcoming" (due after today)
+  priority     - Comma-separated priorities, e.g. "high,urgent"; todos
+                 with any of them are returned
+  tag          - Tag name, ignoring case; repeat it to return only todos
+                 that carry every given tag (?tag=work&tag=errands)
+  project      - "inbox" for the todos in no project, or a project ID
+  q            - Text to look for in the title and notes, ignoring case
+  notes_format - "markdown" (the default) returns the notes as written;
+                 "html" also returns them as sanitized HTML in notes_html
+
+Without project, the todos of archived projects are left out.
+
 Possible responses:
   200 OK            - Returns list of ToDos
+  400 Bad Request   - Unknown due filter, priority, project or notes
+                      format, or q too long
   500 Internal Error - Database or server error
 */
 func GetAllTodosHandler(pool *pgxpool.Pool) gin.HandlerFunc {
@@ -86,13 +328,41 @@ func GetAllTodosHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 
 		UserID := UserIDInterface.(string)
 
-		todos, err := repository.GetAllTodos(pool, UserID)
+		filter, ok := todoFilter(c, pool, UserID)
+
+		if !ok {
+			return
+		}
+
+		if project := c.Query("project"); project != "" {
+			if project != repository.ProjectInbox && !isUUID(project) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "project must be \"inbox\" or a project ID"})
+				return
+			}
+
+			filter.Project = project
+		}
+
+		asHTML, ok := notesAsHTML(c)
+
+		if !ok {
+			return
+		}
+
+		todos, err := repository.GetAllTodos(pool, UserID, filter)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		if asHTML {
+			if err := renderNotes(todos); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		c.JSON(http.StatusOK, todos)
 	}
 }
@@ -109,9 +379,12 @@ Authentication Required: YES
 URL Parameter:
   id (int) - ToDo ID
 
+Query parameters (all optional):
+  notes_format - "markdown" (the default) or "html", as for GET /todos
+
 Possible responses:
   200 OK           - Returns requested ToDo
-  400 Bad Request  - Invalid ID format
+  400 Bad Request  - Invalid ID format or notes format
   404 Not Found    - ToDo does not exist or does not belong to user
   500 Internal Error - Database error
 */
@@ -134,6 +407,12 @@ func GetTodoByIDHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
+		asHTML, ok := notesAsHTML(c)
+
+		if !ok {
+			return
+		}
+
 		todos, err := repository.GetTodoByID(pool, id, UserID)
 
 		if err != nil {
@@ -146,6 +425,17 @@ func GetTodoByIDHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
+		if asHTML {
+			rendered := []models.ToDo{*todos}
+
+			if err := renderNotes(rendered); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			todos = &rendered[0]
+		}
+
 		c.JSON(http.StatusOK, todos)
 	}
 }
@@ -154,10 +444,24 @@ func GetTodoByIDHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 
 // UpdateTodoHandler updates an existing ToDo.
 //
-// Supports partial updates:
-//   - Title only
-//   - Completed only
-//   - Both fields
+// Supports partial updates: only the fields sent are changed. due_at and
+// start_at are cleared by sending null, and so are notes: "notes": null
+// removes them while leaving notes out keeps them. A null project_id moves
+// the todo
+// to the Inbox, and a null parent_id makes a subtask a top-level todo.
+// A todo cannot become a subtask of itself or of one of its subtasks.
+//
+// When completed is set to true, ?subtasks=complete completes all the
+// subtasks too; the default, ?subtasks=keep, leaves them as they are.
+//
+// For an occurrence of a recurring series, the scope query parameter
+// chooses what the edit applies to:
+//   occurrence (default) - This occurrence only; completing it creates
+//                          the next occurrence
+//   series               - The whole series; only title and recurrence
+//                          can be sent. A new recurrence replaces the
+//                          open occurrence with the first one from today
+//                          on that has not been completed
 //
 // This handler:
 //   1. Validates user authentication
@@ -201,8 +505,37 @@ func UpdateTodoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		if input.Title == nil && input.Completed == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one field is required (title/completed)"})
+		scope := c.DefaultQuery("scope", scopeOccurrence)
+
+		if scope != scopeOccurrence && scope != scopeSeries {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be \"occurrence\" or \"series\""})
+			return
+		}
+
+		if input.Title == nil && !input.Notes.Set && input.Completed == nil && input.Priority == nil && !input.ProjectID.Set && !input.ParentID.Set && !input.DueAt.Set && !input.StartAt.Set && input.Recurrence == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one field is required (title/notes/completed/priority/project_id/parent_id/due_at/start_at/recurrence)"})
+			return
+		}
+
+		if input.Notes.Set {
+			notes, err := normalizeNotes(input.Notes.Value)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			input.Notes.Value = notes
+		}
+
+		withSubtasks, ok := completeSubtasksRequested(c)
+
+		if !ok {
+			return
+		}
+
+		if input.Recurrence != nil && scope != scopeSeries {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recurrence can only be changed with scope=series"})
 			return
 		}
 
@@ -218,24 +551,88 @@ func UpdateTodoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		title := existing.Title
+		if scope == scopeSeries {
+			updateSeries(c, pool, existing, &input)
+			return
+		}
+
+		wasCompleted := existing.Completed
 
 		if input.Title != nil {
-			title = *input.Title
+			existing.Title = *input.Title
+		}
+
+		if input.Notes.Set {
+			existing.Notes = input.Notes.Value
 		}
 
-		completed := existing.Completed
 		if input.Completed != nil {
-			completed = *input.Completed
+			existing.Completed = *input.Completed
+		}
+
+		if input.Priority != nil {
+			existing.Priority = *input.Priority
+		}
+
+		if input.ProjectID.Set {
+			if input.ProjectID.Value != nil && !checkProject(c, pool, UserID, *input.ProjectID.Value) {
+				return
+			}
+
+			existing.ProjectID = input.ProjectID.Value
 		}
 
-		todo, err := repository.UpdateTodo(pool, id, title, completed, UserID)
+		if input.ParentID.Set {
+			if input.ParentID.Value != nil && existing.SeriesID != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": errRecurringSubtask.Error()})
+				return
+			}
+
+			existing.ParentID = input.ParentID.Value
+		}
+
+		if input.DueAt.Set {
+			existing.DueAt = input.DueAt.Value
+		}
+
+		if input.StartAt.Set {
+			existing.StartAt = input.StartAt.Value
+		}
+
+		if err := validateSchedule(pool, UserID, existing.StartAt, existing.DueAt); err != nil {
+			if errors.Is(err, errStartAfterDue) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		todo, err := repository.UpdateTodo(pool, existing, withSubtasks && existing.Completed)
 
 		if err != nil {
+			if subtaskError(c, err) {
+				return
+			}
+
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
+		if input.DueAt.Set {
+			if err := repository.RescheduleReminders(pool, UserID, &todo.ID, time.Now()); err != nil {
+				log.Printf("Failed to reschedule reminders of todo %d: %v", todo.ID, err)
+			}
+		}
+
+		if todo.SeriesID != nil && todo.Completed && !wasCompleted {
+			if _, err := advanceSeries(pool, todo); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		c.JSON(http.StatusOK, todo)
 	}
 }
@@ -243,18 +640,33 @@ func UpdateTodoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 /*
 DeleteTodoHandler deletes a ToDo belonging to the authenticated user.
 
-Ensures users can only delete their own ToDos.
+Ensures users can only delete their own ToDos. Admins impersonating the
+user cannot delete anything.
+
+With scope=series, the recurring series of the todo is stopped: its open
+occurrences are deleted with their subtasks, and completed ones are kept
+as ordinary todos.
+
+The subtasks query parameter chooses what happens to the todo's subtasks:
+  promote (default) - They move up to the todo's level, under its parent
+                      or to the top level
+  delete            - They are deleted with the todo, at every level
 
 Authentication Required: YES
 
 Possible responses:
   200 OK
   400 Bad Request
+  403 Forbidden (impersonating)
   404 Not Found
   500 Internal Error
 */
 func DeleteTodoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if rejectWhileImpersonating(c) {
+			return
+		}
+
 		UserIDInterface, exists := c.Get("user_id")
 
 		if !exists {
@@ -264,23 +676,56 @@ func DeleteTodoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 
 		UserID := UserIDInterface.(string)
 
-		idString := c.Param("id")
-		id, err := strconv.Atoi(idString)
+		id, err := strconv.Atoi(c.Param("id"))
 
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid todo ID"})
 			return
 		}
 
-		err = repository.DeleteTodo(pool, id, UserID)
+		if c.Query("scope") == scopeSeries {
+			todo, err := repository.GetTodoByID(pool, id, UserID)
+
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					c.JSON(http.StatusNotFound, gin.H{"error": "ToDo not Found"})
+					return
+				}
+
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if todo.SeriesID == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": errNotRecurring.Error()})
+				return
+			}
+
+			if err := repository.DeleteTodoSeries(pool, *todo.SeriesID, UserID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"message": "Series successfully deleted"})
+			return
+		}
+
+		mode, ok := deleteSubtasksMode(c)
+
+		if !ok {
+			return
+		}
+
+		err = repository.DeleteTodo(pool, id, UserID, mode)
 
 		if err != nil {
-			if err.Error() == "ToDo with id: "+idString+" not found" {
+			if errors.Is(err, repository.ErrTodoNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": "ToDo not Found"})
 				return
 			}
 
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "ToDo successfully deleted"})
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"todos_api/internal/models"
+	"todos_api/internal/recurrence"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Values of the scope query parameter of PUT and DELETE /todos/:id.
+const (
+	scopeOccurrence = "occurrence"
+	scopeSeries     = "series"
+)
+
+// maxSkippedOccurrences bounds the search for an occurrence that has not
+// been completed yet, see firstOpenOccurrence.
+const maxSkippedOccurrences = 1000
+
+var errNotRecurring = errors.New("This todo is not part of a recurring series")
+
+// RecurrenceInput makes a todo recurring.
+type RecurrenceInput struct {
+	RRule    string               `json:"rrule" binding:"required"`
+	DTStart  *models.CalendarTime `json:"dtstart" binding:"required"`
+	TimeZone string               `json:"time_zone"`
+}
+
+/*
+parseRecurrence validates a recurrence and returns its rule and the
+series it describes. The time zone defaults to the user's.
+*/
+func parseRecurrence(pool *pgxpool.Pool, userID string, title string, input *RecurrenceInput) (*recurrence.Rule, *models.TodoSeries, error) {
+	timeZone := input.TimeZone
+
+	if timeZone == "" {
+		user, err := repository.GetUserByID(pool, userID)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		timeZone = user.TimeZone
+	}
+
+	rule, err := recurrence.Parse(input.RRule, *input.DTStart, timeZone)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rule, &models.TodoSeries{
+		UserID:   userID,
+		Title:    title,
+		RRule:    rule.String(),
+		DTStart:  *input.DTStart,
+		TimeZone: timeZone,
+	}, nil
+}
+
+// seriesRule parses the stored rule of a series.
+func seriesRule(series *models.TodoSeries) (*recurrence.Rule, error) {
+	return recurrence.Parse(series.RRule, series.DTStart, series.TimeZone)
+}
+
+/*
+firstOpenOccurrence returns the first occurrence from today on that has
+not been completed yet, nil if the rule has none.
+*/
+func firstOpenOccurrence(rule *recurrence.Rule, completed map[string]bool) *models.CalendarTime {
+	occurrence := rule.FirstFrom(time.Now())
+
+	for i := 0; occurrence != nil && completed[occurrence.String()]; i++ {
+		if i == maxSkippedOccurrences {
+			return nil
+		}
+
+		occurrence = rule.After(*occurrence)
+	}
+
+	return occurrence
+}
+
+/*
+advanceSeries creates the occurrence that follows todo once it has been
+completed or is about to be skipped. It returns the new occurrence, or
+nil if todo is not the latest occurrence or the series has ended.
+*/
+func advanceSeries(pool *pgxpool.Pool, todo *models.ToDo) (*models.ToDo, error) {
+	if todo.SeriesID == nil || todo.RecurrenceID == nil {
+		return nil, errNotRecurring
+	}
+
+	series, err := repository.GetTodoSeries(pool, *todo.SeriesID, todo.UserID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rule, err := seriesRule(series)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.CreateNextOccurrence(pool, series, todo, rule.After(*todo.RecurrenceID))
+}
+
+// getTodoForSeries loads the todo of a series route and answers 400 or
+// 404 itself. It returns false if the request must stop.
+func getTodoForSeries(c *gin.Context, pool *pgxpool.Pool, userID string) (*models.ToDo, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid todo ID"})
+		return nil, false
+	}
+
+	todo, err := repository.GetTodoByID(pool, id, userID)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ToDo not Found"})
+			return nil, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return todo, true
+}
+
+// createSeries handles POST /todos with a recurrence: it stores the
+// series and answers with the todo of its first occurrence.
+func createSeries(c *gin.Context, pool *pgxpool.Pool, userID string, input *CreateToDoInput) {
+	if input.DueAt != nil || input.StartAt != nil || input.Completed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The dates of a recurring todo come from its recurrence; due_at, start_at and completed cannot be set"})
+		return
+	}
+
+	if input.ParentID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errRecurringSubtask.Error()})
+		return
+	}
+
+	rule, series, err := parseRecurrence(pool, userID, input.Title, input.Recurrence)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	first := rule.FirstFrom(time.Now())
+
+	if first == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The recurrence has no occurrences from today on"})
+		return
+	}
+
+	template := &models.ToDo{Notes: input.Notes, ProjectID: input.ProjectID}
+
+	if input.Priority != nil {
+		template.Priority = *input.Priority
+	}
+
+	todo, err := repository.CreateTodoSeries(pool, series, first, template)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, todo)
+}
+
+// updateSeries handles PUT /todos/:id?scope=series: the title and the
+// recurrence apply to the whole series.
+func updateSeries(c *gin.Context, pool *pgxpool.Pool, todo *models.ToDo, input *UpdateTodoInput) {
+	if todo.SeriesID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errNotRecurring.Error()})
+		return
+	}
+
+	if input.Notes.Set || input.Completed != nil || input.Priority != nil || input.ProjectID.Set || input.ParentID.Set || input.DueAt.Set || input.StartAt.Set {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only title and recurrence can be changed for a whole series"})
+		return
+	}
+
+	series, err := repository.GetTodoSeries(pool, *todo.SeriesID, todo.UserID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Title != nil {
+		series.Title = *input.Title
+	}
+
+	if input.Recurrence == nil {
+		if err := repository.UpdateTodoSeriesTitle(pool, series.ID, series.UserID, series.Title); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		updated, err := repository.GetTodoByID(pool, todo.ID, todo.UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+		return
+	}
+
+	rule, changed, err := parseRecurrence(pool, todo.UserID, series.Title, input.Recurrence)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changed.ID = series.ID
+
+	completed, err := repository.GetCompletedRecurrenceIDs(pool, series.ID)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	open, err := repository.UpdateTodoSeries(pool, changed, firstOpenOccurrence(rule, completed))
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if open == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "The recurrence has no further occurrences, the series has ended"})
+		return
+	}
+
+	if err := repository.RescheduleReminders(pool, open.UserID, &open.ID, time.Now()); err != nil {
+		log.Printf("Failed to reschedule reminders of todo %d: %v", open.ID, err)
+	}
+
+	c.JSON(http.StatusOK, open)
+}
+
+/*
+GetTodoSeriesHandler returns the recurring series a todo belongs to.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (int) - Todo ID
+
+Possible responses:
+  200 OK             - Returns the series
+  400 Bad Request    - Invalid ID format, or the todo is not recurring
+  404 Not Found      - Todo does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func GetTodoSeriesHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		todo, ok := getTodoForSeries(c, pool, UserID)
+
+		if !ok {
+			return
+		}
+
+		if todo.SeriesID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errNotRecurring.Error()})
+			return
+		}
+
+		series, err := repository.GetTodoSeries(pool, *todo.SeriesID, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, series)
+	}
+}
+
+/*
+CompleteTodoHandler completes a todo. For an occurrence of a recurring
+series, the next occurrence is created, the same as when completed is set
+through PUT /todos/:id.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (int) - Todo ID
+
+Query parameters (all optional):
+  subtasks - "complete" to complete all the subtasks too, or "keep" (the
+             default) to leave them as they are
+
+Possible responses:
+  200 OK             - Returns { "todo": completed todo, "next": next
+                       occurrence or null }
+  400 Bad Request    - Invalid ID format or subtasks parameter
+  404 Not Found      - Todo does not exist or belongs to someone else
+  500 Internal Error - Database error
+*/
+func CompleteTodoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		withSubtasks, ok := completeSubtasksRequested(c)
+
+		if !ok {
+			return
+		}
+
+		todo, ok := getTodoForSeries(c, pool, UserID)
+
+		if !ok {
+			return
+		}
+
+		if !todo.Completed || withSubtasks {
+			todo.Completed = true
+
+			updated, err := repository.UpdateTodo(pool, todo, withSubtasks)
+
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			todo = updated
+		}
+
+		var next *models.ToDo
+
+		if todo.SeriesID != nil {
+			var err error
+
+			next, err = advanceSeries(pool, todo)
+
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"todo": todo, "next": next})
+	}
+}
+
+/*
+SkipTodoHandler skips an occurrence of a recurring series: the occurrence
+is deleted without being completed, together with its subtasks, and the
+next one is created. Admins impersonating the user cannot skip
+occurrences.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (int) - Todo ID
+
+Possible responses:
+  200 OK             - Returns { "next": next occurrence or null }
+  400 Bad Request    - Invalid ID format, or the todo is not recurring
+  403 Forbidden      - The caller is impersonating the user
+  404 Not Found      - Todo does not exist or belongs to someone else
+  409 Conflict       - The occurrence is already completed
+  500 Internal Error - Database error
+*/
+func SkipTodoHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectWhileImpersonating(c) {
+			return
+		}
+
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		todo, ok := getTodoForSeries(c, pool, UserID)
+
+		if !ok {
+			return
+		}
+
+		if todo.SeriesID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errNotRecurring.Error()})
+			return
+		}
+
+		if todo.Completed {
+			c.JSON(http.StatusConflict, gin.H{"error": "A completed occurrence cannot be skipped"})
+			return
+		}
+
+		// The next occurrence is created first so that it can take over
+		// the reminders of the skipped one.
+		next, err := advanceSeries(pool, todo)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := repository.DeleteTodo(pool, todo.ID, UserID, repository.DeleteSubtasks); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"next": next})
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"todos_api/internal/auth"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxPersonalAccessTokenName matches the VARCHAR size of the name column.
+const maxPersonalAccessTokenName = 100
+
+type CreateTokenInput struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type CreateTokenResponse struct {
+	models.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+/*
+CreateTokenHandler mints a personal access token for the authenticated user.
+
+Personal access tokens are meant for scripts and integrations. They can be
+used anywhere a JWT is accepted, are limited to the requested scopes and
+may carry an expiry. The raw token is only returned in this response.
+
+Authentication Required: YES
+
+Request body:
+  {
+    "name": "CI",
+    "scopes": ["todos:read"],
+    "expires_at": "2027-01-01T00:00:00Z"   (optional)
+  }
+
+Possible responses:
+  201 Created       - Returns the token metadata plus "token"
+  400 Bad Request   - Missing name, unknown scope or expiry in the past
+  500 Internal Error - Database error
+*/
+func CreateTokenHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		var input CreateTokenInput
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		input.Name = strings.TrimSpace(input.Name)
+
+		if input.Name == "" || len(input.Name) > maxPersonalAccessTokenName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 100 characters"})
+			return
+		}
+
+		if len(input.Scopes) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+			return
+		}
+
+		for _, scope := range input.Scopes {
+			if !auth.IsValidScope(scope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+				return
+			}
+		}
+
+		if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+
+		rawToken, prefix, tokenHash, err := auth.GeneratePersonalAccessToken()
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		token, err := repository.CreatePersonalAccessToken(pool, &models.PersonalAccessToken{
+			UserID:      UserID,
+			Name:        input.Name,
+			TokenPrefix: prefix,
+			TokenHash:   tokenHash,
+			Scopes:      input.Scopes,
+			ExpiresAt:   input.ExpiresAt,
+		})
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, CreateTokenResponse{PersonalAccessToken: *token, Token: rawToken})
+	}
+}
+
+/*
+GetTokensHandler lists the authenticated user's personal access tokens.
+
+Only metadata is returned (name, prefix, scopes, expiry, last use); the
+tokens themselves cannot be recovered.
+
+Authentication Required: YES
+
+Possible responses:
+  200 OK            - Returns list of tokens
+  500 Internal Error - Database error
+*/
+func GetTokensHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		tokens, err := repository.GetPersonalAccessTokens(pool, UserID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+/*
+RevokeTokenHandler revokes one of the authenticated user's personal
+access tokens. The token stops working immediately.
+
+Authentication Required: YES
+
+URL Parameter:
+  id (uuid) - Token ID
+
+Possible responses:
+  200 OK            - Token revoked
+  400 Bad Request   - Invalid ID format
+  404 Not Found     - Token does not exist or does not belong to user
+  500 Internal Error - Database error
+*/
+func RevokeTokenHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		UserIDInterface, exists := c.Get("user_id")
+
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user_id does not exist"})
+			return
+		}
+
+		UserID := UserIDInterface.(string)
+
+		id := c.Param("id")
+
+		if !isUUID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+			return
+		}
+
+		err := repository.RevokePersonalAccessToken(pool, id, UserID)
+
+		if err != nil {
+			if err.Error() == "Token with id: "+id+" not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Token successfully revoked"})
+	}
+}
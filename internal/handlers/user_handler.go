@@ -1,17 +1,19 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
+	"todos_api/internal/auth"
 	"todos_api/internal/config"
+	"todos_api/internal/mail"
 	"todos_api/internal/models"
 	"todos_api/internal/repository"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type RegisterRequest struct {
@@ -20,15 +22,20 @@ type RegisterRequest struct {
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Email    string   `json:"email" binding:"required"`
+	Password string   `json:"password" binding:"required"`
+	Scopes   []string `json:"scopes"`
+	Session  bool     `json:"session"`
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
 }
 
-func CreateUserHandler(pool *pgxpool.Pool) gin.HandlerFunc {
+func CreateUserHandler(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer, hasher auth.PasswordHasher, policy *auth.PasswordPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var registerRequest RegisterRequest
 
@@ -37,12 +44,19 @@ func CreateUserHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
-		if len(registerRequest.Password) < 6 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 6 characters long"})
+		email, err := normalizeEmail(registerRequest.Email)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := policy.Check(registerRequest.Password, email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(registerRequest.Password), bcrypt.DefaultCost)
+		hashedPassword, err := hasher.Hash(registerRequest.Password)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
@@ -50,8 +64,8 @@ func CreateUserHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 		}
 
 		user := &models.User{
-			Email:    registerRequest.Email,
-			Password: string(hashedPassword),
+			Email:    email,
+			Password: hashedPassword,
 		}
 
 		createdUser, err := repository.CreateUser(pool, user)
@@ -68,49 +82,221 @@ func CreateUserHandler(pool *pgxpool.Pool) gin.HandlerFunc {
 			return
 		}
 
+		go sendVerificationEmail(pool, cfg, mailer, createdUser.ID, createdUser.Email)
+
 		c.JSON(http.StatusCreated, createdUser)
 	}
 }
 
-func LoginHandler(pool *pgxpool.Pool, cfg *config.Config) gin.HandlerFunc {
+/*
+LoginHandler authenticates a user by email and password.
+
+Failed attempts are throttled per email address and per client IP:
+after a few failures each further one adds an exponentially growing
+delay, and too many failures lock the address out for a while. Whether
+the email belongs to an account does not change the response, its
+timing or the throttling.
+
+After a successful password check, a hash made with an older algorithm
+or weaker parameters is replaced with one from the current hasher.
+
+Browser clients can set "session" to receive the tokens as HttpOnly
+cookies instead of in the body (only when SESSION_COOKIES is enabled).
+The response then carries the CSRF token to send in the X-CSRF-Token
+header of state-changing requests.
+
+Authentication Required: NO
+
+Request body:
+  { "email": "user@example.com", "password": "...", "scopes": ["todos:read"], "session": false }
+
+Possible responses:
+  200 OK                - Returns a token pair, a cookie session, or an MFA challenge
+  400 Bad Request       - Missing fields, unknown scope or sessions disabled
+  401 Unauthorized      - Invalid email or password
+  403 Forbidden         - Account disabled, deleted or password reset required
+  429 Too Many Requests - Too many failed attempts, see Retry-After header
+  500 Internal Error    - Database or signing error
+*/
+func LoginHandler(pool *pgxpool.Pool, cfg *config.Config, keys *auth.KeySet, throttle *auth.LoginThrottle, hasher auth.PasswordHasher, csrf *auth.CSRFProtector) gin.HandlerFunc {
+	// dummyPasswordHash is verified against when the email is unknown, so
+	// that case costs as much as a wrong password.
+	dummyPasswordHash, err := hasher.Hash("not-a-real-password")
+
+	if err != nil {
+		panic(err)
+	}
+
 	return func(c *gin.Context) {
 		var loginRequest LoginRequest
 
-		if err := c.BindJSON(&loginRequest); err != nil {
+		if err := c.ShouldBindJSON(&loginRequest); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		user, err := repository.GetUserByEmail(pool, loginRequest.Email)
+		scopes, err := auth.ResolveScopes(loginRequest.Scopes)
 
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if rejectSessionUnavailable(c, csrf, loginRequest.Session) {
+			return
+		}
+
+		accountKey := auth.AccountThrottleKey(loginRequest.Email)
+		ip := c.ClientIP()
+
+		attempt, ok := reserveLoginAttempt(c, throttle, accountKey, auth.IPThrottleKey(ip))
+
+		if !ok {
 			return
 		}
 
-		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginRequest.Password))
+		user, err := repository.GetUserByEmail(pool, strings.TrimSpace(loginRequest.Email))
 
 		if err != nil {
+			// Spend the same time as a wrong password so response timing
+			// does not reveal whether the email is registered.
+			hasher.Verify(loginRequest.Password, dummyPasswordHash)
+			recordLoginFailure(attempt, nil, ip)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
 		}
 
-		claims := jwt.MapClaims{
-			"user_id": user.ID,
-			"email":   user.Email,
-			"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		if !verifyPassword(hasher, user, loginRequest.Password) {
+			recordLoginFailure(attempt, &user.ID, ip)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
+
+		rehashPassword(pool, hasher, user, loginRequest.Password)
+
+		if err := attempt.Success(); err != nil {
+			log.Printf("Failed to clear login throttle: %v", err)
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		if rejectInactiveAccount(c, user) {
+			return
+		}
 
-		tokenString, err := token.SignedString([]byte(cfg.JWTSecret))
+		challenge, err := mfaChallenge(pool, keys, user, scopes)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if challenge != nil {
+			c.JSON(http.StatusOK, challenge)
+			return
+		}
+
+		response, err := issueTokenPair(c, pool, cfg, keys, user, scopes)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token: " + err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, LoginResponse{Token: tokenString})
+		respondWithTokens(c, cfg, csrf, user, response, loginRequest.Session)
+	}
+}
+
+// verifyPassword checks a password against the user's stored hash. A
+// hash that cannot be parsed is logged and treated as a mismatch.
+func verifyPassword(hasher auth.PasswordHasher, user *models.User, password string) bool {
+	ok, err := hasher.Verify(password, user.Password)
+
+	if err != nil {
+		log.Printf("Failed to verify password of user %s: %v", user.ID, err)
+		return false
 	}
+
+	return ok
+}
+
+// rehashPassword upgrades the user's password hash to the current
+// algorithm and parameters if needed. Failures are only logged: the old
+// hash keeps working and the upgrade is retried on the next login.
+func rehashPassword(pool *pgxpool.Pool, hasher auth.PasswordHasher, user *models.User, password string) {
+	if !hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	newHash, err := hasher.Hash(password)
+
+	if err != nil {
+		log.Printf("Failed to rehash password of user %s: %v", user.ID, err)
+		return
+	}
+
+	if _, err := repository.RehashPassword(pool, user.ID, user.Password, newHash); err != nil {
+		log.Printf("Failed to store rehashed password of user %s: %v", user.ID, err)
+		return
+	}
+
+	user.Password = newHash
+}
+
+/*
+reserveLoginAttempt counts a credential check against the throttle keys
+before it is made. If any key is blocked or out of attempts it answers
+429 with a Retry-After header and returns false. Errors fail closed.
+*/
+func reserveLoginAttempt(c *gin.Context, throttle *auth.LoginThrottle, keys ...string) (*auth.LoginAttempt, bool) {
+	attempt, retryAfter, err := throttle.Reserve(keys...)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to check login attempts"})
+		return nil, false
+	}
+
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, please try again later"})
+		return nil, false
+	}
+
+	return attempt, true
+}
+
+// recordLoginFailure records that the credentials of an attempt were
+// wrong. Errors are only logged: the attempt has failed either way.
+func recordLoginFailure(attempt *auth.LoginAttempt, userID *string, ip string) {
+	if err := attempt.Failure(userID, ip); err != nil {
+		log.Printf("Failed to record failed login from %s: %v", ip, err)
+	}
+}
+
+/*
+rejectInactiveAccount stops users who may not sign in from getting new
+tokens: disabled accounts, accounts scheduled for deletion, and accounts
+an admin has flagged for a password reset. It writes the 403 response and returns true if the
+request must stop.
+
+It is checked only after the password (or refresh token) was verified, so
+it does not reveal account state to someone who merely knows an email.
+*/
+func rejectInactiveAccount(c *gin.Context, user *models.User) bool {
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return true
+	}
+
+	if user.DeletedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is scheduled for deletion"})
+		return true
+	}
+
+	if user.PasswordResetRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required, check your email for a reset link"})
+		return true
+	}
+
+	return false
 }
 
 func TestProtectedHandler() gin.HandlerFunc {
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isUUID reports whether s is a canonical UUID, so malformed path
+// parameters can be rejected before they reach a UUID column.
+func isUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// maxEmailLength is the longest address accepted, per RFC 5321 path limits.
+const maxEmailLength = 254
+
+/*
+normalizeEmail validates an email address and returns it in the canonical
+form stored in the database: trimmed and lowercased.
+
+Only a bare address is accepted ("user@example.com"); display names such
+as "User <user@example.com>" are rejected.
+*/
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if email == "" || len(email) > maxEmailLength {
+		return "", errors.New("Invalid email address")
+	}
+
+	address, err := mail.ParseAddress(email)
+
+	if err != nil || address.Address != email {
+		return "", errors.New("Invalid email address")
+	}
+
+	at := strings.LastIndex(email, "@")
+	domain := email[at+1:]
+
+	if at < 1 || !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", errors.New("Invalid email address")
+	}
+
+	return email, nil
+}
+
+// Page size bounds for paginated list endpoints.
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+/*
+parsePagination reads the "page" (1-based) and "per_page" query
+parameters, applying defaults and bounds.
+
+Returns:
+  int   - Page number
+  int   - Page size
+  error - If either parameter is not a positive integer
+*/
+func parsePagination(c *gin.Context) (int, int, error) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+
+	if err != nil || page < 1 {
+		return 0, 0, errors.New("page must be a positive integer")
+	}
+
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(defaultPerPage)))
+
+	if err != nil || perPage < 1 {
+		return 0, 0, errors.New("per_page must be a positive integer")
+	}
+
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+
+	return page, perPage, nil
+}
+
+// maxNotesLength matches the length check on todos.notes.
+const maxNotesLength = 20000
+
+/*
+normalizeNotes checks the Markdown notes of a todo. Empty or blank notes
+are stored as no notes, so there is only one way for a todo to have none.
+*/
+func normalizeNotes(notes *string) (*string, error) {
+	if notes == nil || strings.TrimSpace(*notes) == "" {
+		return nil, nil
+	}
+
+	if len([]rune(*notes)) > maxNotesLength {
+		return nil, errors.New("notes must be at most " + strconv.Itoa(maxNotesLength) + " characters")
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+	"todos_api/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+RunAccountPurge permanently deletes accounts whose deletion grace period
+has passed, on every tick of the given interval until ctx is cancelled.
+
+Deleting the user row removes their todos and every other row that
+references it through ON DELETE CASCADE.
+
+Parameters:
+  ctx         - Stops the loop when cancelled
+  pool        - PostgreSQL connection pool
+  gracePeriod - How long a deleted account is kept
+  interval    - Time between two purges
+*/
+func RunAccountPurge(ctx context.Context, pool *pgxpool.Pool, gracePeriod time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			purged, err := repository.PurgeDeletedUsers(pool, time.Now().Add(-gracePeriod))
+
+			if err != nil {
+				log.Printf("Failed to purge deleted accounts: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d deleted accounts", purged)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
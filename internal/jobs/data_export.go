@@ -0,0 +1,509 @@
+package jobs
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"todos_api/internal/config"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// exportTimeout bounds the time spent building one archive.
+	exportTimeout = 30 * time.Minute
+
+	// exportStaleAfter is how long an export may stay "running" before it
+	// is assumed to belong to a crashed worker and is claimed again.
+	exportStaleAfter = time.Hour
+
+	// maxExportLockoutEvents caps the lockout history in an export.
+	maxExportLockoutEvents = 10000
+
+	// maxExportNotifications caps the in-app notifications in an export.
+	maxExportNotifications = 10000
+)
+
+/*
+exportSection is one file in an export archive.
+
+write streams the file's content to w; sections that can be large must
+not collect their rows in memory first. New kinds of user data are
+exported by adding a section to exportSections.
+*/
+type exportSection struct {
+	name  string
+	write func(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error
+}
+
+var exportSections = []exportSection{
+	{name: "profile.json", write: writeProfileJSON},
+	{name: "todos.json", write: writeTodosJSON},
+	{name: "todos.csv", write: writeTodosCSV},
+	{name: "todo_series.json", write: writeTodoSeriesJSON},
+	{name: "tags.json", write: writeTagsJSON},
+	{name: "projects.json", write: writeProjectsJSON},
+	{name: "personal_access_tokens.json", write: writePersonalAccessTokensJSON},
+	{name: "identities.json", write: writeIdentitiesJSON},
+	{name: "sessions.json", write: writeSessionsJSON},
+	{name: "lockout_events.json", write: writeLockoutEventsJSON},
+	{name: "reminders.json", write: writeRemindersJSON},
+	{name: "notifications.json", write: writeNotificationsJSON},
+}
+
+/*
+ExportWorker builds account data exports in the background.
+
+Exports are queued in the data_exports table, so requests made on any
+replica are picked up by whichever worker claims them first. Enqueue
+wakes the local worker right away; otherwise pending exports are picked
+up on the next tick.
+*/
+type ExportWorker struct {
+	pool *pgxpool.Pool
+	dir  string
+	ttl  time.Duration
+	wake chan struct{}
+}
+
+func NewExportWorker(pool *pgxpool.Pool, cfg *config.Config) *ExportWorker {
+	return &ExportWorker{
+		pool: pool,
+		dir:  cfg.ExportDir,
+		ttl:  cfg.ExportTTL,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Enqueue tells the worker that a new export is waiting. It never blocks.
+func (w *ExportWorker) Enqueue() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+/*
+Run processes pending exports and deletes expired archives until ctx is
+cancelled.
+
+Parameters:
+  ctx      - Stops the loop when cancelled
+  interval - Time between two checks for pending or expired exports
+*/
+func (w *ExportWorker) Run(ctx context.Context, interval time.Duration) {
+	if err := os.MkdirAll(w.dir, 0o700); err != nil {
+		log.Printf("Failed to create export directory %s: %v", w.dir, err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		w.processPending(ctx)
+
+		select {
+		case <-ticker.C:
+			w.deleteExpired()
+		case <-w.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// processPending builds exports until none are waiting.
+func (w *ExportWorker) processPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		export, err := repository.ClaimDataExport(w.pool, time.Now().Add(-exportStaleAfter))
+
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				log.Printf("Failed to claim data export: %v", err)
+			}
+
+			return
+		}
+
+		if err := w.build(ctx, export); err != nil {
+			log.Printf("Data export %s failed: %v", export.ID, err)
+
+			if err := repository.FailDataExport(w.pool, export.ID, "The export could not be created, please try again"); err != nil {
+				log.Printf("Failed to mark data export %s as failed: %v", export.ID, err)
+			}
+		}
+	}
+}
+
+/*
+build writes the archive for one export and marks it completed.
+
+The archive is written to a temporary file and renamed once complete, so
+a crash never leaves a truncated archive behind under the final name.
+*/
+func (w *ExportWorker) build(ctx context.Context, export *models.DataExport) error {
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	user, err := repository.GetUserByID(w.pool, export.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(w.dir, export.ID+"-*.zip.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	archive := zip.NewWriter(tmp)
+
+	for _, section := range exportSections {
+		file, err := archive.Create(section.name)
+
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+
+		if err := section.write(ctx, w.pool, user, file); err != nil {
+			tmp.Close()
+			return fmt.Errorf("%s: %w", section.name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	info, err := tmp.Stat()
+
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(w.dir, export.ID+".zip")
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	if err := repository.CompleteDataExport(w.pool, export.ID, path, info.Size(), time.Now().Add(w.ttl)); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	log.Printf("Data export %s completed (%d bytes)", export.ID, info.Size())
+
+	return nil
+}
+
+/*
+deleteExpired removes archives whose download link has expired.
+
+Besides the files of exports marked expired, any archive older than the
+export TTL is removed: rows of purged accounts disappear with the account,
+and their files must not outlive them.
+*/
+func (w *ExportWorker) deleteExpired() {
+	paths, err := repository.ExpireDataExports(w.pool)
+
+	if err != nil {
+		log.Printf("Failed to expire data exports: %v", err)
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete export %s: %v", path, err)
+		}
+	}
+
+	entries, err := os.ReadDir(w.dir)
+
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-w.ttl - exportStaleAfter)
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(w.dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete export %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
+
+// writeProfileJSON writes the account. The password hash is never
+// serialized (models.User hides it).
+func writeProfileJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	totp, err := repository.GetTOTP(pool, user.ID)
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	return writeJSON(w, struct {
+		*models.User
+		TwoFactorEnabled bool `json:"two_factor_enabled"`
+	}{
+		User:             user,
+		TwoFactorEnabled: totp != nil && totp.ConfirmedAt != nil,
+	})
+}
+
+// writeTodosJSON streams the todos as a JSON array, one todo at a time.
+func writeTodosJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+
+	err := repository.StreamTodos(ctx, pool, user.ID, func(todo *models.ToDo) error {
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+
+		first = false
+
+		data, err := json.Marshal(todo)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(append([]byte("\n  "), data...))
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n]\n")
+
+	return err
+}
+
+// writeTodosCSV streams the todos as CSV with a header row.
+func writeTodosCSV(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"id", "title", "notes", "completed", "priority", "tags", "project_id", "parent_id", "due_at", "start_at", "created_at", "updated_at"}); err != nil {
+		return err
+	}
+
+	err := repository.StreamTodos(ctx, pool, user.ID, func(todo *models.ToDo) error {
+		return writer.Write([]string{
+			strconv.Itoa(todo.ID),
+			sanitizeCSVCell(todo.Title),
+			sanitizeCSVCell(stringCell(todo.Notes)),
+			strconv.FormatBool(todo.Completed),
+			todo.Priority.String(),
+			sanitizeCSVCell(tagNamesCell(todo.Tags)),
+			stringCell(todo.ProjectID),
+			intCell(todo.ParentID),
+			calendarTimeCell(todo.DueAt),
+			calendarTimeCell(todo.StartAt),
+			todo.CreatedAt.Format(time.RFC3339),
+			todo.UpdatedAt.Format(time.RFC3339),
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// writeTodoSeriesJSON writes the user's recurring series.
+func writeTodoSeriesJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	series, err := repository.GetTodoSeriesForUser(pool, user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, series)
+}
+
+// writeTagsJSON writes the user's tags.
+func writeTagsJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	tags, err := repository.GetTags(pool, user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, tags)
+}
+
+// writeProjectsJSON writes the user's projects, archived ones included.
+func writeProjectsJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	projects, err := repository.GetProjects(pool, user.ID, true)
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, projects)
+}
+
+// tagNamesCell lists the tags of a todo for the CSV export.
+func tagNamesCell(tags []models.TodoTag) string {
+	var names []string
+
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// sanitizeCSVCell stops spreadsheet applications from evaluating
+// user-supplied text as a formula.
+func sanitizeCSVCell(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+
+	return value
+}
+
+// writePersonalAccessTokensJSON writes the user's personal access tokens.
+// Token hashes are never serialized.
+func writePersonalAccessTokensJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	tokens, err := repository.GetPersonalAccessTokens(pool, user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, tokens)
+}
+
+// writeIdentitiesJSON writes the identity provider accounts linked to the
+// user.
+func writeIdentitiesJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	identities, err := repository.GetUserIdentities(pool, user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, identities)
+}
+
+// writeSessionsJSON writes the devices the user is logged in on.
+func writeSessionsJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	sessions, err := repository.GetActiveSessions(pool, user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, sessions)
+}
+
+// writeLockoutEventsJSON writes the login lockouts of the account.
+func writeLockoutEventsJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	events, err := repository.GetLockoutEvents(pool, user.ID, maxExportLockoutEvents)
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, events)
+}
+
+// writeRemindersJSON writes the reminders set on the user's todos.
+func writeRemindersJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	reminders, err := repository.GetRemindersForUser(pool, user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, reminders)
+}
+
+// writeNotificationsJSON writes the user's most recent in-app
+// notifications.
+func writeNotificationsJSON(ctx context.Context, pool *pgxpool.Pool, user *models.User, w io.Writer) error {
+	notifications, err := repository.GetNotifications(pool, user.ID, false, maxExportNotifications, 0)
+
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, notifications)
+}
+
+// calendarTimeCell formats an optional date for the CSV export.
+func calendarTimeCell(t *models.CalendarTime) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.String()
+}
+
+// stringCell formats an optional value for the CSV export.
+func stringCell(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+// intCell formats an optional number for the CSV export.
+func intCell(value *int) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*value)
+}
@@ -0,0 +1,210 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"todos_api/internal/models"
+	"todos_api/internal/notify"
+	"todos_api/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// reminderBatchSize is how many reminders are claimed and delivered
+	// at once.
+	reminderBatchSize = 20
+
+	// reminderDeliveryTimeout bounds the delivery of one reminder.
+	reminderDeliveryTimeout = 30 * time.Second
+
+	// reminderClaimTTL is how long a claimed reminder may stay undelivered
+	// before it is assumed to belong to a crashed scheduler and is claimed
+	// again. It must exceed reminderDeliveryTimeout.
+	reminderClaimTTL = 5 * time.Minute
+
+	// maxReminderAttempts is how often a reminder is tried before it is
+	// marked failed.
+	maxReminderAttempts = 5
+
+	// reminderRetryBackoff is the wait after the first failed attempt; it
+	// doubles with each further attempt, up to maxReminderRetryBackoff.
+	reminderRetryBackoff    = time.Minute
+	maxReminderRetryBackoff = time.Hour
+)
+
+/*
+ReminderScheduler sends reminders whose time has come.
+
+Every API process runs one. Reminders are claimed from the database with
+FOR UPDATE SKIP LOCKED, so the schedulers of several replicas share the
+work and each reminder is delivered by only one of them. Failed
+deliveries are retried with exponential backoff.
+
+All times come from the Clock, so a FakeClock can drive Tick without
+waiting.
+*/
+type ReminderScheduler struct {
+	store    reminderStore
+	clock    Clock
+	channels notify.Channels
+}
+
+func NewReminderScheduler(pool *pgxpool.Pool, clock Clock, channels notify.Channels) *ReminderScheduler {
+	return &ReminderScheduler{store: poolReminderStore{pool}, clock: clock, channels: channels}
+}
+
+// reminderStore is the queue of due reminders. A claimed reminder is
+// left alone by other schedulers until it is completed, rescheduled for
+// a retry or failed for good, or until its claim goes stale.
+type reminderStore interface {
+	ClaimDueReminders(now time.Time, staleBefore time.Time, limit int) ([]models.DueReminder, error)
+	CompleteReminder(id string, firedAt time.Time, now time.Time) error
+	RetryReminder(id string, retryAt time.Time, message string) error
+	FailReminder(id string, message string, now time.Time) error
+}
+
+type poolReminderStore struct {
+	pool *pgxpool.Pool
+}
+
+func (s poolReminderStore) ClaimDueReminders(now time.Time, staleBefore time.Time, limit int) ([]models.DueReminder, error) {
+	return repository.ClaimDueReminders(s.pool, now, staleBefore, limit)
+}
+
+func (s poolReminderStore) CompleteReminder(id string, firedAt time.Time, now time.Time) error {
+	return repository.CompleteReminder(s.pool, id, firedAt, now)
+}
+
+func (s poolReminderStore) RetryReminder(id string, retryAt time.Time, message string) error {
+	return repository.RetryReminder(s.pool, id, retryAt, message)
+}
+
+func (s poolReminderStore) FailReminder(id string, message string, now time.Time) error {
+	return repository.FailReminder(s.pool, id, message, now)
+}
+
+/*
+Run sends due reminders on every tick of the given interval until ctx is
+cancelled.
+
+Parameters:
+  ctx      - Stops the loop when cancelled
+  interval - Time between two checks for due reminders
+*/
+func (s *ReminderScheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Tick(ctx); err != nil {
+				log.Printf("Failed to send reminders: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+/*
+Tick delivers every reminder that is due at the clock's current time.
+
+Returns:
+  int   - Number of reminders claimed, delivered or not
+  error - Database error while claiming
+*/
+func (s *ReminderScheduler) Tick(ctx context.Context) (int, error) {
+	claimed := 0
+
+	for ctx.Err() == nil {
+		now := s.clock.Now()
+
+		reminders, err := s.store.ClaimDueReminders(now, now.Add(-reminderClaimTTL), reminderBatchSize)
+
+		if err != nil {
+			return claimed, err
+		}
+
+		var wg sync.WaitGroup
+
+		for i := range reminders {
+			wg.Add(1)
+
+			go func(reminder *models.DueReminder) {
+				defer wg.Done()
+				s.deliver(ctx, reminder)
+			}(&reminders[i])
+		}
+
+		wg.Wait()
+
+		claimed += len(reminders)
+
+		if len(reminders) < reminderBatchSize {
+			break
+		}
+	}
+
+	return claimed, nil
+}
+
+// deliver sends one claimed reminder and records the outcome.
+func (s *ReminderScheduler) deliver(ctx context.Context, reminder *models.DueReminder) {
+	ctx, cancel := context.WithTimeout(ctx, reminderDeliveryTimeout)
+	defer cancel()
+
+	var err error
+
+	if notifier, ok := s.channels[reminder.Channel]; ok {
+		err = notifier.Notify(ctx, reminder)
+	} else {
+		err = fmt.Errorf("unknown reminder channel %q", reminder.Channel)
+	}
+
+	now := s.clock.Now()
+
+	if err == nil {
+		if reminder.FireAt != nil {
+			err = s.store.CompleteReminder(reminder.ID, *reminder.FireAt, now)
+		}
+
+		if err != nil {
+			log.Printf("Failed to mark reminder %s as sent: %v", reminder.ID, err)
+		}
+
+		return
+	}
+
+	log.Printf("Reminder %s could not be delivered (attempt %d): %v", reminder.ID, reminder.Attempts, err)
+
+	if reminder.Attempts >= maxReminderAttempts {
+		err = s.store.FailReminder(reminder.ID, err.Error(), now)
+	} else {
+		err = s.store.RetryReminder(reminder.ID, now.Add(reminderRetryDelay(reminder.Attempts)), err.Error())
+	}
+
+	if err != nil {
+		log.Printf("Failed to record the delivery failure of reminder %s: %v", reminder.ID, err)
+	}
+}
+
+// reminderRetryDelay is the wait before the attempt that follows the
+// given number of failed attempts.
+func reminderRetryDelay(attempts int) time.Duration {
+	delay := reminderRetryBackoff
+
+	for i := 1; i < attempts && delay < maxReminderRetryBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxReminderRetryBackoff {
+		delay = maxReminderRetryBackoff
+	}
+
+	return delay
+}
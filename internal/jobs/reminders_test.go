@@ -0,0 +1,352 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"todos_api/internal/models"
+	"todos_api/internal/notify"
+)
+
+// fakeReminderStore keeps reminders in memory and claims them the way
+// repository.ClaimDueReminders does.
+type fakeReminderStore struct {
+	mu        sync.Mutex
+	reminders []*fakeReminder
+}
+
+type fakeReminder struct {
+	models.DueReminder
+	retryAt   *time.Time
+	claimedAt *time.Time
+}
+
+func (s *fakeReminderStore) add(reminder models.DueReminder) *fakeReminder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := &fakeReminder{DueReminder: reminder}
+	s.reminders = append(s.reminders, stored)
+
+	return stored
+}
+
+// get returns a copy of a stored reminder, safe to read while the
+// scheduler runs.
+func (s *fakeReminderStore) get(reminder *fakeReminder) fakeReminder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return *reminder
+}
+
+func (s *fakeReminderStore) find(id string) *fakeReminder {
+	for _, reminder := range s.reminders {
+		if reminder.ID == id {
+			return reminder
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeReminderStore) ClaimDueReminders(now time.Time, staleBefore time.Time, limit int) ([]models.DueReminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	claimed := []models.DueReminder{}
+
+	for _, reminder := range s.reminders {
+		if len(claimed) == limit {
+			break
+		}
+
+		next := reminder.FireAt
+
+		if reminder.retryAt != nil {
+			next = reminder.retryAt
+		}
+
+		if reminder.SentAt != nil || reminder.FailedAt != nil || next == nil || next.After(now) {
+			continue
+		}
+
+		if reminder.claimedAt != nil && !reminder.claimedAt.Before(staleBefore) {
+			continue
+		}
+
+		claimedAt := now
+		reminder.claimedAt = &claimedAt
+		reminder.Attempts++
+		claimed = append(claimed, reminder.DueReminder)
+	}
+
+	return claimed, nil
+}
+
+func (s *fakeReminderStore) CompleteReminder(id string, firedAt time.Time, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reminder := s.find(id)
+	reminder.claimedAt = nil
+
+	if reminder.FireAt != nil && reminder.FireAt.Equal(firedAt) {
+		reminder.SentAt = &now
+		reminder.LastError = nil
+	}
+
+	return nil
+}
+
+func (s *fakeReminderStore) RetryReminder(id string, retryAt time.Time, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reminder := s.find(id)
+	reminder.claimedAt = nil
+	reminder.retryAt = &retryAt
+	reminder.LastError = &message
+
+	return nil
+}
+
+func (s *fakeReminderStore) FailReminder(id string, message string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reminder := s.find(id)
+	reminder.claimedAt = nil
+	reminder.retryAt = nil
+	reminder.LastError = &message
+	reminder.FailedAt = &now
+
+	return nil
+}
+
+// fakeChannel records deliveries and fails the ones its fail function
+// says should fail.
+type fakeChannel struct {
+	mu         sync.Mutex
+	deliveries []models.DueReminder
+	fail       func(attempt int) error
+}
+
+func (c *fakeChannel) Notify(ctx context.Context, reminder *models.DueReminder) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deliveries = append(c.deliveries, *reminder)
+
+	if c.fail != nil {
+		return c.fail(len(c.deliveries))
+	}
+
+	return nil
+}
+
+func (c *fakeChannel) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.deliveries)
+}
+
+var errUnreachable = errors.New("unreachable")
+
+func newTestScheduler(start time.Time, channel *fakeChannel) (*ReminderScheduler, *fakeReminderStore, *FakeClock) {
+	store := &fakeReminderStore{}
+	clock := NewFakeClock(start)
+	scheduler := &ReminderScheduler{
+		store:    store,
+		clock:    clock,
+		channels: notify.Channels{models.ReminderChannelInApp: channel},
+	}
+
+	return scheduler, store, clock
+}
+
+func dueReminder(id string, fireAt time.Time) models.DueReminder {
+	return models.DueReminder{
+		Reminder: models.Reminder{ID: id, TodoID: 1, Channel: models.ReminderChannelInApp, FireAt: &fireAt},
+	}
+}
+
+func tick(t *testing.T, scheduler *ReminderScheduler) int {
+	t.Helper()
+
+	claimed, err := scheduler.Tick(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return claimed
+}
+
+func TestReminderDeliveredOnceWhenDue(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	channel := &fakeChannel{}
+	scheduler, store, clock := newTestScheduler(start, channel)
+	reminder := store.add(dueReminder("r1", start.Add(10*time.Minute)))
+
+	if claimed := tick(t, scheduler); claimed != 0 || channel.count() != 0 {
+		t.Fatalf("delivered %d reminders before they were due", channel.count())
+	}
+
+	clock.Advance(10 * time.Minute)
+
+	if claimed := tick(t, scheduler); claimed != 1 {
+		t.Fatalf("claimed %d reminders, want 1", claimed)
+	}
+
+	clock.Advance(time.Hour)
+	tick(t, scheduler)
+
+	if channel.count() != 1 {
+		t.Fatalf("delivered %d times, want once", channel.count())
+	}
+
+	if got := store.get(reminder); got.SentAt == nil || !got.SentAt.Equal(start.Add(10*time.Minute)) {
+		t.Errorf("sent_at = %v, want the time of the delivery", got.SentAt)
+	}
+}
+
+func TestReminderRetriedWithBackoff(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	channel := &fakeChannel{fail: func(attempt int) error {
+		if attempt <= 2 {
+			return errUnreachable
+		}
+
+		return nil
+	}}
+	scheduler, store, clock := newTestScheduler(start, channel)
+	reminder := store.add(dueReminder("r1", start))
+
+	tick(t, scheduler)
+
+	if got := store.get(reminder); got.retryAt == nil || !got.retryAt.Equal(start.Add(time.Minute)) {
+		t.Fatalf("after the first failure retry_at = %v, want one minute later", got.retryAt)
+	}
+
+	// Nothing happens before the retry is due.
+	clock.Advance(59 * time.Second)
+	tick(t, scheduler)
+
+	if channel.count() != 1 {
+		t.Fatalf("retried after %v", 59*time.Second)
+	}
+
+	clock.Advance(time.Second)
+	tick(t, scheduler)
+
+	if got := store.get(reminder); got.retryAt == nil || !got.retryAt.Equal(clock.Now().Add(2*time.Minute)) {
+		t.Fatalf("after the second failure retry_at = %v, want two minutes later", got.retryAt)
+	}
+
+	clock.Advance(2 * time.Minute)
+	tick(t, scheduler)
+
+	got := store.get(reminder)
+
+	if channel.count() != 3 || got.SentAt == nil {
+		t.Fatalf("%d deliveries, sent_at = %v; want the third attempt to succeed", channel.count(), got.SentAt)
+	}
+
+	if got.Attempts != 3 || got.LastError != nil {
+		t.Errorf("attempts = %d, last_error = %v", got.Attempts, got.LastError)
+	}
+}
+
+func TestReminderFailsAfterMaxAttempts(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	channel := &fakeChannel{fail: func(int) error { return errUnreachable }}
+	scheduler, store, clock := newTestScheduler(start, channel)
+	reminder := store.add(dueReminder("r1", start))
+
+	for attempt := 1; attempt <= maxReminderAttempts; attempt++ {
+		tick(t, scheduler)
+
+		if channel.count() != attempt {
+			t.Fatalf("attempt %d: %d deliveries", attempt, channel.count())
+		}
+
+		clock.Advance(reminderRetryDelay(attempt))
+	}
+
+	got := store.get(reminder)
+
+	if got.FailedAt == nil || got.SentAt != nil {
+		t.Fatalf("failed_at = %v, sent_at = %v; want the reminder failed", got.FailedAt, got.SentAt)
+	}
+
+	if got.LastError == nil || *got.LastError != errUnreachable.Error() {
+		t.Errorf("last_error = %v", got.LastError)
+	}
+
+	clock.Advance(24 * time.Hour)
+	tick(t, scheduler)
+
+	if channel.count() != maxReminderAttempts {
+		t.Errorf("%d deliveries, want no more than %d", channel.count(), maxReminderAttempts)
+	}
+}
+
+func TestReminderWithUnknownChannelIsRetried(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	scheduler, store, _ := newTestScheduler(start, &fakeChannel{})
+
+	unknown := dueReminder("r1", start)
+	unknown.Channel = "pager"
+	reminder := store.add(unknown)
+
+	tick(t, scheduler)
+
+	if got := store.get(reminder); got.retryAt == nil || got.LastError == nil {
+		t.Errorf("retry_at = %v, last_error = %v; want a retry", got.retryAt, got.LastError)
+	}
+}
+
+func TestTickDeliversMoreThanOneBatch(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	channel := &fakeChannel{}
+	scheduler, store, _ := newTestScheduler(start, channel)
+
+	for i := 0; i < reminderBatchSize+5; i++ {
+		store.add(dueReminder(string(rune('a'+i)), start))
+	}
+
+	if claimed := tick(t, scheduler); claimed != reminderBatchSize+5 {
+		t.Errorf("claimed %d reminders, want %d", claimed, reminderBatchSize+5)
+	}
+
+	if channel.count() != reminderBatchSize+5 {
+		t.Errorf("delivered %d reminders, want %d", channel.count(), reminderBatchSize+5)
+	}
+}
+
+func TestReminderRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{8, time.Hour},
+		{1000, time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := reminderRetryDelay(test.attempts); got != test.want {
+			t.Errorf("reminderRetryDelay(%d) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+	"todos_api/internal/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+/*
+Mailer sends transactional email such as password reset links.
+
+Implementations:
+  SMTPMailer   - Delivers through an SMTP relay (production)
+  OutboxMailer - Writes .eml files to a local directory so the whole flow
+                 can be run and inspected offline (development, tests)
+*/
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+/*
+New builds the Mailer selected by cfg.MailDriver.
+
+Supported drivers:
+  "smtp"   - SMTPMailer using the SMTP_* settings
+  "outbox" - OutboxMailer writing to cfg.MailOutboxDir (default)
+*/
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER is smtp but SMTP_HOST is not set")
+		}
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "", "outbox":
+		return NewOutboxMailer(cfg.MailOutboxDir, cfg.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", cfg.MailDriver)
+	}
+}
+
+// buildMessage renders msg as an RFC 5322 message with CRLF line endings.
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Message-ID: " + messageID(from) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
+
+func messageID(from string) string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at != -1 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	return "<" + hex.EncodeToString(buf) + "@" + domain + ">"
+}
+
+// sanitizeHeader strips CR/LF so user-provided values cannot inject headers.
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
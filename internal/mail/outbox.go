@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+OutboxMailer "sends" email by writing each message as an .eml file into a
+local directory.
+
+It lets the full password reset flow be exercised without an SMTP server:
+open the newest file in the outbox to find the link. Files are named
+<unix-nanos>-<random>.eml so they sort by creation time.
+*/
+type OutboxMailer struct {
+	dir  string
+	from string
+}
+
+func NewOutboxMailer(dir string, from string) *OutboxMailer {
+	if dir == "" {
+		dir = "outbox"
+	}
+
+	return &OutboxMailer{dir: dir, from: from}
+}
+
+func (m *OutboxMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	msg.To = sanitizeHeader(msg.To)
+	msg.Subject = sanitizeHeader(msg.Subject)
+
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), hex.EncodeToString(suffix))
+
+	return os.WriteFile(filepath.Join(m.dir, name), buildMessage(m.from, msg), 0o600)
+}
@@ -0,0 +1,72 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+/*
+SMTPMailer delivers email through an SMTP server.
+
+STARTTLS is used automatically by net/smtp when the server offers it.
+Authentication is only attempted when a username is configured.
+*/
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	if port == "" {
+		port = "587"
+	}
+
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	msg.To = sanitizeHeader(msg.To)
+	msg.Subject = sanitizeHeader(msg.Subject)
+
+	sender, err := mail.ParseAddress(m.from)
+
+	if err != nil {
+		return err
+	}
+
+	recipient, err := mail.ParseAddress(msg.To)
+
+	if err != nil {
+		return err
+	}
+
+	var smtpAuth smtp.Auth
+
+	if m.username != "" {
+		smtpAuth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- smtp.SendMail(m.addr, smtpAuth, sender.Address, []string{recipient.Address}, buildMessage(m.from, msg))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
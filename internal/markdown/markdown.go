@@ -0,0 +1,103 @@
+/*
+Package markdown renders the Markdown notes of todos.
+
+Notes are stored as the user wrote them. Rendering uses GitHub Flavored
+Markdown, so bare URLs, tables, strikethrough and task lists work, and
+the HTML is always sanitized before it leaves the API: raw HTML in the
+notes is dropped and links cannot run scripts.
+*/
+package markdown
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+var renderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+var policy = newPolicy()
+
+// newPolicy allows what users write in notes, plus the checkboxes of task
+// lists, which the renderer emits as disabled inputs.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return p
+}
+
+// linkSchemes are the schemes Links keeps.
+var linkSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// HTML renders Markdown as sanitized HTML.
+func HTML(source string) (string, error) {
+	var buf bytes.Buffer
+
+	if err := renderer.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+
+	return policy.Sanitize(buf.String()), nil
+}
+
+/*
+Links returns the targets of the links in Markdown, in the order they
+appear and without repeats. Bare URLs count as links. Only absolute http,
+https and mailto links are returned; images are not links.
+*/
+func Links(source string) []string {
+	var links []string = []string{}
+
+	if source == "" {
+		return links
+	}
+
+	data := []byte(source)
+	document := renderer.Parser().Parse(text.NewReader(data))
+	seen := make(map[string]bool)
+
+	add := func(target string) {
+		target = strings.TrimSpace(target)
+		parsed, err := url.Parse(target)
+
+		if err != nil || !linkSchemes[strings.ToLower(parsed.Scheme)] || seen[target] {
+			return
+		}
+
+		seen[target] = true
+		links = append(links, target)
+	}
+
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch link := node.(type) {
+		case *ast.Link:
+			add(string(link.Destination))
+		case *ast.AutoLink:
+			target := string(link.URL(data))
+
+			if link.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(strings.ToLower(target), "mailto:") {
+				target = "mailto:" + target
+			}
+
+			add(target)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return links
+}
@@ -0,0 +1,101 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLStripsUnsafeContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		banned []string
+	}{
+		{"javascript link", "[click](javascript:alert(1))", []string{"javascript:"}},
+		{"javascript link in capitals", "[click](JavaScript:alert(1))", []string{"avascript:"}},
+		{"javascript link with entities", "[click](java&#x73;cript:alert(1))", []string{"cript:"}},
+		{"data link", "[open](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)", []string{"data:"}},
+		{"data image", "![x](data:image/svg+xml;base64,PHN2Zz48L3N2Zz4=)", []string{"data:"}},
+		{"vbscript link", "[click](vbscript:msgbox(1))", []string{"vbscript:"}},
+		{"raw script", "<script>alert(1)</script>", []string{"<script", "alert(1)"}},
+		{"inline script", "before <script>alert(1)</script> after", []string{"<script"}},
+		{"iframe", `<iframe src="https://evil.example"></iframe>`, []string{"<iframe", "evil.example"}},
+		{"object", `<object data="https://evil.example/x.swf"></object>`, []string{"<object"}},
+		{"event handler", `<img src="https://example.com/x.png" onerror="alert(1)">`, []string{"onerror", "alert(1)"}},
+		{"event handler on a link", `<a href="https://example.com" onclick="alert(1)">x</a>`, []string{"onclick"}},
+		{"style attribute", `<p style="background:url(javascript:alert(1))">x</p>`, []string{"style=", "javascript:"}},
+		{"autolinked javascript", "<javascript:alert(1)>", []string{`href="javascript:`}},
+	}
+
+	for _, test := range tests {
+		html, err := HTML(test.source)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		for _, banned := range test.banned {
+			if strings.Contains(strings.ToLower(html), strings.ToLower(banned)) {
+				t.Errorf("%s: HTML(%q) = %q, contains %q", test.name, test.source, html, banned)
+			}
+		}
+	}
+}
+
+func TestHTMLKeepsSafeContent(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"**bold**", "<strong>bold</strong>"},
+		{"~~gone~~", "<del>gone</del>"},
+		{"[docs](https://example.com/docs)", `href="https://example.com/docs"`},
+		{"[docs](https://example.com/docs)", `rel="nofollow noopener"`},
+		{"[docs](https://example.com/docs)", `target="_blank"`},
+		{"see https://example.com", `href="https://example.com"`},
+		{"[mail](mailto:ann@example.com)", `href="mailto:ann@example.com"`},
+		{"- [x] done\n- [ ] todo", `<input checked="" disabled="" type="checkbox"`},
+		{"| a | b |\n|---|---|\n| 1 | 2 |", "<td>1</td>"},
+	}
+
+	for _, test := range tests {
+		html, err := HTML(test.source)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(html, test.want) {
+			t.Errorf("HTML(%q) = %q, want it to contain %q", test.source, html, test.want)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{"", []string{}},
+		{"no links here", []string{}},
+		{"[a](https://example.com/a) and https://example.com/b", []string{"https://example.com/a", "https://example.com/b"}},
+		{"[a](https://example.com/a) [again](https://example.com/a)", []string{"https://example.com/a"}},
+		{"write to ann@example.com or [bob](mailto:bob@example.com)", []string{"mailto:ann@example.com", "mailto:bob@example.com"}},
+		{"![img](https://example.com/x.png)", []string{}},
+		{"[js](javascript:alert(1)) [JS](JAVASCRIPT:alert(1))", []string{}},
+		{"[data](data:text/html,<b>x</b>) [vb](vbscript:msgbox(1))", []string{}},
+		{"[file](file:///etc/passwd) [ftp](ftp://example.com/x)", []string{}},
+		{"[relative](/todos/1) [anchor](#notes) [protocol relative](//example.com)", []string{}},
+		{"<javascript:alert(1)> <https://example.com/ok>", []string{"https://example.com/ok"}},
+		{"`https://example.com/code`", []string{}},
+		{`<a href="https://example.com/raw">raw</a>`, []string{}},
+	}
+
+	for _, test := range tests {
+		got := Links(test.source)
+
+		if strings.Join(got, " ") != strings.Join(test.want, " ") || got == nil {
+			t.Errorf("Links(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+}
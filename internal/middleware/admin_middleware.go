@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+RequireAdmin only lets administrators through.
+
+The role is read from the database rather than from the token's role
+claim, so it also works for personal access tokens and a demoted admin
+loses access immediately. Must be placed after AuthMiddleware.
+
+Usage example:
+
+  admin := router.Group("/admin")
+  admin.Use(middleware.AuthMiddleware(pool, keys, revocations), middleware.RequireAdmin(pool))
+
+Possible responses:
+  403 Forbidden     - User is not an admin
+  500 Internal Error - Database error
+*/
+func RequireAdmin(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := repository.GetUserByID(pool, c.GetString("user_id"))
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			c.Abort()
+			return
+		}
+
+		if user.Role != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
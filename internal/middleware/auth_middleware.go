@@ -1,32 +1,49 @@
 package middleware
 
 import (
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
-	"todos_api/internal/config"
+	"todos_api/internal/auth"
+	"todos_api/internal/repository"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 /*
-AuthMiddleware is a Gin middleware that protects routes by validating JWT tokens.
+AuthMiddleware is a Gin middleware that protects routes by validating JWT
+tokens or personal access tokens.
 
 This middleware performs authentication by:
 
   1. Reading the Authorization header
   2. Extracting the Bearer token
-  3. Verifying the token signature using the server's JWT secret
+  3. Verifying the token signature against the server's key set
   4. Validating token expiration
   5. Extracting the user_id claim
-  6. Storing user_id in Gin context for downstream handlers
+  6. Rejecting tokens revoked by logout, logout-all or a password change
+  7. Storing user_id in Gin context for downstream handlers
+  8. Auditing every request made with an admin's impersonation token
+
+Bearer tokens starting with "tdo_" are personal access tokens instead of
+JWTs. They are looked up by hash, must not be revoked or expired, and only
+carry the scopes chosen when they were created.
+
+When cookie sessions are enabled (csrf is not nil), a request without an
+Authorization header may instead carry its access token in the
+access_token cookie; see authenticateSessionCookie for the CSRF rules.
 
 If authentication fails at any step, the request is rejected with HTTP 401.
 
 Parameters:
-  cfg - Application configuration containing JWTSecret used for token verification
+  pool        - PostgreSQL connection pool used to look up personal access tokens
+  keys        - Key set used for token verification
+  revocations - Revocation store consulted for every verified token
+  csrf        - CSRF protector for cookie sessions, nil if they are disabled
 
 Returns:
   gin.HandlerFunc - Middleware function compatible with Gin router
@@ -34,13 +51,14 @@ Returns:
 Usage example:
 
   router.GET("/todos",
-      AuthMiddleware(cfg),
+      AuthMiddleware(pool, keys, revocations, csrf),
       handlers.GetAllTodosHandler(pool),
   )
 
 Authorization Header Format:
 
   Authorization: Bearer <JWT_TOKEN>
+  Authorization: Bearer tdo_<PERSONAL_ACCESS_TOKEN>
 
 Example:
 
@@ -48,7 +66,14 @@ Example:
 
 Context values set:
 
-  "user_id" - ID of authenticated user
+  "user_id"          - ID of authenticated user
+  "auth_method"      - "jwt" or "personal_access_token"
+  "session_cookie"   - true if the JWT came from the session cookie
+  "token_claims"     - *auth.AccessClaims of the presented JWT (JWT only)
+  "token_id"         - ID of the personal access token (personal access token only)
+  "token_scopes"     - []string of scopes granted to the token
+  "impersonator_id"  - ID of the acting admin (impersonation tokens only)
+  "impersonation_id" - ID of the audited impersonation (impersonation tokens only)
 
 Downstream handlers can retrieve it using:
 
@@ -62,11 +87,16 @@ Authentication Flow:
   Middleware → Attach user_id to context
   Handler → Execute authorized logic
 */
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+func AuthMiddleware(pool *pgxpool.Pool, keys *auth.KeySet, revocations *auth.RevocationStore, csrf *auth.CSRFProtector) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 
 		if authHeader == "" {
+			if cookie, err := c.Cookie(auth.AccessTokenCookie); err == nil && cookie != "" && csrf != nil {
+				authenticateSessionCookie(c, pool, keys, revocations, csrf, cookie)
+				return
+			}
+
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 			c.Abort()
 			return
@@ -80,46 +110,162 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(cfg.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+		if strings.HasPrefix(tokenString, auth.PersonalAccessTokenPrefix) {
+			authenticatePersonalAccessToken(c, pool, tokenString)
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
+		claims, ok := verifyAccessToken(c, keys, revocations, tokenString)
 
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token Claims"})
-			c.Abort()
 			return
 		}
 
-		userID, ok := claims["user_id"].(string)
+		continueWithAccessToken(c, pool, claims)
+	}
+}
 
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token Claims"})
+// verifyAccessToken parses a JWT access token and checks it has not been
+// revoked, then records that its session was seen. On failure the request
+// is aborted and false is returned.
+func verifyAccessToken(c *gin.Context, keys *auth.KeySet, revocations *auth.RevocationStore, tokenString string) (*auth.AccessClaims, bool) {
+	claims, err := auth.ParseAccessToken(keys, tokenString)
+
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return nil, false
+	}
+
+	revoked, err := revocations.IsRevoked(claims)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to verify token status"})
+		c.Abort()
+		return nil, false
+	}
+
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		c.Abort()
+		return nil, false
+	}
+
+	if claims.SessionID != "" {
+		revocations.TouchSession(claims.SessionID)
+	}
+
+	return claims, true
+}
+
+/*
+authenticateSessionCookie authenticates a browser request carrying its
+access token in the session cookie, then continues or aborts the chain.
+
+The browser attaches the cookie to every request, including ones another
+site triggers, so requests that can change state (anything but GET, HEAD
+and OPTIONS) must also carry a CSRF token in the X-CSRF-Token header that
+matches the csrf_token cookie and was issued to the same user.
+*/
+func authenticateSessionCookie(c *gin.Context, pool *pgxpool.Pool, keys *auth.KeySet, revocations *auth.RevocationStore, csrf *auth.CSRFProtector, tokenString string) {
+	claims, ok := verifyAccessToken(c, keys, revocations, tokenString)
+
+	if !ok {
+		return
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		cookie, _ := c.Cookie(auth.CSRFCookie)
+
+		if !csrf.Check(c.GetHeader(auth.CSRFHeader), cookie, claims.UserID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
 			c.Abort()
 			return
 		}
+	}
 
-		if exp, ok := claims["exp"].(float64); ok {
-			expirationTime := time.Unix(int64(exp), 0)
+	c.Set("session_cookie", true)
+	continueWithAccessToken(c, pool, claims)
+}
 
-			if time.Now().After(expirationTime) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has expired"})
-				c.Abort()
-				return
-			}
-		}
+/*
+continueWithAccessToken stores the verified claims of a JWT for the
+handlers and continues the chain.
 
-		c.Set("user_id", userID)
+Requests made with an impersonation token are audited: an event is
+written before the request is handled, and the request is refused if
+that fails or the impersonation is no longer allowed, so no impersonated
+request goes unrecorded. The response status is added afterwards.
+*/
+func continueWithAccessToken(c *gin.Context, pool *pgxpool.Pool, claims *auth.AccessClaims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("auth_method", "jwt")
+	c.Set("token_claims", claims)
+	c.Set("token_scopes", claims.Scopes)
+
+	if claims.ImpersonatorID == "" {
 		c.Next()
+		return
 	}
+
+	eventID, err := repository.RecordImpersonatedRequest(pool, claims.ImpersonationID, c.Request.Method, c.Request.URL.RequestURI(), c.ClientIP())
+
+	if err != nil {
+		if errors.Is(err, repository.ErrImpersonationInactive) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation has ended"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to audit impersonated request"})
+		}
+		c.Abort()
+		return
+	}
+
+	c.Set("impersonator_id", claims.ImpersonatorID)
+	c.Set("impersonation_id", claims.ImpersonationID)
+	c.Next()
+
+	if err := repository.CompleteImpersonatedRequest(pool, eventID, c.Writer.Status()); err != nil {
+		log.Printf("Failed to record status of impersonated request %d: %v", eventID, err)
+	}
+}
+
+// personalAccessTokenTouchInterval limits how often last_used_at is
+// written for a busy token.
+const personalAccessTokenTouchInterval = time.Minute
+
+/*
+authenticatePersonalAccessToken authenticates a request carrying a
+personal access token ("tdo_..."), then continues or aborts the chain.
+
+Personal access tokens are looked up by hash on every request, so revoking
+one takes effect immediately on all replicas.
+*/
+func authenticatePersonalAccessToken(c *gin.Context, pool *pgxpool.Pool, tokenString string) {
+	token, err := repository.GetActivePersonalAccessTokenByHash(pool, auth.HashToken(tokenString))
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid, expired or revoked token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to verify token status"})
+		}
+		c.Abort()
+		return
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > personalAccessTokenTouchInterval {
+		go func(id string) {
+			if err := repository.TouchPersonalAccessToken(pool, id, personalAccessTokenTouchInterval); err != nil {
+				log.Printf("Failed to update last_used_at for token %s: %v", id, err)
+			}
+		}(token.ID)
+	}
+
+	c.Set("user_id", token.UserID)
+	c.Set("auth_method", "personal_access_token")
+	c.Set("token_id", token.ID)
+	c.Set("token_scopes", token.Scopes)
+	c.Next()
 }
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"todos_api/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+RequireScope rejects requests whose token was not granted the given scope.
+
+It reads the "token_scopes" context value set by AuthMiddleware, so it
+must be placed after it. Scopes are declared per route in main.go, e.g.:
+
+  protected.GET("", middleware.RequireScope(auth.ScopeTodosRead), handlers.GetAllTodosHandler(pool))
+  protected.POST("", middleware.RequireScope(auth.ScopeTodosWrite), handlers.CreateToDoHandler(pool))
+
+Possible responses:
+  403 Forbidden - Token lacks the scope
+*/
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopesInterface, exists := c.Get("token_scopes")
+		scopes, ok := scopesInterface.([]string)
+
+		if !exists || !ok || !auth.HasScope(scopes, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token lacks required scope: " + scope})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
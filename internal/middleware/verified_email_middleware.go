@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"todos_api/internal/config"
+	"todos_api/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+RequireVerifiedEmail blocks users whose email address is not verified yet.
+
+It only takes effect when cfg.RequireVerifiedEmail is enabled
+(REQUIRE_VERIFIED_EMAIL=true); otherwise it lets every request through.
+Must be placed after AuthMiddleware.
+
+Usage example:
+
+  protected.POST("", middleware.RequireVerifiedEmail(pool, cfg), handlers.CreateToDoHandler(pool))
+
+Possible responses:
+  403 Forbidden     - Email address not verified
+  500 Internal Error - Database error
+*/
+func RequireVerifiedEmail(pool *pgxpool.Pool, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.RequireVerifiedEmail {
+			c.Next()
+			return
+		}
+
+		userID := c.GetString("user_id")
+
+		user, err := repository.GetUserByID(pool, userID)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if user.EmailVerifiedAt == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
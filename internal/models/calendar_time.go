@@ -0,0 +1,109 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const calendarDateLayout = "2006-01-02"
+
+/*
+CalendarTime is either a whole day ("2026-03-29") or an instant
+("2026-03-29T14:00:00+02:00").
+
+A day has no time zone of its own: it is the same calendar day wherever
+the user is, and starts at midnight in the user's time zone. An instant
+is stored in UTC and rendered in RFC 3339.
+
+For a day, Time holds midnight UTC of that date and DateOnly is true.
+*/
+type CalendarTime struct {
+	Time     time.Time
+	DateOnly bool
+}
+
+// ParseCalendarTime accepts "YYYY-MM-DD" for a day, or an RFC 3339 time.
+func ParseCalendarTime(value string) (CalendarTime, error) {
+	if date, err := time.Parse(calendarDateLayout, value); err == nil {
+		return CalendarTime{Time: date, DateOnly: true}, nil
+	}
+
+	instant, err := time.Parse(time.RFC3339, value)
+
+	if err != nil {
+		return CalendarTime{}, fmt.Errorf("%q is neither a date (YYYY-MM-DD) nor an RFC 3339 time", value)
+	}
+
+	return CalendarTime{Time: instant.UTC()}, nil
+}
+
+func (t CalendarTime) String() string {
+	if t.DateOnly {
+		return t.Time.Format(calendarDateLayout)
+	}
+
+	return t.Time.UTC().Format(time.RFC3339)
+}
+
+func (t CalendarTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *CalendarTime) UnmarshalJSON(data []byte) error {
+	var value string
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("expected a date or time string")
+	}
+
+	parsed, err := ParseCalendarTime(value)
+
+	if err != nil {
+		return err
+	}
+
+	*t = parsed
+
+	return nil
+}
+
+// In returns the instant t stands for in a time zone: the instant itself,
+// or the start of the day in loc.
+func (t CalendarTime) In(loc *time.Location) time.Time {
+	if !t.DateOnly {
+		return t.Time.In(loc)
+	}
+
+	return StartOfDay(t.Time.Year(), t.Time.Month(), t.Time.Day(), loc)
+}
+
+/*
+StartOfDay returns the first instant of a calendar day in loc.
+
+Usually that is midnight. Where a daylight saving change skips midnight
+(clocks jump from 00:00 to 01:00), time.Date may pick the non-existent
+midnight in the previous day's offset, which lies before the day begins;
+the day then really starts at the end of the gap.
+*/
+func StartOfDay(year int, month time.Month, day int, loc *time.Location) time.Time {
+	start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+	// Offsets change in multiples of 15 minutes.
+	for start.Day() != time.Date(year, month, day, 12, 0, 0, 0, loc).Day() {
+		start = start.Add(15 * time.Minute)
+	}
+
+	return start
+}
+
+/*
+DayBounds returns the first instant of the day now falls on, in now's
+location, and the first instant of the next day. A day is 23 or 25 hours
+long when daylight saving time starts or ends on it.
+*/
+func DayBounds(now time.Time) (time.Time, time.Time) {
+	year, month, day := now.Date()
+
+	return StartOfDay(year, month, day, now.Location()), StartOfDay(year, month, day+1, now.Location())
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loc
+}
+
+func TestStartOfDay(t *testing.T) {
+	tests := []struct {
+		name  string
+		zone  string
+		date  string
+		start string // UTC
+		hours int    // length of the day
+	}{
+		{"ordinary day", "Europe/Berlin", "2026-06-15", "2026-06-14T22:00:00Z", 24},
+		{"spring forward at 02:00", "Europe/Berlin", "2026-03-29", "2026-03-28T23:00:00Z", 23},
+		{"fall back at 03:00", "Europe/Berlin", "2026-10-25", "2026-10-24T22:00:00Z", 25},
+		{"midnight skipped", "America/Santiago", "2026-09-06", "2026-09-06T04:00:00Z", 23},
+		{"hour before midnight repeated", "America/Santiago", "2026-04-04", "2026-04-04T03:00:00Z", 25},
+		{"midnight skipped", "America/Sao_Paulo", "2018-11-04", "2018-11-04T03:00:00Z", 23},
+		{"hour before midnight repeated", "America/Sao_Paulo", "2019-02-16", "2019-02-16T02:00:00Z", 25},
+		{"no daylight saving", "UTC", "2026-03-29", "2026-03-29T00:00:00Z", 24},
+	}
+
+	for _, test := range tests {
+		loc := loadLocation(t, test.zone)
+		date, _ := time.Parse(calendarDateLayout, test.date)
+		start := StartOfDay(date.Year(), date.Month(), date.Day(), loc)
+
+		if got := start.UTC().Format(time.RFC3339); got != test.start {
+			t.Errorf("%s in %s: StartOfDay(%s) = %s, want %s", test.name, test.zone, test.date, got, test.start)
+		}
+
+		if year, month, day := start.Date(); year != date.Year() || month != date.Month() || day != date.Day() {
+			t.Errorf("%s in %s: StartOfDay(%s) falls on %d-%02d-%02d", test.name, test.zone, test.date, year, month, day)
+		}
+
+		if before := start.Add(-time.Second); before.Day() == start.Day() {
+			t.Errorf("%s in %s: %s is still on %s", test.name, test.zone, before, test.date)
+		}
+
+		next := StartOfDay(date.Year(), date.Month(), date.Day()+1, loc)
+
+		if got := next.Sub(start); got != time.Duration(test.hours)*time.Hour {
+			t.Errorf("%s in %s: %s lasts %v, want %dh", test.name, test.zone, test.date, got, test.hours)
+		}
+
+		// A whole-day date starts where the day does.
+		if got := (CalendarTime{Time: date, DateOnly: true}).In(loc); !got.Equal(start) {
+			t.Errorf("%s in %s: CalendarTime.In = %s, want %s", test.name, test.zone, got, start)
+		}
+	}
+}
+
+func TestDayBounds(t *testing.T) {
+	tests := []struct {
+		zone     string
+		now      string // UTC
+		today    string // UTC
+		tomorrow string // UTC
+	}{
+		// 23:59:59 and 01:00 in Santiago around the skipped midnight.
+		{"America/Santiago", "2026-09-06T03:59:59Z", "2026-09-05T04:00:00Z", "2026-09-06T04:00:00Z"},
+		{"America/Santiago", "2026-09-06T04:00:00Z", "2026-09-06T04:00:00Z", "2026-09-07T03:00:00Z"},
+		// Both 23:30 of the repeated hour are still on the 4th.
+		{"America/Santiago", "2026-04-05T02:30:00Z", "2026-04-04T03:00:00Z", "2026-04-05T04:00:00Z"},
+		{"America/Santiago", "2026-04-05T03:30:00Z", "2026-04-04T03:00:00Z", "2026-04-05T04:00:00Z"},
+		{"America/Sao_Paulo", "2018-11-04T02:59:59Z", "2018-11-03T03:00:00Z", "2018-11-04T03:00:00Z"},
+		{"America/Sao_Paulo", "2018-11-04T03:00:00Z", "2018-11-04T03:00:00Z", "2018-11-05T02:00:00Z"},
+		{"Europe/Berlin", "2026-03-29T12:00:00Z", "2026-03-28T23:00:00Z", "2026-03-29T22:00:00Z"},
+		{"Europe/Berlin", "2026-10-25T22:59:59Z", "2026-10-24T22:00:00Z", "2026-10-25T23:00:00Z"},
+		{"Europe/Berlin", "2026-10-25T23:00:00Z", "2026-10-25T23:00:00Z", "2026-10-26T23:00:00Z"},
+	}
+
+	for _, test := range tests {
+		loc := loadLocation(t, test.zone)
+		now, _ := time.Parse(time.RFC3339, test.now)
+		today, tomorrow := DayBounds(now.In(loc))
+
+		if got := today.UTC().Format(time.RFC3339); got != test.today {
+			t.Errorf("%s at %s: today starts at %s, want %s", test.zone, test.now, got, test.today)
+		}
+
+		if got := tomorrow.UTC().Format(time.RFC3339); got != test.tomorrow {
+			t.Errorf("%s at %s: tomorrow starts at %s, want %s", test.zone, test.now, got, test.tomorrow)
+		}
+
+		// Something due now is due today and not yet overdue; something
+		// due a second before today began is not due today.
+		if now.Before(today) || !now.Before(tomorrow) {
+			t.Errorf("%s at %s: now is outside [%s, %s)", test.zone, test.now, today, tomorrow)
+		}
+
+		if before := today.Add(-time.Second); !before.Before(today) {
+			t.Errorf("%s at %s: %s counts as today", test.zone, test.now, before)
+		}
+	}
+}
+
+func TestCalendarTimeJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		output   string
+		dateOnly bool
+	}{
+		{`"2026-03-29"`, `"2026-03-29"`, true},
+		{`"2026-09-06"`, `"2026-09-06"`, true},
+		{`"2026-03-29T14:00:00+02:00"`, `"2026-03-29T12:00:00Z"`, false},
+		{`"2026-03-29T12:00:00Z"`, `"2026-03-29T12:00:00Z"`, false},
+	}
+
+	for _, test := range tests {
+		var parsed CalendarTime
+
+		if err := json.Unmarshal([]byte(test.input), &parsed); err != nil {
+			t.Errorf("Unmarshal(%s): %v", test.input, err)
+			continue
+		}
+
+		if parsed.DateOnly != test.dateOnly {
+			t.Errorf("Unmarshal(%s).DateOnly = %v, want %v", test.input, parsed.DateOnly, test.dateOnly)
+		}
+
+		output, err := json.Marshal(parsed)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(output) != test.output {
+			t.Errorf("Marshal(Unmarshal(%s)) = %s, want %s", test.input, output, test.output)
+		}
+
+		var again CalendarTime
+
+		if err := json.Unmarshal(output, &again); err != nil || again != parsed {
+			t.Errorf("%s does not round-trip: %+v, %v", output, again, err)
+		}
+	}
+
+	// A whole day stays the same day in any time zone.
+	day, _ := ParseCalendarTime("2026-09-06")
+
+	if day.Time.Location() != time.UTC || day.Time.Hour() != 0 {
+		t.Errorf("the date is stored as %s, want midnight UTC", day.Time)
+	}
+
+	for _, input := range []string{`"2026-02-30"`, `"29.03.2026"`, `"2026-03-29T14:00"`, `""`, `20260329`} {
+		var parsed CalendarTime
+
+		if err := json.Unmarshal([]byte(input), &parsed); err == nil {
+			t.Errorf("Unmarshal(%s) = %+v, want an error", input, parsed)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Statuses of a data export job.
+const (
+	DataExportPending   = "pending"
+	DataExportRunning   = "running"
+	DataExportCompleted = "completed"
+	DataExportFailed    = "failed"
+	DataExportExpired   = "expired"
+)
+
+// DataExport is a request for a zip archive of everything stored about a
+// user. The archive lives on local disk until ExpiresAt.
+type DataExport struct {
+	ID          string     `json:"id" db:"id"`
+	UserID      string     `json:"user_id" db:"user_id"`
+	Status      string     `json:"status" db:"status"`
+	FilePath    *string    `json:"-" db:"file_path"`
+	SizeBytes   *int64     `json:"size_bytes" db:"size_bytes"`
+	Error       *string    `json:"error" db:"error"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	StartedAt   *time.Time `json:"started_at" db:"started_at"`
+	CompletedAt *time.Time `json:"completed_at" db:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+}
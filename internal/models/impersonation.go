@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Impersonation is a time-limited token an admin obtained to act as a
+// user, with the reason they gave.
+type Impersonation struct {
+	ID        string     `json:"id" db:"id"`
+	AdminID   string     `json:"admin_id" db:"admin_id"`
+	UserID    string     `json:"user_id" db:"user_id"`
+	Reason    string     `json:"reason" db:"reason"`
+	Scopes    []string   `json:"scopes" db:"scopes"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at" db:"ended_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ImpersonationAuditEvent is one request made with an impersonation
+// token. Status is nil while the request is being handled, or if the
+// server stopped before it finished.
+type ImpersonationAuditEvent struct {
+	ID              int64     `json:"id" db:"id"`
+	ImpersonationID string    `json:"impersonation_id" db:"impersonation_id"`
+	Method          string    `json:"method" db:"method"`
+	Path            string    `json:"path" db:"path"`
+	Status          *int      `json:"status" db:"status"`
+	IPAddress       *string   `json:"ip_address" db:"ip_address"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Kinds of lockout event.
+const (
+	LockoutEventLocked   = "locked"
+	LockoutEventUnlocked = "unlocked"
+)
+
+// LockoutEvent records a login lockout, or an admin lifting one.
+type LockoutEvent struct {
+	ID          string     `json:"id" db:"id"`
+	Key         string     `json:"key" db:"key"`
+	UserID      *string    `json:"user_id" db:"user_id"`
+	Event       string     `json:"event" db:"event"`
+	IPAddress   *string    `json:"ip_address" db:"ip_address"`
+	LockedUntil *time.Time `json:"locked_until" db:"locked_until"`
+	ActorID     *string    `json:"actor_id" db:"actor_id"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type UserTOTP struct {
+	UserID           string     `json:"user_id" db:"user_id"`
+	SecretCiphertext []byte     `json:"-" db:"secret_ciphertext"`
+	ConfirmedAt      *time.Time `json:"confirmed_at" db:"confirmed_at"`
+	LastUsedStep     *int64     `json:"-" db:"last_used_step"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+/*
+Nullable is a field of a partial update (PATCH-style) request that tells
+"not sent" apart from "sent as null":
+
+  {}                  - Set is false: keep the current value
+  {"due_at": null}    - Set is true, Value is nil: clear the value
+  {"due_at": "..."}   - Set is true, Value points to the new value
+*/
+type Nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+// UnmarshalJSON is only called for fields present in the JSON, which is
+// what marks the field as set.
+func (n *Nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		n.Value = nil
+		return nil
+	}
+
+	var value T
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	n.Value = &value
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+/*
+Priority is the importance of a todo. It is stored as a number so that
+todos sort by it, and written as a name in JSON.
+*/
+type Priority int16
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+	PriorityUrgent
+)
+
+var priorityNames = []string{"none", "low", "medium", "high", "urgent"}
+
+// ParsePriority accepts the name of a priority: "none", "low", "medium",
+// "high" or "urgent".
+func ParsePriority(name string) (Priority, error) {
+	for i, candidate := range priorityNames {
+		if candidate == name {
+			return Priority(i), nil
+		}
+	}
+
+	return PriorityNone, fmt.Errorf("priority must be one of none, low, medium, high, urgent")
+}
+
+func (p Priority) String() string {
+	if p < 0 || int(p) >= len(priorityNames) {
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+
+	return priorityNames[p]
+}
+
+func (p Priority) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+func (p *Priority) UnmarshalJSON(data []byte) error {
+	var name string
+
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("priority must be a string")
+	}
+
+	parsed, err := ParsePriority(name)
+
+	if err != nil {
+		return err
+	}
+
+	*p = parsed
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+/*
+Project is a list that groups the todos of a user. Todos without a project
+are in the user's Inbox, which has no row of its own.
+
+An archived project keeps its todos but hides them from the todo list.
+TodoCount and OpenCount count the project's todos, all and not completed.
+*/
+type Project struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     string     `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Color      *string    `json:"color" db:"color"`
+	Position   int        `json:"position" db:"position"`
+	ArchivedAt *time.Time `json:"archived_at" db:"archived_at"`
+	TodoCount  int        `json:"todo_count" db:"todo_count"`
+	OpenCount  int        `json:"open_count" db:"open_count"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Delivery channels of a reminder.
+const (
+	ReminderChannelEmail   = "email"
+	ReminderChannelWebhook = "webhook"
+	ReminderChannelInApp   = "in_app"
+)
+
+/*
+Reminder notifies the owner of a todo at a chosen time.
+
+A reminder is either relative (OffsetMinutes before the todo's due date)
+or absolute (at RemindAt). FireAt is the next time it fires; it follows
+the due date of relative reminders and is moved by snoozing. It is nil
+while a relative reminder's todo has no due date.
+*/
+type Reminder struct {
+	ID            string     `json:"id" db:"id"`
+	TodoID        int        `json:"todo_id" db:"todo_id"`
+	UserID        string     `json:"user_id" db:"user_id"`
+	OffsetMinutes *int       `json:"offset_minutes" db:"offset_minutes"`
+	RemindAt      *time.Time `json:"remind_at" db:"remind_at"`
+	Channel       string     `json:"channel" db:"channel"`
+	WebhookURL    *string    `json:"webhook_url,omitempty" db:"webhook_url"`
+	FireAt        *time.Time `json:"fire_at" db:"fire_at"`
+	SnoozedUntil  *time.Time `json:"snoozed_until" db:"snoozed_until"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	LastError     *string    `json:"last_error" db:"last_error"`
+	SentAt        *time.Time `json:"sent_at" db:"sent_at"`
+	FailedAt      *time.Time `json:"failed_at" db:"failed_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// DueReminder is a reminder claimed by the scheduler, with what is needed
+// to deliver it.
+type DueReminder struct {
+	Reminder
+	TodoTitle string
+	TodoDueAt *CalendarTime
+	Email     string
+	TimeZone  string
+}
+
+// Notification is an in-app notification of a user.
+type Notification struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     string     `json:"user_id" db:"user_id"`
+	TodoID     *int       `json:"todo_id" db:"todo_id"`
+	ReminderID *string    `json:"reminder_id" db:"reminder_id"`
+	Title      string     `json:"title" db:"title"`
+	Body       string     `json:"body" db:"body"`
+	ReadAt     *time.Time `json:"read_at" db:"read_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
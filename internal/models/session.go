@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session is one login of a user, shared by the refresh token family and
+// the access tokens minted from it.
+type Session struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     string     `json:"user_id" db:"user_id"`
+	UserAgent  *string    `json:"user_agent" db:"user_agent"`
+	IPAddress  *string    `json:"ip_address" db:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Tag is a label a user puts on their todos. Names are unique per user,
+// ignoring case; Position orders tags in the UI.
+type Tag struct {
+	ID        string    `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Name      string    `json:"name" db:"name"`
+	Color     *string   `json:"color" db:"color"`
+	Position  int       `json:"position" db:"position"`
+	TodoCount int       `json:"todo_count" db:"todo_count"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TodoTag is a tag as shown on a todo.
+type TodoTag struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Color *string `json:"color"`
+}
@@ -2,11 +2,52 @@ package models
 
 import "time"
 
+/*
+ToDo is a task of a user.
+
+DueAt and StartAt are optional and are either a whole day or an instant,
+see CalendarTime. Filters such as "due today" are evaluated in the
+owner's time zone.
+
+Tags are shared with the user's other todos, see Tag. A todo without a
+ProjectID is in the user's Inbox.
+
+A todo with a SeriesID is one occurrence of a recurring series, and
+RecurrenceID is the date or time the occurrence originally fell on.
+
+Notes is Markdown, returned as written. Links lists the link targets in
+the notes; NotesHTML is only filled in when the client asks for the
+notes as sanitized HTML.
+
+A todo with a ParentID is a subtask of that todo. Subtasks counts the
+direct subtasks of a todo and how many of them are completed.
+
+The fields of the first version keep the JSON keys clients have always
+received (ID, Title, Completed, CreatedAt, UpdatedAt, UserID).
+*/
 type ToDo struct {
-	ID        int       `json: "id" db:"id"`
-	Title     string    `json: "title" db: "title"`
-	Completed bool      `json: "completed db: "completed"`
-	CreatedAt time.Time `json: "created_at" db: "created_at"`
-	UpdatedAt time.Time `json: "updated_at" db: "updated_at"`
-	UserID    string    `json: "user_id" db: "user_id"`
+	ID           int           `json:"ID" db:"id"`
+	Title        string        `json:"Title" db:"title"`
+	Notes        *string       `json:"notes" db:"notes"`
+	NotesHTML    *string       `json:"notes_html,omitempty" db:"-"`
+	Links        []string      `json:"links" db:"-"`
+	Completed    bool          `json:"Completed" db:"completed"`
+	Priority     Priority      `json:"priority" db:"priority"`
+	Tags         []TodoTag     `json:"tags" db:"tags"`
+	ProjectID    *string       `json:"project_id" db:"project_id"`
+	ParentID     *int          `json:"parent_id" db:"parent_id"`
+	Subtasks     SubtaskCount  `json:"subtasks" db:"-"`
+	DueAt        *CalendarTime `json:"due_at" db:"due_at"`
+	StartAt      *CalendarTime `json:"start_at" db:"start_at"`
+	SeriesID     *string       `json:"series_id" db:"series_id"`
+	RecurrenceID *CalendarTime `json:"recurrence_id" db:"recurrence_id"`
+	CreatedAt    time.Time     `json:"CreatedAt" db:"created_at"`
+	UpdatedAt    time.Time     `json:"UpdatedAt" db:"updated_at"`
+	UserID       string        `json:"UserID" db:"user_id"`
+}
+
+// SubtaskCount is the progress of a todo's subtasks, such as 3 of 5 done.
+type SubtaskCount struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
 }
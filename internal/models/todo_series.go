@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+/*
+TodoSeries is a recurring todo: an RFC 5545 RRULE evaluated from DTStart
+in TimeZone.
+
+Only the next open occurrence exists as a ToDo. Completing or skipping it
+creates the one after, until the rule has no more occurrences and the
+series ends.
+*/
+type TodoSeries struct {
+	ID               string        `json:"id" db:"id"`
+	UserID           string        `json:"user_id" db:"user_id"`
+	Title            string        `json:"title" db:"title"`
+	RRule            string        `json:"rrule" db:"rrule"`
+	DTStart          CalendarTime  `json:"dtstart" db:"dtstart"`
+	TimeZone         string        `json:"time_zone" db:"time_zone"`
+	LastRecurrenceID *CalendarTime `json:"last_recurrence_id" db:"last_recurrence_id"`
+	EndedAt          *time.Time    `json:"ended_at" db:"ended_at"`
+	CreatedAt        time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at" db:"updated_at"`
+}
@@ -2,10 +2,33 @@ package models
 
 import "time"
 
+// Roles a user can have. Admins can manage other users through /admin.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// DefaultTimeZone is the time zone of users who have not chosen one.
+const DefaultTimeZone = "UTC"
+
 type User struct {
-	ID        string    `json:"id" db:"id"`
-	Email     string    `json:"email" db:"email"`
-	Password  string    `json:"-" db:"password"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID                    string     `json:"id" db:"id"`
+	Email                 string     `json:"email" db:"email"`
+	Password              string     `json:"-" db:"password"`
+	DisplayName           *string    `json:"display_name" db:"display_name"`
+	TimeZone              string     `json:"time_zone" db:"time_zone"`
+	Role                  string     `json:"role" db:"role"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	DisabledAt            *time.Time `json:"disabled_at" db:"disabled_at"`
+	PasswordResetRequired bool       `json:"password_reset_required" db:"password_reset_required"`
+	DeletedAt             *time.Time `json:"deleted_at" db:"deleted_at"`
+	CreatedAt             time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// UserWithTodoCounts is a user as seen by admins, with their todo counts.
+type UserWithTodoCounts struct {
+	User
+	TodoCount          int `json:"todo_count"`
+	CompletedTodoCount int `json:"completed_todo_count"`
 }
@@ -0,0 +1,29 @@
+package notify
+
+import (
+	"context"
+	"todos_api/internal/mail"
+	"todos_api/internal/models"
+)
+
+// EmailNotifier sends reminders by email to the owner of the todo.
+type EmailNotifier struct {
+	mailer  mail.Mailer
+	baseURL string
+}
+
+func NewEmailNotifier(mailer mail.Mailer, baseURL string) *EmailNotifier {
+	return &EmailNotifier{mailer: mailer, baseURL: baseURL}
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, reminder *models.DueReminder) error {
+	subject, text := describe(reminder)
+
+	return n.mailer.Send(ctx, mail.Message{
+		To:      reminder.Email,
+		Subject: subject,
+		Body: text + "\n\n" +
+			todoLink(n.baseURL, reminder.TodoID) + "\n\n" +
+			"You get this email because you set a reminder on this todo.\n",
+	})
+}
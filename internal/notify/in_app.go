@@ -0,0 +1,31 @@
+package notify
+
+import (
+	"context"
+	"todos_api/internal/models"
+	"todos_api/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// InAppNotifier stores reminders as notifications the front end lists
+// under GET /me/notifications.
+type InAppNotifier struct {
+	pool *pgxpool.Pool
+}
+
+func NewInAppNotifier(pool *pgxpool.Pool) *InAppNotifier {
+	return &InAppNotifier{pool: pool}
+}
+
+func (n *InAppNotifier) Notify(ctx context.Context, reminder *models.DueReminder) error {
+	title, body := describe(reminder)
+
+	return repository.CreateNotification(n.pool, &models.Notification{
+		UserID:     reminder.UserID,
+		TodoID:     &reminder.TodoID,
+		ReminderID: &reminder.ID,
+		Title:      title,
+		Body:       body,
+	}, reminder.FireAt)
+}
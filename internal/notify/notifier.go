@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+	"todos_api/internal/config"
+	"todos_api/internal/mail"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+Notifier delivers a reminder through one channel.
+
+Implementations:
+  EmailNotifier   - Sends an email through the configured mail.Mailer
+                    (SMTP, or the local outbox in development)
+  WebhookNotifier - POSTs a signed JSON payload to the reminder's URL
+  InAppNotifier   - Stores a notification listed under GET /me/notifications
+
+Delivery is at least once: a reminder whose delivery fails or whose
+scheduler crashes is tried again, so implementations should tolerate
+duplicates (see WebhookNotifier's Idempotency-Key).
+*/
+type Notifier interface {
+	Notify(ctx context.Context, reminder *models.DueReminder) error
+}
+
+// Channels maps a reminder channel (models.ReminderChannel*) to the
+// Notifier that delivers it.
+type Channels map[string]Notifier
+
+// New builds the notifiers of every channel.
+func New(pool *pgxpool.Pool, cfg *config.Config, mailer mail.Mailer) Channels {
+	return Channels{
+		models.ReminderChannelEmail:   NewEmailNotifier(mailer, cfg.AppBaseURL),
+		models.ReminderChannelWebhook: NewWebhookNotifier(cfg.ReminderWebhookSecret, cfg.ReminderWebhookAllowPrivate),
+		models.ReminderChannelInApp:   NewInAppNotifier(pool),
+	}
+}
+
+// describe returns the title and text of a reminder, with the due date
+// written in the owner's time zone.
+func describe(reminder *models.DueReminder) (string, string) {
+	title := "Reminder: " + reminder.TodoTitle
+
+	if reminder.TodoDueAt == nil {
+		return title, fmt.Sprintf("%q is waiting for you.", reminder.TodoTitle)
+	}
+
+	if reminder.TodoDueAt.DateOnly {
+		return title, fmt.Sprintf("%q is due on %s.", reminder.TodoTitle, reminder.TodoDueAt.Time.Format("Mon, 2 Jan 2006"))
+	}
+
+	loc, err := time.LoadLocation(reminder.TimeZone)
+
+	if err != nil {
+		loc = time.UTC
+	}
+
+	return title, fmt.Sprintf("%q is due on %s.", reminder.TodoTitle, reminder.TodoDueAt.Time.In(loc).Format("Mon, 2 Jan 2006 at 15:04 MST"))
+}
+
+// todoLink returns the front end's page of a todo.
+func todoLink(baseURL string, todoID int) string {
+	return baseURL + "/todos/" + strconv.Itoa(todoID)
+}
@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+	"todos_api/internal/models"
+)
+
+// webhookTimeout bounds one webhook delivery, including the connection.
+const webhookTimeout = 10 * time.Second
+
+var errPrivateAddress = errors.New("webhook address is not publicly routable")
+
+/*
+WebhookNotifier POSTs reminders as JSON to the URL set on the reminder.
+
+Every request carries an Idempotency-Key that stays the same when a
+delivery is retried. With a secret configured, it is also signed:
+X-Reminder-Signature is "sha256=" followed by the hex HMAC-SHA256 of
+"<X-Reminder-Timestamp>.<body>".
+
+Webhook URLs are chosen by users, so unless allowPrivate is set the
+notifier refuses to connect to loopback, private and link-local
+addresses, whatever the host name resolves to. Redirects are not
+followed.
+*/
+type WebhookNotifier struct {
+	client *http.Client
+	secret []byte
+}
+
+// webhookPayload is the JSON body of a webhook delivery.
+type webhookPayload struct {
+	ReminderID string               `json:"reminder_id"`
+	TodoID     int                  `json:"todo_id"`
+	Title      string               `json:"title"`
+	DueAt      *models.CalendarTime `json:"due_at"`
+	FireAt     *time.Time           `json:"fire_at"`
+}
+
+func NewWebhookNotifier(secret string, allowPrivate bool) *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return errPrivateAddress
+			}
+
+			return nil
+		}
+	}
+
+	return &WebhookNotifier{
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext, Proxy: nil},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		secret: []byte(secret),
+	}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder *models.DueReminder) error {
+	if reminder.WebhookURL == nil {
+		return errors.New("reminder has no webhook URL")
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		ReminderID: reminder.ID,
+		TodoID:     reminder.TodoID,
+		Title:      reminder.TodoTitle,
+		DueAt:      reminder.TodoDueAt,
+		FireAt:     reminder.FireAt,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *reminder.WebhookURL, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	idempotencyKey := reminder.ID
+
+	if reminder.FireAt != nil {
+		idempotencyKey += ":" + strconv.FormatInt(reminder.FireAt.Unix(), 10)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todos-api-reminders")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	if len(n.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		mac := hmac.New(sha256.New, n.secret)
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+
+		req.Header.Set("X-Reminder-Timestamp", timestamp)
+		req.Header.Set("X-Reminder-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"todos_api/internal/models"
+)
+
+func webhookReminder(url string) *models.DueReminder {
+	fireAt := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	return &models.DueReminder{
+		Reminder: models.Reminder{
+			ID:         "reminder-1",
+			TodoID:     7,
+			Channel:    models.ReminderChannelWebhook,
+			WebhookURL: &url,
+			FireAt:     &fireAt,
+		},
+		TodoTitle: "Pay rent",
+	}
+}
+
+func TestWebhookSignsPayload(t *testing.T) {
+	var header http.Header
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	reminder := webhookReminder(server.URL)
+
+	if err := NewWebhookNotifier("webhook-secret", true).Notify(context.Background(), reminder); err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write([]byte(header.Get("X-Reminder-Timestamp") + "."))
+	mac.Write(body)
+
+	if got, want := header.Get("X-Reminder-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("X-Reminder-Signature = %q, want %q", got, want)
+	}
+
+	if got, want := header.Get("Idempotency-Key"), "reminder-1:1792141200"; got != want {
+		t.Errorf("Idempotency-Key = %q, want %q", got, want)
+	}
+
+	var payload webhookPayload
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.ReminderID != "reminder-1" || payload.TodoID != 7 || payload.Title != "Pay rent" {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestWebhookWithoutSecretIsNotSigned(t *testing.T) {
+	var header http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer server.Close()
+
+	if err := NewWebhookNotifier("", true).Notify(context.Background(), webhookReminder(server.URL)); err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Get("X-Reminder-Signature") != "" || header.Get("X-Reminder-Timestamp") != "" {
+		t.Errorf("unsigned webhook carries %q", header.Get("X-Reminder-Signature"))
+	}
+}
+
+func TestWebhookRejectsPrivateAddresses(t *testing.T) {
+	called := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier("webhook-secret", false)
+
+	urls := []string{
+		server.URL,
+		"http://10.0.0.1/hook",
+		"http://172.16.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://0.0.0.0/hook",
+	}
+
+	for _, url := range urls {
+		err := notifier.Notify(context.Background(), webhookReminder(url))
+
+		if !errors.Is(err, errPrivateAddress) {
+			t.Errorf("%s: err = %v, want %v", url, err, errPrivateAddress)
+		}
+	}
+
+	if called {
+		t.Error("the webhook reached a loopback address")
+	}
+}
+
+func TestWebhookDoesNotFollowRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the redirect was followed")
+	}))
+	defer target.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier("", true).Notify(context.Background(), webhookReminder(server.URL))
+
+	if err == nil || !strings.Contains(err.Error(), "302") {
+		t.Errorf("err = %v, want the redirect reported as a failure", err)
+	}
+}
+
+func TestWebhookErrorStatusFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookNotifier("", true).Notify(context.Background(), webhookReminder(server.URL)); err == nil {
+		t.Error("a 503 answer counted as delivered")
+	}
+}
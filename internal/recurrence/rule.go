@@ -0,0 +1,157 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/teambition/rrule-go"
+)
+
+// maxRuleLength bounds the RRULE text a user can store.
+const maxRuleLength = 512
+
+/*
+Rule is the RFC 5545 recurrence rule of a todo series, anchored at the
+series' DTSTART in the series' time zone.
+
+Occurrences of a timed series keep their wall-clock time in that zone, so
+a chore at 09:00 stays at 09:00 when daylight saving time starts or ends.
+Occurrences of an all-day series (a DTSTART without a time) are whole days.
+
+Only daily or coarser rules are accepted, and the time of day always comes
+from DTSTART: BYHOUR, BYMINUTE and BYSECOND are rejected.
+*/
+type Rule struct {
+	rrule  *rrule.RRule
+	text   string
+	allDay bool
+	loc    *time.Location
+}
+
+/*
+Parse validates an RRULE and anchors it.
+
+Parameters:
+  rule     - The RRULE value, e.g. "FREQ=WEEKLY;BYDAY=MO", with or
+             without the "RRULE:" prefix; DTSTART must not be part of it
+  dtstart  - First possible occurrence; a date for an all-day series
+  timeZone - IANA time zone the rule is evaluated in
+
+Returns:
+  *Rule - Parsed rule
+  error - Why the rule is not acceptable
+*/
+func Parse(rule string, dtstart models.CalendarTime, timeZone string) (*Rule, error) {
+	loc, err := time.LoadLocation(timeZone)
+
+	if err != nil || timeZone == "" || timeZone == "Local" {
+		return nil, fmt.Errorf("unknown time zone %q", timeZone)
+	}
+
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+
+	if rule == "" || len(rule) > maxRuleLength || strings.ContainsAny(rule, "\r\n") {
+		return nil, errors.New("rrule must be a single RRULE of at most 512 characters")
+	}
+
+	if strings.Contains(strings.ToUpper(rule), "DTSTART") {
+		return nil, errors.New("rrule must not contain DTSTART, use the dtstart field")
+	}
+
+	// An all-day series runs on dates, which carry no zone; UNTIL is
+	// then read as a date too.
+	untilLoc := loc
+
+	if dtstart.DateOnly {
+		untilLoc = time.UTC
+	}
+
+	options, err := rrule.StrToROptionInLocation(rule, untilLoc)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid rrule: %v", err)
+	}
+
+	switch options.Freq {
+	case rrule.DAILY, rrule.WEEKLY, rrule.MONTHLY, rrule.YEARLY:
+	default:
+		return nil, errors.New("rrule FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY")
+	}
+
+	if len(options.Byhour) > 0 || len(options.Byminute) > 0 || len(options.Bysecond) > 0 {
+		return nil, errors.New("rrule must not use BYHOUR, BYMINUTE or BYSECOND; the time comes from dtstart")
+	}
+
+	text := options.RRuleString()
+
+	// The rule is expanded on wall-clock times written as UTC and only
+	// placed in loc afterwards. rrule-go builds each day at midnight in
+	// the rule's location, so where midnight does not exist it would
+	// land on the day before and skip the real one.
+	options.Dtstart = dtstart.Time
+
+	if !dtstart.DateOnly {
+		options.Dtstart = wallClock(dtstart.Time.In(loc))
+
+		if !options.Until.IsZero() {
+			options.Until = wallClock(options.Until.In(loc))
+		}
+	}
+
+	parsed, err := rrule.NewRRule(*options)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid rrule: %v", err)
+	}
+
+	return &Rule{rrule: parsed, text: text, allDay: dtstart.DateOnly, loc: loc}, nil
+}
+
+// String returns the rule in normalized form, without DTSTART.
+func (r *Rule) String() string {
+	return r.text
+}
+
+// First returns the first occurrence, or nil if the rule has none.
+func (r *Rule) First() *models.CalendarTime {
+	return r.occurrence(r.rrule.After(r.rrule.GetDTStart(), true))
+}
+
+// After returns the first occurrence after the given one, or nil once
+// the series is over.
+func (r *Rule) After(occurrence models.CalendarTime) *models.CalendarTime {
+	if r.allDay {
+		return r.occurrence(r.rrule.After(occurrence.Time, false))
+	}
+
+	return r.occurrence(r.rrule.After(wallClock(occurrence.Time.In(r.loc)), false))
+}
+
+// FirstFrom returns the first occurrence on the day of t, in the series'
+// time zone, or later; nil if there is none.
+func (r *Rule) FirstFrom(t time.Time) *models.CalendarTime {
+	year, month, day := t.In(r.loc).Date()
+
+	return r.occurrence(r.rrule.After(time.Date(year, month, day, 0, 0, 0, 0, time.UTC), true))
+}
+
+func (r *Rule) occurrence(t time.Time) *models.CalendarTime {
+	if t.IsZero() {
+		return nil
+	}
+
+	if r.allDay {
+		return &models.CalendarTime{Time: time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), DateOnly: true}
+	}
+
+	// A time skipped by daylight saving time moves forward by the gap.
+	return &models.CalendarTime{Time: time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, r.loc).UTC()}
+}
+
+// wallClock returns the date and time t shows on its clock, as if in UTC.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
@@ -0,0 +1,244 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+	"todos_api/internal/models"
+)
+
+func calendarTime(t *testing.T, value string) models.CalendarTime {
+	t.Helper()
+
+	parsed, err := models.ParseCalendarTime(value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed
+}
+
+// occurrences returns the first n occurrences of a rule as strings.
+func occurrences(rule *Rule, n int) []string {
+	var result []string
+
+	for next := rule.First(); next != nil && len(result) < n; next = rule.After(*next) {
+		result = append(result, next.String())
+	}
+
+	return result
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule       string
+		dtstart    string
+		timeZone   string
+		normalized string
+		first      []string
+	}{
+		{
+			"FREQ=WEEKLY;BYDAY=MO,TH", "2026-10-15T09:00:00+02:00", "Europe/Berlin",
+			"FREQ=WEEKLY;BYDAY=MO,TH",
+			[]string{"2026-10-15T07:00:00Z", "2026-10-19T07:00:00Z", "2026-10-22T07:00:00Z"},
+		},
+		{
+			"RRULE:FREQ=MONTHLY;BYMONTHDAY=-1", "2026-01-31", "America/New_York",
+			"FREQ=MONTHLY;BYMONTHDAY=-1",
+			[]string{"2026-01-31", "2026-02-28", "2026-03-31"},
+		},
+		{
+			" FREQ=DAILY;INTERVAL=2;COUNT=3 ", "2026-10-16", "UTC",
+			"FREQ=DAILY;INTERVAL=2;COUNT=3",
+			[]string{"2026-10-16", "2026-10-18", "2026-10-20"},
+		},
+		{
+			// UNTIL of an all-day series is a date and includes that day.
+			"FREQ=DAILY;UNTIL=20261018", "2026-10-16", "Asia/Tokyo",
+			"FREQ=DAILY;UNTIL=20261018T000000Z",
+			[]string{"2026-10-16", "2026-10-17", "2026-10-18"},
+		},
+		{
+			// DTSTART is the first possible occurrence, not necessarily one.
+			"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "2026-10-16", "UTC",
+			"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29",
+			[]string{"2028-02-29", "2032-02-29"},
+		},
+	}
+
+	for _, test := range tests {
+		rule, err := Parse(test.rule, calendarTime(t, test.dtstart), test.timeZone)
+
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.rule, err)
+			continue
+		}
+
+		if got := rule.String(); got != test.normalized {
+			t.Errorf("Parse(%q).String() = %q, want %q", test.rule, got, test.normalized)
+		}
+
+		if got := occurrences(rule, len(test.first)); strings.Join(got, " ") != strings.Join(test.first, " ") {
+			t.Errorf("Parse(%q) occurs on %v, want %v", test.rule, got, test.first)
+		}
+	}
+}
+
+func TestCountAndUntilEndSeries(t *testing.T) {
+	tests := []struct {
+		rule     string
+		dtstart  string
+		timeZone string
+		count    int
+	}{
+		{"FREQ=DAILY;COUNT=2", "2026-10-16T09:00:00Z", "UTC", 2},
+		{"FREQ=WEEKLY;COUNT=3", "2026-10-16", "Europe/Berlin", 3},
+		// 09:00 on the 26th in Berlin, after summer time ended.
+		{"FREQ=DAILY;UNTIL=20261026T090000", "2026-10-24T09:00:00+02:00", "Europe/Berlin", 3},
+		{"FREQ=DAILY;UNTIL=20261026T075959Z", "2026-10-24T09:00:00+02:00", "Europe/Berlin", 2},
+	}
+
+	for _, test := range tests {
+		rule, err := Parse(test.rule, calendarTime(t, test.dtstart), test.timeZone)
+
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", test.rule, err)
+		}
+
+		if got := occurrences(rule, 10); len(got) != test.count {
+			t.Errorf("Parse(%q) occurs on %v, want %d occurrences", test.rule, got, test.count)
+		}
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	dtstart := models.CalendarTime{Time: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name     string
+		rule     string
+		timeZone string
+	}{
+		{"hourly", "FREQ=HOURLY", "UTC"},
+		{"every minute", "FREQ=MINUTELY;INTERVAL=5", "UTC"},
+		{"every second", "FREQ=SECONDLY", "UTC"},
+		{"time from BYHOUR", "FREQ=DAILY;BYHOUR=9,17", "UTC"},
+		{"time from BYMINUTE", "FREQ=DAILY;BYMINUTE=30", "UTC"},
+		{"time from BYSECOND", "FREQ=DAILY;BYSECOND=1", "UTC"},
+		{"DTSTART in the rule", "DTSTART:20261016T090000Z\nRRULE:FREQ=DAILY", "UTC"},
+		{"DTSTART on one line", "FREQ=DAILY;DTSTART=20261016T090000Z", "UTC"},
+		{"several lines", "FREQ=DAILY\r\nRRULE:FREQ=WEEKLY", "UTC"},
+		{"too long", "FREQ=DAILY;BYMONTHDAY=" + strings.Repeat("1,", 300) + "1", "UTC"},
+		{"empty", "", "UTC"},
+		{"prefix only", "RRULE:", "UTC"},
+		{"no FREQ", "BYDAY=MO", "UTC"},
+		{"unknown FREQ", "FREQ=FORTNIGHTLY", "UTC"},
+		{"unknown part", "FREQ=DAILY;EVERY=2", "UTC"},
+		{"bad BYDAY", "FREQ=WEEKLY;BYDAY=XX", "UTC"},
+		{"bad UNTIL", "FREQ=DAILY;UNTIL=tomorrow", "UTC"},
+		{"not a rule", "every monday", "UTC"},
+		{"unknown time zone", "FREQ=DAILY", "Mars/Olympus_Mons"},
+		{"no time zone", "FREQ=DAILY", ""},
+		{"server time zone", "FREQ=DAILY", "Local"},
+	}
+
+	for _, test := range tests {
+		if rule, err := Parse(test.rule, dtstart, test.timeZone); err == nil {
+			t.Errorf("%s: Parse(%q, %q) = %s, want an error", test.name, test.rule, test.timeZone, rule)
+		}
+	}
+}
+
+func TestOccurrencesKeepWallClockTimeAcrossDST(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		dtstart  string
+		timeZone string
+		want     []string
+	}{
+		{
+			"daily over the start of summer time", "FREQ=DAILY", "2026-03-28T09:00:00+01:00", "Europe/Berlin",
+			[]string{"2026-03-28T08:00:00Z", "2026-03-29T07:00:00Z", "2026-03-30T07:00:00Z"},
+		},
+		{
+			"daily over the end of summer time", "FREQ=DAILY", "2026-10-24T09:00:00+02:00", "Europe/Berlin",
+			[]string{"2026-10-24T07:00:00Z", "2026-10-25T08:00:00Z", "2026-10-26T08:00:00Z"},
+		},
+		{
+			"weekly over the start of summer time", "FREQ=WEEKLY", "2026-03-01T18:30:00-05:00", "America/New_York",
+			[]string{"2026-03-01T23:30:00Z", "2026-03-08T22:30:00Z", "2026-03-15T22:30:00Z"},
+		},
+		{
+			"daily around a skipped midnight", "FREQ=DAILY", "2026-09-05T08:00:00-04:00", "America/Santiago",
+			[]string{"2026-09-05T12:00:00Z", "2026-09-06T11:00:00Z", "2026-09-07T11:00:00Z"},
+		},
+		{
+			"weekly on the day of a skipped midnight", "FREQ=WEEKLY;BYDAY=SU", "2026-08-30T08:00:00-04:00", "America/Santiago",
+			[]string{"2026-08-30T12:00:00Z", "2026-09-06T11:00:00Z", "2026-09-13T11:00:00Z"},
+		},
+		{
+			"time skipped by the change", "FREQ=DAILY", "2026-03-28T02:30:00+01:00", "Europe/Berlin",
+			[]string{"2026-03-28T01:30:00Z", "2026-03-29T01:30:00Z", "2026-03-30T00:30:00Z"},
+		},
+	}
+
+	for _, test := range tests {
+		rule, err := Parse(test.rule, calendarTime(t, test.dtstart), test.timeZone)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := occurrences(rule, len(test.want)); strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: occurrences = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAllDaySeriesIgnoresTimeZoneOffsets(t *testing.T) {
+	// Days stay days on both sides of the date line and across DST.
+	for _, timeZone := range []string{"Pacific/Kiritimati", "Pacific/Pago_Pago", "America/Santiago"} {
+		rule, err := Parse("FREQ=DAILY", calendarTime(t, "2026-09-05"), timeZone)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"2026-09-05", "2026-09-06", "2026-09-07"}
+
+		if got := occurrences(rule, 3); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: occurrences = %v, want %v", timeZone, got, want)
+		}
+	}
+}
+
+func TestFirstFrom(t *testing.T) {
+	loc, _ := time.LoadLocation("Europe/Berlin")
+	rule, err := Parse("FREQ=WEEKLY;BYDAY=MO", calendarTime(t, "2026-10-05T09:00:00+02:00"), "Europe/Berlin")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		from time.Time
+		want string
+	}{
+		// Later on the day of an occurrence still finds that occurrence.
+		{time.Date(2026, 10, 19, 23, 0, 0, 0, loc), "2026-10-19T07:00:00Z"},
+		{time.Date(2026, 10, 20, 0, 0, 0, 0, loc), "2026-10-26T08:00:00Z"},
+		// 23:30 UTC on Sunday is already Monday in Berlin.
+		{time.Date(2026, 10, 25, 23, 30, 0, 0, time.UTC), "2026-10-26T08:00:00Z"},
+	}
+
+	for _, test := range tests {
+		got := rule.FirstFrom(test.from)
+
+		if got == nil || got.String() != test.want {
+			t.Errorf("FirstFrom(%s) = %v, want %s", test.from, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrExportInProgress = errors.New("an export is already in progress")
+
+const dataExportColumns = `id, user_id, status, file_path, size_bytes, error, created_at, started_at, completed_at, expires_at`
+
+func scanDataExport(row pgx.Row) (*models.DataExport, error) {
+	var export models.DataExport
+
+	err := row.Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.FilePath,
+		&export.SizeBytes,
+		&export.Error,
+		&export.CreatedAt,
+		&export.StartedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+/*
+CreateDataExport queues a new export for a user.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - User whose data is exported
+
+Returns:
+  *models.DataExport - The pending export
+  error              - ErrExportInProgress if the user already has a
+                       pending or running export, or a database error
+*/
+func CreateDataExport(pool *pgxpool.Pool, userID string) (*models.DataExport, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO data_exports (user_id)
+	VALUES ($1)
+	RETURNING ` + dataExportColumns
+
+	export, err := scanDataExport(pool.QueryRow(ctx, query, userID))
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrExportInProgress
+		}
+
+		return nil, err
+	}
+
+	return export, nil
+}
+
+/*
+GetDataExport retrieves one of a user's exports.
+
+Returns:
+  *models.DataExport - Export if found
+  error              - pgx.ErrNoRows if it does not exist or belongs to
+                       someone else
+*/
+func GetDataExport(pool *pgxpool.Pool, id string, userID string) (*models.DataExport, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + dataExportColumns + `
+	FROM data_exports
+	WHERE id = $1 AND user_id = $2
+	`
+
+	return scanDataExport(pool.QueryRow(ctx, query, id, userID))
+}
+
+/*
+GetDataExportByID retrieves an export without an owner check. It is only
+used behind a signed download link, which already proves access.
+
+Returns:
+  *models.DataExport - Export if found
+  error              - pgx.ErrNoRows if it does not exist
+*/
+func GetDataExportByID(pool *pgxpool.Pool, id string) (*models.DataExport, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return scanDataExport(pool.QueryRow(ctx, `SELECT `+dataExportColumns+` FROM data_exports WHERE id = $1`, id))
+}
+
+/*
+GetDataExports lists a user's exports, newest first.
+
+Returns:
+  []models.DataExport - Exports
+  error               - Database error
+*/
+func GetDataExports(pool *pgxpool.Pool, userID string) ([]models.DataExport, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + dataExportColumns + `
+	FROM data_exports
+	WHERE user_id = $1
+	ORDER BY created_at DESC
+	`
+	rows, err := pool.Query(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var exports []models.DataExport = []models.DataExport{}
+
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		exports = append(exports, *export)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exports, nil
+}
+
+/*
+ClaimDataExport marks the oldest waiting export as running and returns it.
+
+Exports left "running" since before staleBefore are claimed again, so a
+crash in the middle of an export does not leave it stuck. FOR UPDATE SKIP
+LOCKED lets several workers claim exports concurrently without picking
+the same one.
+
+Returns:
+  *models.DataExport - Claimed export
+  error              - pgx.ErrNoRows if there is nothing to do
+*/
+func ClaimDataExport(pool *pgxpool.Pool, staleBefore time.Time) (*models.DataExport, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE data_exports
+	SET status = 'running', started_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT id FROM data_exports
+		WHERE status = 'pending' OR (status = 'running' AND started_at < $1)
+		ORDER BY created_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + dataExportColumns
+
+	return scanDataExport(pool.QueryRow(ctx, query, staleBefore))
+}
+
+/*
+CompleteDataExport records a finished export.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  id        - Export ID
+  filePath  - Location of the zip archive on disk
+  sizeBytes - Size of the archive
+  expiresAt - When the archive is deleted and the link stops working
+
+Returns:
+  error - Database error
+*/
+func CompleteDataExport(pool *pgxpool.Pool, id string, filePath string, sizeBytes int64, expiresAt time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE data_exports
+	SET status = 'completed', file_path = $2, size_bytes = $3, completed_at = CURRENT_TIMESTAMP, expires_at = $4
+	WHERE id = $1
+	`
+	_, err := pool.Exec(ctx, query, id, filePath, sizeBytes, expiresAt)
+
+	return err
+}
+
+/*
+FailDataExport records that an export could not be produced.
+
+Returns:
+  error - Database error
+*/
+func FailDataExport(pool *pgxpool.Pool, id string, message string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE data_exports
+	SET status = 'failed', error = $2, completed_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	`
+	_, err := pool.Exec(ctx, query, id, message)
+
+	return err
+}
+
+/*
+ExpireDataExports marks completed exports past their expiry as expired
+and returns the archive files that can now be deleted.
+
+Returns:
+  []string - Paths of the expired archives
+  error    - Database error
+*/
+func ExpireDataExports(pool *pgxpool.Pool) ([]string, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	WITH expired AS (
+		SELECT id, file_path FROM data_exports
+		WHERE status = 'completed' AND expires_at < CURRENT_TIMESTAMP
+		FOR UPDATE
+	)
+	UPDATE data_exports
+	SET status = 'expired', file_path = NULL
+	FROM expired
+	WHERE data_exports.id = expired.id
+	RETURNING expired.file_path
+	`
+	rows, err := pool.Query(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var paths []string
+
+	for rows.Next() {
+		var path *string
+
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+
+		if path != nil {
+			paths = append(paths, *path)
+		}
+	}
+
+	return paths, rows.Err()
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrVerificationTokenInvalid = errors.New("verification token is invalid or expired")
+var ErrEmailTaken = errors.New("email address is already registered")
+
+// Purposes of an email verification token. A "verify" token confirms the
+// address the account already has; a "change_email" token moves the
+// account to a new address once that address is confirmed.
+const (
+	VerificationPurposeVerify      = "verify"
+	VerificationPurposeChangeEmail = "change_email"
+)
+
+/*
+CreateEmailVerificationToken stores the hash of a new email verification
+token for the given address.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  userID    - Owner of the address
+  email     - Address the token verifies
+  purpose   - VerificationPurposeVerify or VerificationPurposeChangeEmail
+  tokenHash - SHA-256 hex digest of the raw token sent by email
+  expiresAt - Time after which the token can no longer be used
+
+Returns:
+  error - Database error
+*/
+func CreateEmailVerificationToken(pool *pgxpool.Pool, userID string, email string, purpose string, tokenHash string, expiresAt time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO email_verification_tokens (user_id, email, purpose, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := pool.Exec(ctx, query, userID, email, purpose, tokenHash, expiresAt)
+
+	return err
+}
+
+/*
+GetVerificationEmailStats returns how many verification emails were issued
+to a user since the given time, and when the latest one was issued.
+
+It backs the rate limit on resending verification emails.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - User ID
+  since  - Start of the counting window
+
+Returns:
+  int        - Number of tokens created since the given time
+  *time.Time - Creation time of the most recent token, or nil
+  error      - Database error
+*/
+func GetVerificationEmailStats(pool *pgxpool.Pool, userID string, since time.Time) (int, *time.Time, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT COUNT(*) FILTER (WHERE created_at >= $2), MAX(created_at)
+	FROM email_verification_tokens
+	WHERE user_id = $1
+	`
+	var count int
+	var lastSentAt *time.Time
+
+	err := pool.QueryRow(ctx, query, userID, since).Scan(&count, &lastSentAt)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return count, lastSentAt, nil
+}
+
+/*
+VerifyEmailWithToken consumes a verification token and marks the address
+as verified.
+
+This function runs in a single transaction and:
+  - Marks the token as used, but only if it is unused and unexpired
+  - For a "verify" token: sets users.email_verified_at if the user's
+    address still matches the one the token was issued for
+  - For a "change_email" token: moves the user to the new address and
+    marks it verified
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  tokenHash - Hash of the token presented by the client
+
+Returns:
+  string - ID of the verified user
+  error  - ErrVerificationTokenInvalid, ErrEmailTaken or a database error
+*/
+func VerifyEmailWithToken(pool *pgxpool.Pool, tokenHash string) (string, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var userID string
+	var email string
+	var purpose string
+
+	err = tx.QueryRow(ctx, `
+	UPDATE email_verification_tokens
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	RETURNING user_id, email, purpose
+	`, tokenHash).Scan(&userID, &email, &purpose)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrVerificationTokenInvalid
+		}
+
+		return "", err
+	}
+
+	var query string = `
+	UPDATE users
+	SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND email = $2
+	`
+
+	if purpose == VerificationPurposeChangeEmail {
+		query = `
+		UPDATE users
+		SET email = $2, email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+		`
+	}
+
+	commandTag, err := tx.Exec(ctx, query, userID, email)
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return "", ErrEmailTaken
+		}
+
+		return "", err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return "", ErrVerificationTokenInvalid
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
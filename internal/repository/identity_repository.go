@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrOIDCStateInvalid = errors.New("login state is invalid or expired")
+
+const userIdentityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func scanUserIdentity(row pgx.Row) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+/*
+CreateOIDCLoginState remembers a login that was sent to an identity
+provider. Expired states of abandoned logins are deleted on the way.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  stateHash - Hash of the state parameter sent to the provider
+  state     - PKCE verifier, nonce, requested scopes and session mode
+  expiresAt - When the login must be completed by
+
+Returns:
+  error - Database error
+*/
+func CreateOIDCLoginState(pool *pgxpool.Pool, stateHash string, state *models.OIDCLoginState, expiresAt time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := pool.Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return err
+	}
+
+	var query string = `
+	INSERT INTO oidc_login_states (state_hash, provider, code_verifier, nonce, scopes, session, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := pool.Exec(ctx, query, stateHash, state.Provider, state.CodeVerifier, state.Nonce, state.Scopes, state.Session, expiresAt)
+
+	return err
+}
+
+/*
+ConsumeOIDCLoginState returns and deletes a pending login, so each state
+can complete a login only once.
+
+Returns:
+  *models.OIDCLoginState - The pending login
+  error                  - ErrOIDCStateInvalid or a database error
+*/
+func ConsumeOIDCLoginState(pool *pgxpool.Pool, stateHash string) (*models.OIDCLoginState, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	DELETE FROM oidc_login_states
+	WHERE state_hash = $1
+	RETURNING provider, code_verifier, nonce, scopes, session, expires_at
+	`
+	var state models.OIDCLoginState
+	var expiresAt time.Time
+
+	err := pool.QueryRow(ctx, query, stateHash).Scan(&state.Provider, &state.CodeVerifier, &state.Nonce, &state.Scopes, &state.Session, &expiresAt)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOIDCStateInvalid
+		}
+
+		return nil, err
+	}
+
+	if time.Now().After(expiresAt) {
+		return nil, ErrOIDCStateInvalid
+	}
+
+	return &state, nil
+}
+
+/*
+GetUserByIdentity finds the user linked to an identity provider account.
+
+Parameters:
+  pool     - PostgreSQL connection pool
+  provider - Configured provider name
+  subject  - The provider's stable user ID ("sub" claim)
+
+Returns:
+  *models.User - Linked user
+  error        - pgx.ErrNoRows if the identity is not linked
+*/
+func GetUserByIdentity(pool *pgxpool.Pool, provider string, subject string) (*models.User, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + userColumns + `
+	FROM users
+	WHERE id = (SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2)
+	`
+
+	return scanUser(pool.QueryRow(ctx, query, provider, subject))
+}
+
+/*
+CreateUserIdentity links an identity provider account to an existing user.
+
+Returns:
+  error - Database error, including a unique violation if the identity is
+          already linked
+*/
+func CreateUserIdentity(pool *pgxpool.Pool, userID string, provider string, subject string, email string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+	VALUES ($1, $2, $3, NULLIF($4, ''), CURRENT_TIMESTAMP)
+	`
+	_, err := pool.Exec(ctx, query, userID, provider, subject, email)
+
+	return err
+}
+
+/*
+CreateUserWithIdentity creates an account for someone signing in through
+an identity provider for the first time, in a single transaction with the
+identity link.
+
+The email address is marked verified, since the provider vouched for it.
+
+Parameters:
+  pool         - PostgreSQL connection pool
+  email        - Verified email address from the provider
+  passwordHash - Hash of an unguessable password; the user can set a real
+                 one through the password reset flow
+  provider     - Configured provider name
+  subject      - The provider's stable user ID
+
+Returns:
+  *models.User - The new user
+  error        - ErrEmailTaken or a database error
+*/
+func CreateUserWithIdentity(pool *pgxpool.Pool, email string, passwordHash string, provider string, subject string) (*models.User, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	user, err := scanUser(tx.QueryRow(ctx, `
+	INSERT INTO users (email, password, email_verified_at)
+	VALUES ($1, $2, CURRENT_TIMESTAMP)
+	RETURNING `+userColumns, email, passwordHash))
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrEmailTaken
+		}
+
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+	INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+	VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+	`, user.ID, provider, subject, email)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+/*
+TouchUserIdentity records a login through an identity and the email
+address the provider currently reports for it.
+
+Returns:
+  error - Database error
+*/
+func TouchUserIdentity(pool *pgxpool.Pool, provider string, subject string, email string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE user_identities
+	SET last_login_at = CURRENT_TIMESTAMP, email = COALESCE(NULLIF($3, ''), email)
+	WHERE provider = $1 AND subject = $2
+	`
+	_, err := pool.Exec(ctx, query, provider, subject, email)
+
+	return err
+}
+
+/*
+GetUserIdentities lists the identity provider accounts linked to a user.
+
+Returns:
+  []models.UserIdentity - Linked identities, oldest first
+  error                 - Database error
+*/
+func GetUserIdentities(pool *pgxpool.Pool, userID string) ([]models.UserIdentity, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + userIdentityColumns + `
+	FROM user_identities
+	WHERE user_id = $1
+	ORDER BY created_at
+	`
+	rows, err := pool.Query(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var identities []models.UserIdentity = []models.UserIdentity{}
+
+	for rows.Next() {
+		identity, err := scanUserIdentity(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, *identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrImpersonationInactive = errors.New("impersonation has ended or its admin lost access")
+
+const impersonationColumns = `id, admin_id, user_id, reason, scopes, expires_at, ended_at, created_at`
+
+func scanImpersonation(row pgx.Row) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+
+	err := row.Scan(
+		&impersonation.ID,
+		&impersonation.AdminID,
+		&impersonation.UserID,
+		&impersonation.Reason,
+		&impersonation.Scopes,
+		&impersonation.ExpiresAt,
+		&impersonation.EndedAt,
+		&impersonation.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &impersonation, nil
+}
+
+/*
+CreateImpersonation records that an admin obtained an impersonation token.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  adminID   - Acting admin
+  userID    - Impersonated user
+  reason    - Why the admin needs to act as the user
+  scopes    - Scopes of the token
+  expiresAt - Expiry of the token
+
+Returns:
+  *models.Impersonation - Stored impersonation
+  error                 - Database error
+*/
+func CreateImpersonation(pool *pgxpool.Pool, adminID string, userID string, reason string, scopes []string, expiresAt time.Time) (*models.Impersonation, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO impersonations (admin_id, user_id, reason, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING ` + impersonationColumns
+
+	return scanImpersonation(pool.QueryRow(ctx, query, adminID, userID, reason, scopes, expiresAt))
+}
+
+/*
+GetImpersonations lists the impersonations of a user, newest first.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - Impersonated user
+  limit  - Maximum number of impersonations returned
+
+Returns:
+  []models.Impersonation - Impersonations
+  error                  - Database error
+*/
+func GetImpersonations(pool *pgxpool.Pool, userID string, limit int) ([]models.Impersonation, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + impersonationColumns + `
+	FROM impersonations
+	WHERE user_id = $1
+	ORDER BY created_at DESC
+	LIMIT $2
+	`
+	rows, err := pool.Query(ctx, query, userID, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var impersonations []models.Impersonation = []models.Impersonation{}
+
+	for rows.Next() {
+		impersonation, err := scanImpersonation(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		impersonations = append(impersonations, *impersonation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return impersonations, nil
+}
+
+/*
+EndImpersonation stops an impersonation before its token expires.
+
+Parameters:
+  pool - PostgreSQL connection pool
+  id   - Impersonation ID
+
+Returns:
+  error - pgx.ErrNoRows if there is no such running impersonation, or a
+          database error
+*/
+func EndImpersonation(pool *pgxpool.Pool, id string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE impersonations
+	SET ended_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND ended_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	`
+	commandTag, err := pool.Exec(ctx, query, id)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+/*
+RecordImpersonatedRequest writes the audit event of a request made with an
+impersonation token, before the request is handled.
+
+The event is only written while the impersonation is running and its admin
+is still an active admin, so ending the impersonation, demoting or
+disabling the admin stops the token at once.
+
+Parameters:
+  pool            - PostgreSQL connection pool
+  impersonationID - Impersonation the token belongs to
+  method          - HTTP method
+  path            - Request path and query, truncated to 2048 bytes
+  ipAddress       - Client IP address
+
+Returns:
+  int64 - Event ID, for CompleteImpersonatedRequest
+  error - ErrImpersonationInactive or a database error
+*/
+func RecordImpersonatedRequest(pool *pgxpool.Pool, impersonationID string, method string, path string, ipAddress string) (int64, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if len(path) > 2048 {
+		path = path[:2048]
+	}
+
+	var query string = `
+	INSERT INTO impersonation_audit_events (impersonation_id, method, path, ip_address)
+	SELECT i.id, $2, $3, NULLIF($4, '')
+	FROM impersonations i
+	JOIN users a ON a.id = i.admin_id
+	WHERE i.id = $1
+	AND i.ended_at IS NULL AND i.expires_at > CURRENT_TIMESTAMP
+	AND a.role = 'admin' AND a.disabled_at IS NULL AND a.deleted_at IS NULL
+	RETURNING id
+	`
+	var id int64
+
+	err := pool.QueryRow(ctx, query, impersonationID, method, path, ipAddress).Scan(&id)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrImpersonationInactive
+		}
+
+		return 0, err
+	}
+
+	return id, nil
+}
+
+/*
+CompleteImpersonatedRequest stores the response status of an audited
+request.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  id     - Event ID from RecordImpersonatedRequest
+  status - HTTP status of the response
+
+Returns:
+  error - Database error
+*/
+func CompleteImpersonatedRequest(pool *pgxpool.Pool, id int64, status int) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE impersonation_audit_events
+	SET status = $1
+	WHERE id = $2
+	`
+	_, err := pool.Exec(ctx, query, status, id)
+
+	return err
+}
+
+/*
+GetImpersonationAuditEvents lists the requests made during an
+impersonation, oldest first.
+
+Parameters:
+  pool            - PostgreSQL connection pool
+  impersonationID - Impersonation ID
+  limit           - Maximum number of events returned
+  offset          - Number of events skipped
+
+Returns:
+  []models.ImpersonationAuditEvent - Events
+  error                            - Database error
+*/
+func GetImpersonationAuditEvents(pool *pgxpool.Pool, impersonationID string, limit int, offset int) ([]models.ImpersonationAuditEvent, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT id, impersonation_id, method, path, status, ip_address, created_at
+	FROM impersonation_audit_events
+	WHERE impersonation_id = $1
+	ORDER BY id
+	LIMIT $2 OFFSET $3
+	`
+	rows, err := pool.Query(ctx, query, impersonationID, limit, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var events []models.ImpersonationAuditEvent = []models.ImpersonationAuditEvent{}
+
+	for rows.Next() {
+		var event models.ImpersonationAuditEvent
+
+		err := rows.Scan(
+			&event.ID,
+			&event.ImpersonationID,
+			&event.Method,
+			&event.Path,
+			&event.Status,
+			&event.IPAddress,
+			&event.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
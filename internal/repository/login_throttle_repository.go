@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+ReserveLoginAttempt counts an attempt against a throttle key before its
+credentials are checked, unless the key is blocked.
+
+The upsert locks the key's row, so concurrent attempts on the same key
+are counted one after the other and each sees its own count. Failures
+older than windowStart are forgotten: the counter starts over at one
+instead of being incremented.
+
+Parameters:
+  pool        - PostgreSQL connection pool
+  key         - Throttle key, e.g. "account:user@example.com"
+  windowStart - Attempts before this time no longer count
+
+Returns:
+  int        - Number of attempts in the current window, including this
+               one; not incremented if the key is blocked
+  *time.Time - End of the key's active block, or nil if it is not
+               blocked and the attempt was counted
+  error      - Database error
+*/
+func ReserveLoginAttempt(pool *pgxpool.Pool, key string, windowStart time.Time) (int, *time.Time, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO login_throttles AS lt (key, failed_attempts, last_failed_at)
+	VALUES ($1, 1, CURRENT_TIMESTAMP)
+	ON CONFLICT (key) DO UPDATE
+	SET failed_attempts = CASE
+			WHEN lt.blocked_until > CURRENT_TIMESTAMP THEN lt.failed_attempts
+			WHEN lt.last_failed_at < $2 THEN 1
+			ELSE lt.failed_attempts + 1
+		END,
+		last_failed_at = CASE
+			WHEN lt.blocked_until > CURRENT_TIMESTAMP THEN lt.last_failed_at
+			ELSE CURRENT_TIMESTAMP
+		END
+	RETURNING failed_attempts, CASE WHEN blocked_until > CURRENT_TIMESTAMP THEN blocked_until END
+	`
+	var attempts int
+	var blockedUntil *time.Time
+
+	err := pool.QueryRow(ctx, query, key, windowStart).Scan(&attempts, &blockedUntil)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return attempts, blockedUntil, nil
+}
+
+/*
+ReleaseLoginAttempt takes back an attempt counted by ReserveLoginAttempt
+that turned out not to be a failure.
+
+Returns:
+  error - Database error
+*/
+func ReleaseLoginAttempt(pool *pgxpool.Pool, key string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE login_throttles
+	SET failed_attempts = GREATEST(failed_attempts - 1, 0)
+	WHERE key = $1
+	`
+	_, err := pool.Exec(ctx, query, key)
+
+	return err
+}
+
+/*
+BlockLogin blocks a throttle key until the given time. An existing longer
+block is kept.
+
+Returns:
+  error - Database error
+*/
+func BlockLogin(pool *pgxpool.Pool, key string, until time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE login_throttles
+	SET blocked_until = GREATEST(COALESCE(blocked_until, $2), $2)
+	WHERE key = $1
+	`
+	_, err := pool.Exec(ctx, query, key, until)
+
+	return err
+}
+
+/*
+ClearLoginThrottle forgets all failures and blocks of a throttle key.
+
+Returns:
+  bool  - true if the key was blocked at the time it was cleared
+  error - Database error
+*/
+func ClearLoginThrottle(pool *pgxpool.Pool, key string) (bool, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	DELETE FROM login_throttles
+	WHERE key = $1
+	RETURNING blocked_until IS NOT NULL AND blocked_until > CURRENT_TIMESTAMP
+	`
+	var wasBlocked bool
+
+	err := pool.QueryRow(ctx, query, key).Scan(&wasBlocked)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return wasBlocked, nil
+}
+
+/*
+DeleteStaleLoginThrottles removes throttle rows whose last failure is
+older than the given time and that are no longer blocked.
+
+Returns:
+  int64 - Number of rows removed
+  error - Database error
+*/
+func DeleteStaleLoginThrottles(pool *pgxpool.Pool, before time.Time) (int64, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	DELETE FROM login_throttles
+	WHERE last_failed_at < $1
+	AND (blocked_until IS NULL OR blocked_until < CURRENT_TIMESTAMP)
+	`
+	commandTag, err := pool.Exec(ctx, query, before)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return commandTag.RowsAffected(), nil
+}
+
+/*
+CreateLockoutEvent records a lockout or unlock.
+
+Parameters:
+  pool  - PostgreSQL connection pool
+  event - Event with Key, Event and the optional UserID, IPAddress,
+          LockedUntil and ActorID set
+
+Returns:
+  error - Database error
+*/
+func CreateLockoutEvent(pool *pgxpool.Pool, event *models.LockoutEvent) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO lockout_events (key, user_id, event, ip_address, locked_until, actor_id)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := pool.Exec(ctx, query,
+		event.Key,
+		event.UserID,
+		event.Event,
+		event.IPAddress,
+		event.LockedUntil,
+		event.ActorID,
+	)
+
+	return err
+}
+
+/*
+GetLockoutEvents lists the lockout events of a user, newest first.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - User ID
+  limit  - Maximum number of events returned
+
+Returns:
+  []models.LockoutEvent - Events
+  error                 - Database error
+*/
+func GetLockoutEvents(pool *pgxpool.Pool, userID string, limit int) ([]models.LockoutEvent, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT id, key, user_id, event, ip_address, locked_until, actor_id, created_at
+	FROM lockout_events
+	WHERE user_id = $1
+	ORDER BY created_at DESC
+	LIMIT $2
+	`
+	rows, err := pool.Query(ctx, query, userID, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var events []models.LockoutEvent = []models.LockoutEvent{}
+
+	for rows.Next() {
+		var event models.LockoutEvent
+
+		err := rows.Scan(
+			&event.ID,
+			&event.Key,
+			&event.UserID,
+			&event.Event,
+			&event.IPAddress,
+			&event.LockedUntil,
+			&event.ActorID,
+			&event.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
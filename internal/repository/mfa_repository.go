@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+SavePendingTOTP stores a new, unconfirmed TOTP secret for a user.
+
+Starting enrollment again before confirming replaces the pending secret.
+An already confirmed secret is never overwritten; it must be disabled
+first.
+
+Parameters:
+  pool             - PostgreSQL connection pool
+  userID           - User enrolling
+  secretCiphertext - TOTP secret encrypted with auth.SecretBox
+
+Returns:
+  bool  - false if the user already has confirmed TOTP
+  error - Database error
+*/
+func SavePendingTOTP(pool *pgxpool.Pool, userID string, secretCiphertext []byte) (bool, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO user_totp (user_id, secret_ciphertext)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret_ciphertext = EXCLUDED.secret_ciphertext, created_at = CURRENT_TIMESTAMP, last_used_step = NULL
+	WHERE user_totp.confirmed_at IS NULL
+	`
+	commandTag, err := pool.Exec(ctx, query, userID, secretCiphertext)
+
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+/*
+GetTOTP returns the user's TOTP enrollment, pending or confirmed.
+
+Returns:
+  *models.UserTOTP - Enrollment record
+  error            - pgx.ErrNoRows if the user never enrolled
+*/
+func GetTOTP(pool *pgxpool.Pool, userID string) (*models.UserTOTP, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT user_id, secret_ciphertext, confirmed_at, last_used_step, created_at
+	FROM user_totp
+	WHERE user_id = $1
+	`
+	var totp models.UserTOTP
+
+	err := pool.QueryRow(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.SecretCiphertext,
+		&totp.ConfirmedAt,
+		&totp.LastUsedStep,
+		&totp.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+/*
+ConfirmTOTP activates a pending TOTP enrollment and replaces the user's
+recovery codes, in a single transaction.
+
+Parameters:
+  pool       - PostgreSQL connection pool
+  userID     - User confirming enrollment
+  step       - Time step of the code used to confirm (marked as used)
+  codeHashes - Hashes of the freshly generated recovery codes
+
+Returns:
+  error - Database error
+*/
+func ConfirmTOTP(pool *pgxpool.Pool, userID string, step int64, codeHashes []string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+	UPDATE user_totp
+	SET confirmed_at = CURRENT_TIMESTAMP, last_used_step = $2
+	WHERE user_id = $1
+	`, userID, step)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(ctx, `
+		INSERT INTO mfa_recovery_codes (user_id, code_hash)
+		VALUES ($1, $2)
+		`, userID, codeHash)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+/*
+UseTOTPStep records that the code for a time step has been used.
+
+Returns false if the same or a later step was already used, which means
+the code is being replayed and must be rejected.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - User ID
+  step   - Time step the submitted code matched
+
+Returns:
+  bool  - true if the step was accepted
+  error - Database error
+*/
+func UseTOTPStep(pool *pgxpool.Pool, userID string, step int64) (bool, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE user_totp
+	SET last_used_step = $2
+	WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)
+	`
+	commandTag, err := pool.Exec(ctx, query, userID, step)
+
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+/*
+UseRecoveryCode consumes one of the user's recovery codes.
+
+Parameters:
+  pool     - PostgreSQL connection pool
+  userID   - User ID
+  codeHash - Hash of the code entered by the user
+
+Returns:
+  bool  - true if an unused matching code existed and is now used
+  error - Database error
+*/
+func UseRecoveryCode(pool *pgxpool.Pool, userID string, codeHash string) (bool, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE mfa_recovery_codes
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	commandTag, err := pool.Exec(ctx, query, userID, codeHash)
+
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+/*
+DeleteTOTP removes the user's TOTP enrollment and recovery codes.
+
+Returns:
+  error - Database error
+*/
+func DeleteTOTP(pool *pgxpool.Pool, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const notificationColumns = `id, user_id, todo_id, reminder_id, title, body, read_at, created_at`
+
+func scanNotification(row pgx.Row) (*models.Notification, error) {
+	var notification models.Notification
+
+	err := row.Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.TodoID,
+		&notification.ReminderID,
+		&notification.Title,
+		&notification.Body,
+		&notification.ReadAt,
+		&notification.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+/*
+CreateNotification stores an in-app notification.
+
+A reminder that is delivered twice for the same fire time, because the
+scheduler retried after an error, is only stored once.
+
+Parameters:
+  pool         - PostgreSQL connection pool
+  notification - Notification with UserID, Title, Body and optionally
+                 TodoID and ReminderID
+  fireAt       - Fire time of the reminder, if any
+
+Returns:
+  error - Database error
+*/
+func CreateNotification(pool *pgxpool.Pool, notification *models.Notification, fireAt *time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO notifications (user_id, todo_id, reminder_id, fire_at, title, body)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (reminder_id, fire_at) DO NOTHING
+	`
+	_, err := pool.Exec(ctx, query,
+		notification.UserID,
+		notification.TodoID,
+		notification.ReminderID,
+		fireAt,
+		notification.Title,
+		notification.Body,
+	)
+
+	return err
+}
+
+/*
+GetNotifications lists a user's in-app notifications, newest first.
+
+Parameters:
+  pool       - PostgreSQL connection pool
+  userID     - Owner user ID
+  unreadOnly - Leave out notifications that have been read
+  limit      - Maximum number of notifications returned
+  offset     - Number of notifications skipped
+
+Returns:
+  []models.Notification - Notifications
+  error                 - Database error
+*/
+func GetNotifications(pool *pgxpool.Pool, userID string, unreadOnly bool, limit int, offset int) ([]models.Notification, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + notificationColumns + `
+	FROM notifications
+	WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+	ORDER BY created_at DESC
+	LIMIT $3 OFFSET $4
+	`
+	rows, err := pool.Query(ctx, query, userID, unreadOnly, limit, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var notifications []models.Notification = []models.Notification{}
+
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, *notification)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+/*
+MarkNotificationRead marks one of a user's notifications as read.
+
+Returns:
+  error - pgx.ErrNoRows if there is no such notification, or a database
+          error
+
+Security:
+  Uses BOTH id AND user_id so users can only mark their own notifications.
+*/
+func MarkNotificationRead(pool *pgxpool.Pool, id string, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE notifications
+	SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+	WHERE id = $1 AND user_id = $2
+	`
+	commandTag, err := pool.Exec(ctx, query, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrPasswordResetTokenInvalid = errors.New("password reset token is invalid or expired")
+
+/*
+CreatePasswordResetToken stores the hash of a new password reset token.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  userID    - User requesting the reset
+  tokenHash - SHA-256 hex digest of the raw token sent by email
+  expiresAt - Time after which the token can no longer be used
+
+Returns:
+  error - Database error
+
+Security:
+  Only the hash is stored, so the raw token in the email is the only copy.
+*/
+func CreatePasswordResetToken(pool *pgxpool.Pool, userID string, tokenHash string, expiresAt time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+	VALUES ($1, $2, $3)
+	`
+	_, err := pool.Exec(ctx, query, userID, tokenHash, expiresAt)
+
+	return err
+}
+
+/*
+GetPasswordResetTokenEmail returns the email address of the account a
+valid reset token belongs to, without consuming the token. It lets the
+new password be checked against the address before the reset.
+
+Returns:
+  string - Email address of the user
+  error  - ErrPasswordResetTokenInvalid or a database error
+*/
+func GetPasswordResetTokenEmail(pool *pgxpool.Pool, tokenHash string) (string, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT u.email
+	FROM password_reset_tokens t
+	JOIN users u ON u.id = t.user_id
+	WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > CURRENT_TIMESTAMP
+	`
+	var email string
+
+	err := pool.QueryRow(ctx, query, tokenHash).Scan(&email)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrPasswordResetTokenInvalid
+		}
+
+		return "", err
+	}
+
+	return email, nil
+}
+
+/*
+ResetPasswordWithToken consumes a reset token and sets a new password.
+
+This function runs in a single transaction and:
+  - Marks the token as used, but only if it is unused and unexpired
+  - Updates the user's password hash and clears a forced reset
+  - Invalidates every other outstanding reset token for the user
+
+Parameters:
+  pool         - PostgreSQL connection pool
+  tokenHash    - Hash of the token presented by the client
+  passwordHash - Already hashed new password
+
+Returns:
+  string - ID of the user whose password was reset
+  error  - ErrPasswordResetTokenInvalid or a database error
+
+Security:
+  The conditional UPDATE makes each token single use even when the same
+  link is submitted concurrently.
+*/
+func ResetPasswordWithToken(pool *pgxpool.Pool, tokenHash string, passwordHash string) (string, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var userID string
+
+	err = tx.QueryRow(ctx, `
+	UPDATE password_reset_tokens
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	RETURNING user_id
+	`, tokenHash).Scan(&userID)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrPasswordResetTokenInvalid
+		}
+
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE users
+	SET password = $1, password_reset_required = FALSE, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $2
+	`, passwordHash, userID)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE password_reset_tokens
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const personalAccessTokenColumns = `id, user_id, name, token_prefix, token_hash, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scanPersonalAccessToken(row pgx.Row) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.TokenPrefix,
+		&token.TokenHash,
+		&token.Scopes,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+/*
+CreatePersonalAccessToken stores a new personal access token.
+
+Parameters:
+  pool  - PostgreSQL connection pool
+  token - Token with UserID, Name, TokenPrefix, TokenHash, Scopes and
+          optional ExpiresAt set
+
+Returns:
+  *models.PersonalAccessToken - Stored token including generated fields
+  error                       - Database error
+
+Security:
+  Only the hash of the token is stored.
+*/
+func CreatePersonalAccessToken(pool *pgxpool.Pool, token *models.PersonalAccessToken) (*models.PersonalAccessToken, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO personal_access_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING ` + personalAccessTokenColumns
+
+	return scanPersonalAccessToken(pool.QueryRow(ctx, query,
+		token.UserID,
+		token.Name,
+		token.TokenPrefix,
+		token.TokenHash,
+		token.Scopes,
+		token.ExpiresAt,
+	))
+}
+
+/*
+GetActivePersonalAccessTokenByHash looks up a personal access token that
+is neither revoked nor expired and whose owner is neither disabled nor
+deleted.
+
+This is used by AuthMiddleware on every request authenticated with a
+personal access token.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  tokenHash - SHA-256 hex digest of the presented token
+
+Returns:
+  *models.PersonalAccessToken - Matching token
+  error                       - pgx.ErrNoRows if no active token matches
+*/
+func GetActivePersonalAccessTokenByHash(pool *pgxpool.Pool, tokenHash string) (*models.PersonalAccessToken, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + personalAccessTokenColumns + `
+	FROM personal_access_tokens
+	WHERE token_hash = $1
+	AND revoked_at IS NULL
+	AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+	AND user_id IN (SELECT id FROM users WHERE disabled_at IS NULL AND deleted_at IS NULL)
+	`
+
+	return scanPersonalAccessToken(pool.QueryRow(ctx, query, tokenHash))
+}
+
+/*
+GetPersonalAccessTokens lists a user's tokens that have not been revoked,
+newest first. Expired tokens are included so users can see and clean
+them up.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - Owner user ID
+
+Returns:
+  []models.PersonalAccessToken - The user's tokens
+  error                        - Database error
+*/
+func GetPersonalAccessTokens(pool *pgxpool.Pool, userID string) ([]models.PersonalAccessToken, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + personalAccessTokenColumns + `
+	FROM personal_access_tokens
+	WHERE user_id = $1 AND revoked_at IS NULL
+	ORDER BY created_at DESC
+	`
+	rows, err := pool.Query(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tokens []models.PersonalAccessToken = []models.PersonalAccessToken{}
+
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, *token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+/*
+RevokePersonalAccessToken revokes one of the user's tokens.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  id     - Token ID
+  userID - Owner user ID
+
+Returns:
+  error - nil if revoked, error if not found or on database failure
+
+Security:
+  Uses BOTH id AND user_id so users can only revoke their own tokens.
+*/
+func RevokePersonalAccessToken(pool *pgxpool.Pool, id string, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE personal_access_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+	commandTag, err := pool.Exec(ctx, query, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("Token with id: %v not found", id)
+	}
+
+	return nil
+}
+
+/*
+TouchPersonalAccessToken records that a token was just used.
+
+To avoid a write on every request, last_used_at is only updated when it
+is older than the given granularity.
+
+Parameters:
+  pool        - PostgreSQL connection pool
+  id          - Token ID
+  granularity - Minimum time between two updates
+
+Returns:
+  error - Database error
+*/
+func TouchPersonalAccessToken(pool *pgxpool.Pool, id string, granularity time.Duration) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE personal_access_tokens
+	SET last_used_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)
+	`
+	_, err := pool.Exec(ctx, query, id, time.Now().Add(-granularity))
+
+	return err
+}
@@ -0,0 +1,438 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrProjectArchived = errors.New("the project is archived")
+
+// projectColumns is the column list every project query returns, for the
+// projects table aliased as p.
+const projectColumns = `p.id, p.user_id, p.name, p.color, p.position, p.archived_at,
+	(SELECT COUNT(*) FROM todos t WHERE t.project_id = p.id),
+	(SELECT COUNT(*) FROM todos t WHERE t.project_id = p.id AND NOT t.completed),
+	p.created_at, p.updated_at`
+
+func scanProject(row pgx.Row) (*models.Project, error) {
+	var project models.Project
+
+	err := row.Scan(
+		&project.ID,
+		&project.UserID,
+		&project.Name,
+		&project.Color,
+		&project.Position,
+		&project.ArchivedAt,
+		&project.TodoCount,
+		&project.OpenCount,
+		&project.CreatedAt,
+		&project.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &project, nil
+}
+
+/*
+CreateProject adds a project for a user, after the user's other projects.
+
+Parameters:
+  pool    - PostgreSQL connection pool
+  project - Project with UserID, Name and optional Color
+
+Returns:
+  *models.Project - Stored project
+  error           - Database error
+*/
+func CreateProject(pool *pgxpool.Pool, project *models.Project) (*models.Project, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO projects AS p (user_id, name, color, position)
+	VALUES ($1, $2, $3, COALESCE((SELECT MAX(position) + 1 FROM projects WHERE user_id = $1), 0))
+	RETURNING ` + projectColumns
+
+	return scanProject(pool.QueryRow(ctx, query, project.UserID, project.Name, project.Color))
+}
+
+/*
+GetProjects lists the projects of a user in the user's order.
+
+Parameters:
+  pool            - PostgreSQL connection pool
+  userID          - Owner user ID
+  includeArchived - Whether archived projects are listed too
+
+Returns:
+  []models.Project - Projects with their todo counts
+  error            - Database error
+*/
+func GetProjects(pool *pgxpool.Pool, userID string, includeArchived bool) ([]models.Project, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + projectColumns + `
+	FROM projects p
+	WHERE p.user_id = $1 AND ($2 OR p.archived_at IS NULL)
+	ORDER BY p.position, LOWER(p.name)
+	`
+	rows, err := pool.Query(ctx, query, userID, includeArchived)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var projects []models.Project = []models.Project{}
+
+	for rows.Next() {
+		project, err := scanProject(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, *project)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+/*
+GetProject retrieves one of a user's projects.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  id     - Project ID
+  userID - Owner user ID
+
+Returns:
+  *models.Project - Project with its todo counts
+  error           - pgx.ErrNoRows if it does not exist or belongs to
+                    someone else
+
+Security:
+  Uses BOTH id AND user_id so users can only see their own projects.
+*/
+func GetProject(pool *pgxpool.Pool, id string, userID string) (*models.Project, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + projectColumns + `
+	FROM projects p
+	WHERE p.id = $1 AND p.user_id = $2
+	`
+
+	return scanProject(pool.QueryRow(ctx, query, id, userID))
+}
+
+/*
+GetInboxCounts counts the todos of a user that are in no project.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - Owner user ID
+
+Returns:
+  int   - Number of todos in the Inbox
+  int   - Number of those that are not completed
+  error - Database error
+*/
+func GetInboxCounts(pool *pgxpool.Pool, userID string) (int, int, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var todoCount, openCount int
+
+	err := pool.QueryRow(ctx, `
+	SELECT COUNT(*), COUNT(*) FILTER (WHERE NOT completed)
+	FROM todos
+	WHERE user_id = $1 AND project_id IS NULL
+	`, userID).Scan(&todoCount, &openCount)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return todoCount, openCount, nil
+}
+
+/*
+UpdateProject renames, recolors, archives or unarchives a project.
+
+Parameters:
+  pool     - PostgreSQL connection pool
+  id       - Project ID
+  userID   - Owner user ID
+  name     - New name, or nil to keep it
+  color    - New color; Set with a nil Value removes the color
+  archived - Whether the project is archived, or nil to keep it
+
+Returns:
+  *models.Project - Updated project
+  error           - pgx.ErrNoRows if the user has no such project, or a
+                    database error
+
+Security:
+  Uses BOTH id AND user_id so users can only change their own projects.
+*/
+func UpdateProject(pool *pgxpool.Pool, id string, userID string, name *string, color models.Nullable[string], archived *bool) (*models.Project, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Archiving an archived project keeps the time it was first archived.
+	var query string = `
+	UPDATE projects AS p
+	SET name = COALESCE($3, p.name),
+		color = CASE WHEN $4 THEN $5 ELSE p.color END,
+		archived_at = CASE
+			WHEN $6::boolean IS NULL THEN p.archived_at
+			WHEN $6 THEN COALESCE(p.archived_at, CURRENT_TIMESTAMP)
+		END,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE p.id = $1 AND p.user_id = $2
+	RETURNING ` + projectColumns
+
+	return scanProject(pool.QueryRow(ctx, query, id, userID, name, color.Set, color.Value, archived))
+}
+
+/*
+DeleteProject deletes a project. Its todos are kept and move to the Inbox.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  id     - Project ID
+  userID - Owner user ID
+
+Returns:
+  error - pgx.ErrNoRows if the user has no such project, or a database
+          error
+
+Security:
+  Uses BOTH id AND user_id so users can only delete their own projects.
+*/
+func DeleteProject(pool *pgxpool.Pool, id string, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	DELETE FROM projects
+	WHERE id = $1 AND user_id = $2
+	`
+	commandTag, err := pool.Exec(ctx, query, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+/*
+ReorderProjects sets the order of a user's projects. The listed projects
+come first, in the given order; projects left out follow in their
+previous order.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - Owner user ID
+  ids    - Project IDs in the new order, without duplicates
+
+Returns:
+  error - pgx.ErrNoRows if one of the IDs is not a project of the user, or
+          a database error
+*/
+func ReorderProjects(pool *pgxpool.Pool, userID string, ids []string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var owned int
+
+	err = tx.QueryRow(ctx, `
+	SELECT COUNT(*) FROM (
+		SELECT id FROM projects
+		WHERE user_id = $1
+		ORDER BY id
+		FOR UPDATE
+	) locked
+	WHERE id = ANY($2::uuid[])
+	`, userID, ids).Scan(&owned)
+
+	if err != nil {
+		return err
+	}
+
+	if owned != len(ids) {
+		return pgx.ErrNoRows
+	}
+
+	_, err = tx.Exec(ctx, `
+	WITH ordered AS (
+		SELECT p.id, ROW_NUMBER() OVER (ORDER BY x.ord NULLS LAST, p.position, LOWER(p.name)) - 1 AS position
+		FROM projects p
+		LEFT JOIN unnest($2::uuid[]) WITH ORDINALITY AS x(id, ord) ON x.id = p.id
+		WHERE p.user_id = $1
+	)
+	UPDATE projects
+	SET position = ordered.position
+	FROM ordered
+	WHERE projects.id = ordered.id AND projects.position <> ordered.position
+	`, userID, ids)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+/*
+CheckProject verifies that a project belongs to a user and can take
+todos.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  id     - Project ID
+  userID - Owner user ID
+
+Returns:
+  error - pgx.ErrNoRows if the user has no such project,
+          ErrProjectArchived if it is archived, or a database error
+*/
+func CheckProject(pool *pgxpool.Pool, id string, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var archived bool
+
+	err := pool.QueryRow(ctx, `
+	SELECT archived_at IS NOT NULL
+	FROM projects
+	WHERE id = $1 AND user_id = $2
+	`, id, userID).Scan(&archived)
+
+	if err != nil {
+		return err
+	}
+
+	if archived {
+		return ErrProjectArchived
+	}
+
+	return nil
+}
+
+/*
+MoveTodos moves todos of a user into a project or back to the Inbox, in
+one statement.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  userID    - Owner user ID
+  projectID - Target project, or nil for the Inbox
+  todoIDs   - ToDos to move
+
+Returns:
+  int64 - Number of todos moved
+  error - pgx.ErrNoRows if the user has no such project,
+          ErrProjectArchived if it is archived, or a database error
+
+Security:
+  Only the user's own todos are moved, into the user's own project.
+*/
+func MoveTodos(pool *pgxpool.Pool, userID string, projectID *string, todoIDs []int) (int64, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// The lock keeps the project from being archived or deleted while
+	// todos move into it.
+	if projectID != nil {
+		var archived bool
+
+		err = tx.QueryRow(ctx, `
+		SELECT archived_at IS NOT NULL
+		FROM projects
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE
+		`, *projectID, userID).Scan(&archived)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if archived {
+			return 0, ErrProjectArchived
+		}
+	}
+
+	commandTag, err := tx.Exec(ctx, `
+	UPDATE todos
+	SET project_id = $2, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND id = ANY($3) AND project_id IS DISTINCT FROM $2
+	`, userID, projectID, todoIDs)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return commandTag.RowsAffected(), nil
+}
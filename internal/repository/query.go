@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// likeEscaper escapes the LIKE/ILIKE wildcards so user input is matched
+// literally. Postgres uses backslash as the default escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes s safe to embed in a LIKE pattern.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// truncateText cuts s to at most n characters, which is how a VARCHAR(n)
+// column counts. Invalid UTF-8, which Postgres rejects, is replaced.
+func truncateText(s string, n int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
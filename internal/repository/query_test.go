@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		n     int
+		want  string
+	}{
+		{"short", "curl/8.0", 512, "curl/8.0"},
+		{"ascii", strings.Repeat("a", 600), 512, strings.Repeat("a", 512)},
+		{"multi-byte", strings.Repeat("é", 600), 512, strings.Repeat("é", 512)},
+		{"cut after a multi-byte rune", "a" + strings.Repeat("日本", 300), 4, "a日本日"},
+		{"invalid utf-8", "Mozilla\xff/5.0", 512, "Mozilla�/5.0"},
+	}
+
+	for _, test := range tests {
+		got := truncateText(test.input, test.n)
+
+		if got != test.want {
+			t.Errorf("%s: truncateText = %q, want %q", test.name, got, test.want)
+		}
+
+		if !utf8.ValidString(got) {
+			t.Errorf("%s: truncateText returned invalid UTF-8", test.name)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected")
+)
+
+/*
+CreateRefreshToken stores a new refresh token hash for a user.
+
+This function:
+  - Inserts the hashed token with its expiry
+  - Starts a new token family when familyID is nil (i.e. a fresh login
+    without a session)
+  - Joins an existing family otherwise (i.e. a rotation)
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  userID    - Owner user ID
+  familyID  - Existing family ID or session ID, or nil to start a new
+              family
+  scopes    - Scopes granted to access tokens minted from this token
+  tokenHash - SHA-256 hex digest of the raw refresh token
+  expiresAt - Absolute expiry of the token
+
+Returns:
+  *models.RefreshToken - Stored token record
+  error                - Database error
+
+Security:
+  The raw token is never stored, only its hash.
+*/
+func CreateRefreshToken(pool *pgxpool.Pool, userID string, familyID *string, scopes []string, tokenHash string, expiresAt time.Time) (*models.RefreshToken, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO refresh_tokens (user_id, family_id, scopes, token_hash, expires_at)
+	VALUES ($1, COALESCE($2::uuid, gen_random_uuid()), $3, $4, $5)
+	RETURNING id, user_id, family_id, token_hash, scopes, expires_at, revoked_at, replaced_by, created_at
+	`
+	var token models.RefreshToken
+
+	err := pool.QueryRow(ctx, query, userID, familyID, scopes, tokenHash, expiresAt).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.Scopes,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+		&token.ReplacedBy,
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+/*
+RotateRefreshToken exchanges a refresh token for a new one in the same family.
+
+This function runs in a single transaction and:
+  - Locks the presented token row
+  - Detects reuse: if the token was already rotated or revoked, the whole
+    family and its session are revoked and ErrRefreshTokenReused is
+    returned
+  - Rejects expired tokens
+  - Inserts the replacement token, with the same scopes, and marks the
+    old one as replaced
+
+Parameters:
+  pool         - PostgreSQL connection pool
+  tokenHash    - Hash of the presented refresh token
+  newTokenHash - Hash of the replacement refresh token
+  expiresAt    - Expiry of the replacement token
+
+Returns:
+  *models.RefreshToken - The replacement token
+  error                - ErrRefreshTokenNotFound, ErrRefreshTokenExpired,
+                         ErrRefreshTokenReused or a database error
+
+Security:
+  A stolen refresh token can be used at most once. As soon as either the
+  attacker or the legitimate client replays an already rotated token, every
+  token in the family is revoked and both parties must log in again.
+*/
+func RotateRefreshToken(pool *pgxpool.Pool, tokenHash string, newTokenHash string, expiresAt time.Time) (*models.RefreshToken, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var current models.RefreshToken
+
+	err = tx.QueryRow(ctx, `
+	SELECT id, user_id, family_id, scopes, expires_at, revoked_at
+	FROM refresh_tokens
+	WHERE token_hash = $1
+	FOR UPDATE
+	`, tokenHash).Scan(
+		&current.ID,
+		&current.UserID,
+		&current.FamilyID,
+		&current.Scopes,
+		&current.ExpiresAt,
+		&current.RevokedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE family_id = $1 AND revoked_at IS NULL
+		`, current.FamilyID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(ctx, `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL
+		`, current.FamilyID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return nil, ErrRefreshTokenExpired
+	}
+
+	var next models.RefreshToken
+
+	err = tx.QueryRow(ctx, `
+	INSERT INTO refresh_tokens (user_id, family_id, scopes, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, user_id, family_id, token_hash, scopes, expires_at, revoked_at, replaced_by, created_at
+	`, current.UserID, current.FamilyID, current.Scopes, newTokenHash, expiresAt).Scan(
+		&next.ID,
+		&next.UserID,
+		&next.FamilyID,
+		&next.TokenHash,
+		&next.Scopes,
+		&next.ExpiresAt,
+		&next.RevokedAt,
+		&next.ReplacedBy,
+		&next.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $1
+	WHERE id = $2
+	`, next.ID, current.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &next, nil
+}
+
+/*
+RevokeRefreshTokenFamily revokes every still-active token in a family.
+
+Parameters:
+  pool     - PostgreSQL connection pool
+  familyID - Family to revoke
+
+Returns:
+  error - Database error
+*/
+func RevokeRefreshTokenFamily(pool *pgxpool.Pool, familyID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE family_id = $1 AND revoked_at IS NULL
+	`
+	_, err := pool.Exec(ctx, query, familyID)
+
+	return err
+}
+
+/*
+RevokeRefreshTokenFamilyByHash revokes the family a presented refresh token
+belongs to, as long as the token is owned by the given user.
+
+This is used on logout so the client's refresh token cannot be used to
+mint new access tokens afterwards.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  userID    - Authenticated user ID
+  tokenHash - Hash of the presented refresh token
+
+Returns:
+  error - Database error
+*/
+func RevokeRefreshTokenFamilyByHash(pool *pgxpool.Pool, userID string, tokenHash string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE revoked_at IS NULL
+	AND family_id = (
+		SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND user_id = $2
+	)
+	`
+	_, err := pool.Exec(ctx, query, tokenHash, userID)
+
+	return err
+}
+
+/*
+RevokeAllRefreshTokensForUser revokes every active refresh token a user holds.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - User ID
+
+Returns:
+  error - Database error
+*/
+func RevokeAllRefreshTokensForUser(pool *pgxpool.Pool, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	_, err := pool.Exec(ctx, query, userID)
+
+	return err
+}
@@ -0,0 +1,466 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reminderColumns is the column list every reminder query returns, for a
+// reminders table aliased as r, in the order expected by scanReminder.
+const reminderColumns = `r.id, r.todo_id, r.user_id, r.offset_minutes, r.remind_at, r.channel, r.webhook_url, r.fire_at, r.snoozed_until, r.attempts, r.last_error, r.sent_at, r.failed_at, r.created_at`
+
+func reminderFields(reminder *models.Reminder) []interface{} {
+	return []interface{}{
+		&reminder.ID,
+		&reminder.TodoID,
+		&reminder.UserID,
+		&reminder.OffsetMinutes,
+		&reminder.RemindAt,
+		&reminder.Channel,
+		&reminder.WebhookURL,
+		&reminder.FireAt,
+		&reminder.SnoozedUntil,
+		&reminder.Attempts,
+		&reminder.LastError,
+		&reminder.SentAt,
+		&reminder.FailedAt,
+		&reminder.CreatedAt,
+	}
+}
+
+func scanReminder(row pgx.Row) (*models.Reminder, error) {
+	var reminder models.Reminder
+
+	if err := row.Scan(reminderFields(&reminder)...); err != nil {
+		return nil, err
+	}
+
+	return &reminder, nil
+}
+
+/*
+reminderFireAt is the SQL expression of the time a reminder fires, given
+its offset and absolute time, for a query that joins the todo as t and
+its owner as u.
+
+A relative reminder on a whole-day due date counts from the start of that
+day in the owner's time zone.
+*/
+func reminderFireAt(offsetMinutes string, remindAt string) string {
+	return `CASE WHEN ` + remindAt + ` IS NOT NULL THEN ` + remindAt + `
+		ELSE COALESCE(t.due_at, t.due_date::timestamp AT TIME ZONE u.time_zone) - make_interval(mins => ` + offsetMinutes + `)
+		END`
+}
+
+/*
+CreateReminder adds a reminder to one of a user's todos.
+
+Parameters:
+  pool     - PostgreSQL connection pool
+  reminder - Reminder with TodoID, UserID, Channel, an optional
+             WebhookURL, and either OffsetMinutes or RemindAt
+
+Returns:
+  *models.Reminder - Stored reminder, with FireAt computed
+  error            - pgx.ErrNoRows if the todo does not exist or belongs
+                     to someone else, or a database error
+*/
+func CreateReminder(pool *pgxpool.Pool, reminder *models.Reminder) (*models.Reminder, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO reminders AS r (todo_id, user_id, offset_minutes, remind_at, channel, webhook_url, fire_at)
+	SELECT t.id, t.user_id, $3::integer, $4::timestamptz, $5, $6, ` + reminderFireAt("$3::integer", "$4::timestamptz") + `
+	FROM todos t
+	JOIN users u ON u.id = t.user_id
+	WHERE t.id = $1 AND t.user_id = $2
+	RETURNING ` + reminderColumns
+
+	return scanReminder(pool.QueryRow(ctx, query,
+		reminder.TodoID,
+		reminder.UserID,
+		reminder.OffsetMinutes,
+		reminder.RemindAt,
+		reminder.Channel,
+		reminder.WebhookURL,
+	))
+}
+
+/*
+GetReminders lists the reminders of one of a user's todos, in the order
+they fire.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  todoID - Todo ID
+  userID - Owner user ID
+
+Returns:
+  []models.Reminder - Reminders
+  error             - Database error
+*/
+func GetReminders(pool *pgxpool.Pool, todoID int, userID string) ([]models.Reminder, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + reminderColumns + `
+	FROM reminders r
+	WHERE r.todo_id = $1 AND r.user_id = $2
+	ORDER BY r.fire_at NULLS LAST, r.created_at
+	`
+
+	return queryReminders(ctx, pool, query, todoID, userID)
+}
+
+/*
+GetRemindersForUser lists every reminder of a user, for the data export.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - Owner user ID
+
+Returns:
+  []models.Reminder - Reminders
+  error             - Database error
+*/
+func GetRemindersForUser(pool *pgxpool.Pool, userID string) ([]models.Reminder, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + reminderColumns + `
+	FROM reminders r
+	WHERE r.user_id = $1
+	ORDER BY r.todo_id, r.created_at
+	`
+
+	return queryReminders(ctx, pool, query, userID)
+}
+
+func queryReminders(ctx context.Context, pool *pgxpool.Pool, query string, args ...interface{}) ([]models.Reminder, error) {
+	rows, err := pool.Query(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var reminders []models.Reminder = []models.Reminder{}
+
+	for rows.Next() {
+		reminder, err := scanReminder(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reminders = append(reminders, *reminder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+/*
+DeleteReminder removes a reminder from one of a user's todos.
+
+Returns:
+  error - pgx.ErrNoRows if there is no such reminder, or a database error
+
+Security:
+  Uses BOTH todo_id AND user_id so users can only delete their own
+  reminders.
+*/
+func DeleteReminder(pool *pgxpool.Pool, id string, todoID int, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	DELETE FROM reminders
+	WHERE id = $1 AND todo_id = $2 AND user_id = $3
+	`
+	commandTag, err := pool.Exec(ctx, query, id, todoID, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+/*
+SnoozeReminder makes a reminder fire (again) at the given time. It works
+on pending, sent and failed reminders alike.
+
+While snoozed, a relative reminder no longer follows its todo's due date;
+it does again once the snoozed reminder has been sent.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  id     - Reminder ID
+  todoID - Todo ID
+  userID - Owner user ID
+  until  - New time the reminder fires
+
+Returns:
+  *models.Reminder - Updated reminder
+  error            - pgx.ErrNoRows if there is no such reminder, or a
+                     database error
+*/
+func SnoozeReminder(pool *pgxpool.Pool, id string, todoID int, userID string, until time.Time) (*models.Reminder, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE reminders r
+	SET snoozed_until = $4, fire_at = $4, retry_at = NULL, attempts = 0,
+		last_error = NULL, sent_at = NULL, failed_at = NULL
+	WHERE r.id = $1 AND r.todo_id = $2 AND r.user_id = $3
+	RETURNING ` + reminderColumns
+
+	return scanReminder(pool.QueryRow(ctx, query, id, todoID, userID, until))
+}
+
+/*
+RescheduleReminders recomputes when the relative reminders of a user fire,
+after a due date or the user's time zone changed.
+
+A reminder whose fire time moves is armed again, unless it was already
+sent and the new time has passed too. Snoozed reminders keep their snooze.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - Owner user ID
+  todoID - Only reschedule this todo's reminders; nil for all of them
+  now    - Current time
+
+Returns:
+  error - Database error
+*/
+func RescheduleReminders(pool *pgxpool.Pool, userID string, todoID *int, now time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE reminders r
+	SET fire_at = x.fire_at, retry_at = NULL, attempts = 0, last_error = NULL,
+		sent_at = NULL, failed_at = NULL
+	FROM (
+		SELECT p.id, ` + reminderFireAt("p.offset_minutes", "p.remind_at") + ` AS fire_at
+		FROM reminders p
+		JOIN todos t ON t.id = p.todo_id
+		JOIN users u ON u.id = p.user_id
+		WHERE p.user_id = $1 AND ($2::integer IS NULL OR p.todo_id = $2)
+		AND p.offset_minutes IS NOT NULL AND p.snoozed_until IS NULL
+	) x
+	WHERE r.id = x.id
+	AND r.fire_at IS DISTINCT FROM x.fire_at
+	AND (r.sent_at IS NULL OR x.fire_at > $3)
+	`
+	_, err := pool.Exec(ctx, query, userID, todoID, now)
+
+	return err
+}
+
+/*
+ClaimDueReminders takes up to limit reminders whose time has come, for
+delivery by the calling scheduler.
+
+A claim lasts until CompleteReminder, RetryReminder or FailReminder is
+called, or until it goes stale (claimed before staleBefore) because the
+scheduler crashed. FOR UPDATE SKIP LOCKED lets the schedulers of several
+replicas claim reminders concurrently without picking the same one.
+
+Reminders of completed todos and of disabled or deleted accounts are not
+claimed; they fire if the todo is reopened or the account restored.
+
+Parameters:
+  pool        - PostgreSQL connection pool
+  now         - Current time
+  staleBefore - Claims older than this are taken over
+  limit       - Maximum number of reminders claimed
+
+Returns:
+  []models.DueReminder - Claimed reminders
+  error                - Database error
+*/
+func ClaimDueReminders(pool *pgxpool.Pool, now time.Time, staleBefore time.Time, limit int) ([]models.DueReminder, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	WITH r AS (
+		UPDATE reminders
+		SET claimed_at = $1, attempts = attempts + 1
+		WHERE id IN (
+			SELECT p.id
+			FROM reminders p
+			JOIN todos t ON t.id = p.todo_id
+			JOIN users u ON u.id = p.user_id
+			WHERE p.sent_at IS NULL AND p.failed_at IS NULL
+			AND COALESCE(p.retry_at, p.fire_at) <= $1
+			AND (p.claimed_at IS NULL OR p.claimed_at < $2)
+			AND NOT t.completed
+			AND u.disabled_at IS NULL AND u.deleted_at IS NULL
+			ORDER BY COALESCE(p.retry_at, p.fire_at)
+			LIMIT $3
+			FOR UPDATE OF p SKIP LOCKED
+		)
+		RETURNING *
+	)
+	SELECT ` + reminderColumns + `, t.title, t.due_at, t.due_date, u.email, u.time_zone
+	FROM r
+	JOIN todos t ON t.id = r.todo_id
+	JOIN users u ON u.id = r.user_id
+	`
+	rows, err := pool.Query(ctx, query, now, staleBefore, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var reminders []models.DueReminder = []models.DueReminder{}
+
+	for rows.Next() {
+		var reminder models.DueReminder
+		var dueAt, dueDate *time.Time
+
+		fields := append(reminderFields(&reminder.Reminder), &reminder.TodoTitle, &dueAt, &dueDate, &reminder.Email, &reminder.TimeZone)
+
+		if err := rows.Scan(fields...); err != nil {
+			return nil, err
+		}
+
+		reminder.TodoDueAt = calendarTimeFromColumns(dueAt, dueDate)
+		reminders = append(reminders, reminder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+/*
+CompleteReminder releases a delivered reminder and marks it sent.
+
+It is only marked sent if it still fires at firedAt: a reminder snoozed
+or rescheduled while it was being delivered stays pending for its new
+time.
+
+Parameters:
+  pool    - PostgreSQL connection pool
+  id      - Reminder ID
+  firedAt - FireAt of the claimed reminder
+  now     - Current time
+
+Returns:
+  error - Database error
+*/
+func CompleteReminder(pool *pgxpool.Pool, id string, firedAt time.Time, now time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE reminders
+	SET claimed_at = NULL,
+		sent_at = CASE WHEN fire_at = $2 THEN $3 ELSE sent_at END,
+		snoozed_until = CASE WHEN fire_at = $2 THEN NULL ELSE snoozed_until END,
+		last_error = CASE WHEN fire_at = $2 THEN NULL ELSE last_error END
+	WHERE id = $1
+	`
+	_, err := pool.Exec(ctx, query, id, firedAt, now)
+
+	return err
+}
+
+/*
+RetryReminder releases a reminder whose delivery failed, to be tried again
+at retryAt.
+
+Parameters:
+  pool    - PostgreSQL connection pool
+  id      - Reminder ID
+  retryAt - Time of the next attempt
+  message - Why the delivery failed
+
+Returns:
+  error - Database error
+*/
+func RetryReminder(pool *pgxpool.Pool, id string, retryAt time.Time, message string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE reminders
+	SET claimed_at = NULL, retry_at = $2, last_error = $3
+	WHERE id = $1
+	`
+	_, err := pool.Exec(ctx, query, id, retryAt, message)
+
+	return err
+}
+
+/*
+FailReminder releases a reminder that could not be delivered and stops
+retrying it. Snoozing the reminder arms it again.
+
+Parameters:
+  pool    - PostgreSQL connection pool
+  id      - Reminder ID
+  message - Why the last delivery failed
+  now     - Current time
+
+Returns:
+  error - Database error
+*/
+func FailReminder(pool *pgxpool.Pool, id string, message string, now time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE reminders
+	SET claimed_at = NULL, retry_at = NULL, last_error = $2, failed_at = $3
+	WHERE id = $1
+	`
+	_, err := pool.Exec(ctx, query, id, message, now)
+
+	return err
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+RevokeToken adds an access token's jti to the revocation list.
+
+The row is kept until the token would have expired anyway, after which
+DeleteExpiredRevokedTokens removes it.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  jti       - Unique token identifier from the jti claim
+  userID    - Owner of the token
+  expiresAt - Expiration time of the token (exp claim)
+
+Returns:
+  error - Database error
+*/
+func RevokeToken(pool *pgxpool.Pool, jti string, userID string, expiresAt time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO revoked_tokens (jti, user_id, expires_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (jti) DO NOTHING
+	`
+	_, err := pool.Exec(ctx, query, jti, userID, expiresAt)
+
+	return err
+}
+
+/*
+IsTokenRevoked reports whether a jti is on the revocation list.
+
+Parameters:
+  pool - PostgreSQL connection pool
+  jti  - Unique token identifier from the jti claim
+
+Returns:
+  bool  - true if the token has been revoked
+  error - Database error
+*/
+func IsTokenRevoked(pool *pgxpool.Pool, jti string) (bool, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+	`
+	var revoked bool
+
+	err := pool.QueryRow(ctx, query, jti).Scan(&revoked)
+
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+/*
+ConsumeTokenID puts a jti on the revocation list and reports whether it
+was not there yet, so that of two requests racing with the same
+single-use token only one succeeds.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  jti       - Unique token identifier from the jti claim
+  userID    - Owner of the token
+  expiresAt - Expiration time of the token (exp claim)
+
+Returns:
+  bool  - true if this call used up the token
+  error - Database error
+*/
+func ConsumeTokenID(pool *pgxpool.Pool, jti string, userID string, expiresAt time.Time) (bool, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO revoked_tokens (jti, user_id, expires_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (jti) DO NOTHING
+	`
+	commandTag, err := pool.Exec(ctx, query, jti, userID, expiresAt)
+
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+/*
+DeleteExpiredRevokedTokens removes revocation entries for tokens that have
+expired on their own and therefore no longer need to be tracked.
+
+Returns:
+  int64 - Number of rows removed
+  error - Database error
+*/
+func DeleteExpiredRevokedTokens(pool *pgxpool.Pool) (int64, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	commandTag, err := pool.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP`)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return commandTag.RowsAffected(), nil
+}
+
+/*
+SetTokensInvalidBefore invalidates every access token issued to a user
+before the given time.
+
+This is how "log out everywhere" and password changes revoke tokens that
+were never individually recorded.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - User whose tokens are revoked
+  cutoff - Tokens with an iat before this time are rejected
+
+Returns:
+  error - Database error
+*/
+func SetTokensInvalidBefore(pool *pgxpool.Pool, userID string, cutoff time.Time) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE users
+	SET tokens_invalid_before = $1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $2
+	`
+	_, err := pool.Exec(ctx, query, cutoff, userID)
+
+	return err
+}
+
+/*
+GetUserTokenState returns what RevocationStore needs to know about a user
+to decide whether their tokens are still valid.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - User ID
+
+Returns:
+  *time.Time - Token cutoff, or nil when the user has never revoked all
+               tokens
+  bool       - true if the account is disabled or scheduled for deletion
+  error      - pgx.ErrNoRows if the user does not exist, or a database error
+*/
+func GetUserTokenState(pool *pgxpool.Pool, userID string) (*time.Time, bool, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var cutoff *time.Time
+	var disabled bool
+
+	err := pool.QueryRow(ctx, `
+	SELECT tokens_invalid_before, disabled_at IS NOT NULL OR deleted_at IS NOT NULL
+	FROM users
+	WHERE id = $1
+	`, userID).Scan(&cutoff, &disabled)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return cutoff, disabled, nil
+}
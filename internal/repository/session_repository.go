@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const sessionColumns = `id, user_id, user_agent, ip_address, created_at, last_seen_at, revoked_at`
+
+func scanSession(row pgx.Row) (*models.Session, error) {
+	var session models.Session
+
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.RevokedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+/*
+CreateSession records a new login.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  userID    - User who logged in
+  userAgent - User-Agent header of the client, truncated to 512
+              characters
+  ipAddress - Client IP address
+
+Returns:
+  *models.Session - Stored session
+  error           - Database error
+*/
+func CreateSession(pool *pgxpool.Pool, userID string, userAgent string, ipAddress string) (*models.Session, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userAgent = truncateText(userAgent, 512)
+
+	var query string = `
+	INSERT INTO sessions (user_id, user_agent, ip_address)
+	VALUES ($1, NULLIF($2, ''), NULLIF($3, ''))
+	RETURNING ` + sessionColumns
+
+	return scanSession(pool.QueryRow(ctx, query, userID, userAgent, ipAddress))
+}
+
+/*
+GetActiveSessions lists the sessions of a user that can still be used,
+most recently seen first.
+
+A session is active until it is revoked or its last refresh token
+expires.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - Owner user ID
+
+Returns:
+  []models.Session - Active sessions
+  error            - Database error
+*/
+func GetActiveSessions(pool *pgxpool.Pool, userID string) ([]models.Session, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + sessionColumns + `
+	FROM sessions s
+	WHERE s.user_id = $1 AND s.revoked_at IS NULL
+	AND EXISTS (
+		SELECT 1 FROM refresh_tokens r
+		WHERE r.family_id = s.id AND r.revoked_at IS NULL AND r.expires_at > CURRENT_TIMESTAMP
+	)
+	ORDER BY s.last_seen_at DESC
+	`
+	rows, err := pool.Query(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []models.Session = []models.Session{}
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, *session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+/*
+RevokeSession signs a session out: the session is marked revoked and its
+refresh tokens stop working.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  id     - Session ID
+  userID - Owner user ID
+
+Returns:
+  error - pgx.ErrNoRows if the user has no such active session, or a
+          database error
+
+Security:
+  Uses BOTH id AND user_id so users can only revoke their own sessions.
+*/
+func RevokeSession(pool *pgxpool.Pool, id string, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx, `
+	UPDATE sessions
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE family_id = $1 AND revoked_at IS NULL
+	`, id)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+/*
+RevokeAllSessionsForUser marks every session of a user revoked.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - User ID
+
+Returns:
+  error - Database error
+*/
+func RevokeAllSessionsForUser(pool *pgxpool.Pool, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE sessions
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	_, err := pool.Exec(ctx, query, userID)
+
+	return err
+}
+
+/*
+GetSessionState returns what RevocationStore needs to know about a
+session.
+
+Parameters:
+  pool - PostgreSQL connection pool
+  id   - Session ID
+
+Returns:
+  bool      - true if the session has been revoked
+  time.Time - When the session was last seen
+  error     - pgx.ErrNoRows if the session does not exist, or a database
+              error
+*/
+func GetSessionState(pool *pgxpool.Pool, id string) (bool, time.Time, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var revoked bool
+	var lastSeenAt time.Time
+
+	err := pool.QueryRow(ctx, `
+	SELECT revoked_at IS NOT NULL, last_seen_at
+	FROM sessions
+	WHERE id = $1
+	`, id).Scan(&revoked, &lastSeenAt)
+
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	return revoked, lastSeenAt, nil
+}
+
+/*
+TouchSession records that a session was just used.
+
+To avoid a write on every request, last_seen_at is only updated when it
+is older than the given granularity.
+
+Parameters:
+  pool        - PostgreSQL connection pool
+  id          - Session ID
+  granularity - Minimum time between two updates
+
+Returns:
+  error - Database error
+*/
+func TouchSession(pool *pgxpool.Pool, id string, granularity time.Duration) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE sessions
+	SET last_seen_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND revoked_at IS NULL AND last_seen_at < $2
+	`
+	_, err := pool.Exec(ctx, query, id, time.Now().Add(-granularity))
+
+	return err
+}
+
+/*
+DeleteStaleSessions removes sessions that have had no usable refresh token
+since before the given time. Their access tokens have long expired, so
+nothing refers to them anymore.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  before - Sessions last seen or revoked before this time are removed
+
+Returns:
+  int64 - Number of deleted sessions
+  error - Database error
+*/
+func DeleteStaleSessions(pool *pgxpool.Pool, before time.Time) (int64, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	DELETE FROM sessions s
+	WHERE COALESCE(s.revoked_at, s.last_seen_at) < $1
+	AND NOT EXISTS (
+		SELECT 1 FROM refresh_tokens r
+		WHERE r.family_id = s.id AND r.revoked_at IS NULL AND r.expires_at > $1
+	)
+	`
+	commandTag, err := pool.Exec(ctx, query, before)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return commandTag.RowsAffected(), nil
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MaxTodoDepth is how many levels of subtasks a todo can have below it:
+// a top-level todo can have subtasks, which can have subtasks, and so on,
+// down to this depth.
+const MaxTodoDepth = 3
+
+var (
+	ErrParentNotFound = errors.New("the parent todo does not exist")
+	ErrTodoCycle      = errors.New("a todo cannot be a subtask of itself or of one of its subtasks")
+	ErrTodoTooDeep    = errors.New("subtasks cannot be nested more than 3 levels deep")
+)
+
+// lockTodoTree serializes changes to the subtask tree of a user until the
+// transaction ends, so two concurrent moves cannot build a cycle that
+// neither of them sees alone.
+func lockTodoTree(ctx context.Context, tx pgx.Tx, userID string) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('todo_tree:' || $1::text, 0))`, userID)
+
+	return err
+}
+
+/*
+checkTodoParent verifies, inside a transaction, that a todo can become a
+subtask of parentID: the parent must be one of the user's todos, must not
+be the todo or one of its subtasks, and the todo with all its subtasks
+must still fit within MaxTodoDepth below it. todoID is 0 for a new todo.
+
+It takes the lock of lockTodoTree first.
+*/
+func checkTodoParent(ctx context.Context, tx pgx.Tx, userID string, todoID int, parentID int) error {
+	if err := lockTodoTree(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	// The walk stops after MaxTodoDepth + 1 steps, which is as far as a
+	// valid tree can go, so rows that already form a cycle cannot make it
+	// loop forever.
+	var found bool
+	var parentDepth int
+	var cycle bool
+
+	err := tx.QueryRow(ctx, `
+	WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id, 1 AS depth
+		FROM todos
+		WHERE id = $1 AND user_id = $2
+		UNION ALL
+		SELECT t.id, t.parent_id, a.depth + 1
+		FROM todos t
+		JOIN ancestors a ON t.id = a.parent_id
+		WHERE a.depth <= $4
+	)
+	SELECT COUNT(*) > 0, COALESCE(MAX(depth), 0), COALESCE(BOOL_OR(id = $3), FALSE)
+	FROM ancestors
+	`, parentID, userID, todoID, MaxTodoDepth).Scan(&found, &parentDepth, &cycle)
+
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return ErrParentNotFound
+	}
+
+	if cycle {
+		return ErrTodoCycle
+	}
+
+	// parentDepth counts the parent and its ancestors, which is the depth
+	// the todo gets. Its own subtasks go that much deeper again.
+	var height int
+
+	if todoID != 0 {
+		err = tx.QueryRow(ctx, `
+		WITH RECURSIVE subtree AS (
+			SELECT id, 0 AS height
+			FROM todos
+			WHERE id = $1
+			UNION ALL
+			SELECT t.id, s.height + 1
+			FROM todos t
+			JOIN subtree s ON t.parent_id = s.id
+			WHERE s.height <= $2
+		)
+		SELECT COALESCE(MAX(height), 0) FROM subtree
+		`, todoID, MaxTodoDepth).Scan(&height)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if parentDepth+height > MaxTodoDepth {
+		return ErrTodoTooDeep
+	}
+
+	return nil
+}
+
+/*
+GetSubtasks lists the subtasks of a todo, oldest first.
+
+With recursive, the subtasks of the subtasks are listed too, depth first:
+each todo is followed by its own subtasks. parent_id tells which todo a
+subtask belongs to.
+
+Parameters:
+  pool      - PostgreSQL connection pool
+  id        - Parent ToDo ID
+  userID    - Owner user ID
+  recursive - Whether to list every level or only the direct subtasks
+
+Returns:
+  []models.ToDo - Subtasks
+  error         - pgx.ErrNoRows if the user has no such todo, or a
+                  database error
+
+Security:
+  Only subtasks of the user's own todo are returned.
+*/
+func GetSubtasks(pool *pgxpool.Pool, id int, userID string, recursive bool) ([]models.ToDo, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var exists bool
+
+	err := pool.QueryRow(ctx, `
+	SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1 AND user_id = $2)
+	`, id, userID).Scan(&exists)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, pgx.ErrNoRows
+	}
+
+	var maxDepth int = 1
+
+	if recursive {
+		maxDepth = MaxTodoDepth
+	}
+
+	// Todo IDs grow with creation time, so ordering by the path of IDs
+	// lists each level oldest first, every todo before its subtasks.
+	var query string = `
+	WITH RECURSIVE tree AS (
+		SELECT id, ARRAY[id] AS path, 1 AS depth
+		FROM todos
+		WHERE parent_id = $1 AND user_id = $2
+		UNION ALL
+		SELECT t.id, tree.path || t.id, tree.depth + 1
+		FROM todos t
+		JOIN tree ON t.parent_id = tree.id
+		WHERE tree.depth < $3
+	)
+	SELECT ` + todoColumns + `
+	FROM todos
+	JOIN tree ON tree.id = todos.id
+	ORDER BY tree.path
+	`
+	rows, err := pool.Query(ctx, query, id, userID, maxDepth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var todos []models.ToDo = []models.ToDo{}
+
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		todos = append(todos, *todo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// completeTodoSubtasks marks every subtask of a todo, at every level, as
+// completed. Only subtasks of the user's own todo are changed.
+func completeTodoSubtasks(ctx context.Context, tx pgx.Tx, id int, userID string) error {
+	_, err := tx.Exec(ctx, `
+	WITH RECURSIVE tree AS (
+		SELECT id, 1 AS depth
+		FROM todos
+		WHERE parent_id = $1 AND user_id = $2
+		UNION ALL
+		SELECT t.id, tree.depth + 1
+		FROM todos t
+		JOIN tree ON t.parent_id = tree.id
+		WHERE tree.depth < $3
+	)
+	UPDATE todos
+	SET completed = TRUE, updated_at = CURRENT_TIMESTAMP
+	WHERE id IN (SELECT id FROM tree) AND NOT completed
+	`, id, userID, MaxTodoDepth)
+
+	return err
+}
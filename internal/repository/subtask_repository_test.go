@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type fakeTodo struct {
+	userID   string
+	parentID int // 0 for a top-level todo
+}
+
+/*
+fakeTodoTx stands in for the transaction of checkTodoParent. It answers
+the two tree walks the way PostgreSQL evaluates their recursive queries,
+including the step limits, over todos kept in memory. Other methods of
+pgx.Tx are not implemented.
+*/
+type fakeTodoTx struct {
+	pgx.Tx
+	todos  map[int]fakeTodo
+	locked bool
+}
+
+func (tx *fakeTodoTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if !strings.Contains(sql, "pg_advisory_xact_lock") {
+		return pgconn.CommandTag{}, fmt.Errorf("unexpected statement %s", sql)
+	}
+
+	tx.locked = true
+
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *fakeTodoTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if !tx.locked {
+		return fakeRow{err: errors.New("tree walked before the lock was taken")}
+	}
+
+	switch {
+	case strings.Contains(sql, "ancestors"):
+		return tx.ancestors(args[0].(int), args[1].(string), args[2].(int), args[3].(int))
+	case strings.Contains(sql, "subtree"):
+		return tx.subtree(args[0].(int), args[1].(int))
+	default:
+		return fakeRow{err: fmt.Errorf("unexpected query %s", sql)}
+	}
+}
+
+// ancestors walks up from the parent, one depth per step, continuing
+// from rows no deeper than maxDepth.
+func (tx *fakeTodoTx) ancestors(parentID int, userID string, todoID int, maxDepth int) pgx.Row {
+	parent, ok := tx.todos[parentID]
+
+	if !ok || parent.userID != userID {
+		return fakeRow{values: []interface{}{false, 0, false}}
+	}
+
+	id, depth, cycle := parentID, 1, parentID == todoID
+
+	for depth <= maxDepth {
+		next := tx.todos[id].parentID
+
+		if _, ok := tx.todos[next]; !ok {
+			break
+		}
+
+		id = next
+		depth++
+		cycle = cycle || id == todoID
+	}
+
+	return fakeRow{values: []interface{}{true, depth, cycle}}
+}
+
+// subtree walks down from the todo, continuing from rows no higher than
+// maxDepth, and returns the largest height reached.
+func (tx *fakeTodoTx) subtree(todoID int, maxDepth int) pgx.Row {
+	if _, ok := tx.todos[todoID]; !ok {
+		return fakeRow{values: []interface{}{0}}
+	}
+
+	level, height := []int{todoID}, 0
+
+	for height <= maxDepth {
+		var children []int
+
+		for id, todo := range tx.todos {
+			for _, parentID := range level {
+				if todo.parentID == parentID {
+					children = append(children, id)
+				}
+			}
+		}
+
+		if len(children) == 0 {
+			break
+		}
+
+		level = children
+		height++
+	}
+
+	return fakeRow{values: []interface{}{height}}
+}
+
+type fakeRow struct {
+	values []interface{}
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	for i, value := range r.values {
+		switch target := dest[i].(type) {
+		case *bool:
+			*target = value.(bool)
+		case *int:
+			*target = value.(int)
+		default:
+			return fmt.Errorf("cannot scan into %T", dest[i])
+		}
+	}
+
+	return nil
+}
+
+func TestCheckTodoParent(t *testing.T) {
+	// Ann's todos:
+	//   1 > 2 > 3 > 4   (4 is as deep as subtasks go)
+	//   10 > 11 > 12
+	//   20 > 21 > 22 > 23
+	// and Bob's todo 30.
+	todos := map[int]fakeTodo{
+		1: {"ann", 0}, 2: {"ann", 1}, 3: {"ann", 2}, 4: {"ann", 3},
+		10: {"ann", 0}, 11: {"ann", 10}, 12: {"ann", 11},
+		20: {"ann", 0}, 21: {"ann", 20}, 22: {"ann", 21}, 23: {"ann", 22},
+		30: {"bob", 0},
+	}
+
+	tests := []struct {
+		name     string
+		todoID   int
+		parentID int
+		want     error
+	}{
+		{"new subtask of a top-level todo", 0, 1, nil},
+		{"new subtask at the deepest level", 0, 3, nil},
+		{"new subtask below the deepest level", 0, 4, ErrTodoTooDeep},
+		{"missing parent", 0, 99, ErrParentNotFound},
+		{"parent of another user", 0, 30, ErrParentNotFound},
+		{"own parent", 2, 2, ErrTodoCycle},
+		{"top-level todo as its own parent", 1, 1, ErrTodoCycle},
+		{"under its own subtask", 1, 2, ErrTodoCycle},
+		{"under its own deepest subtask", 2, 4, ErrTodoCycle},
+		{"leaf moved to the deepest level", 12, 3, nil},
+		{"leaf moved below the deepest level", 12, 4, ErrTodoTooDeep},
+		{"subtree that just fits", 10, 1, nil},
+		{"subtree one level too deep", 10, 2, ErrTodoTooDeep},
+		{"middle of a subtree that just fits", 11, 2, nil},
+		{"middle of a subtree one level too deep", 11, 3, ErrTodoTooDeep},
+		{"full-depth subtree moved under a top-level todo", 20, 1, ErrTodoTooDeep},
+		{"subtask moved to the same parent", 3, 2, nil},
+	}
+
+	for _, test := range tests {
+		tx := &fakeTodoTx{todos: todos}
+		err := checkTodoParent(context.Background(), tx, "ann", test.todoID, test.parentID)
+
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: moving %d under %d = %v, want %v", test.name, test.todoID, test.parentID, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrTagExists = errors.New("a tag with this name already exists")
+
+// tagColumns is the column list every tag query returns, for the tags
+// table aliased as t.
+const tagColumns = `t.id, t.user_id, t.name, t.color, t.position,
+	(SELECT COUNT(*) FROM todo_tags tt WHERE tt.tag_id = t.id),
+	t.created_at, t.updated_at`
+
+func scanTag(row pgx.Row) (*models.Tag, error) {
+	var tag models.Tag
+
+	err := row.Scan(
+		&tag.ID,
+		&tag.UserID,
+		&tag.Name,
+		&tag.Color,
+		&tag.Position,
+		&tag.TodoCount,
+		&tag.CreatedAt,
+		&tag.UpdatedAt,
+	)
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrTagExists
+		}
+
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+/*
+CreateTag adds a tag for a user, after the user's other tags.
+
+Parameters:
+  pool - PostgreSQL connection pool
+  tag  - Tag with UserID, Name and optional Color
+
+Returns:
+  *models.Tag - Stored tag
+  error       - ErrTagExists if the user has a tag with the same name
+                (ignoring case), or a database error
+*/
+func CreateTag(pool *pgxpool.Pool, tag *models.Tag) (*models.Tag, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	INSERT INTO tags AS t (user_id, name, color, position)
+	VALUES ($1, $2, $3, COALESCE((SELECT MAX(position) + 1 FROM tags WHERE user_id = $1), 0))
+	RETURNING ` + tagColumns
+
+	return scanTag(pool.QueryRow(ctx, query, tag.UserID, tag.Name, tag.Color))
+}
+
+/*
+GetTags lists the tags of a user in the user's order.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - Owner user ID
+
+Returns:
+  []models.Tag - Tags, each with the number of todos carrying it
+  error        - Database error
+*/
+func GetTags(pool *pgxpool.Pool, userID string) ([]models.Tag, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + tagColumns + `
+	FROM tags t
+	WHERE t.user_id = $1
+	ORDER BY t.position, LOWER(t.name)
+	`
+	rows, err := pool.Query(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tags []models.Tag = []models.Tag{}
+
+	for rows.Next() {
+		tag, err := scanTag(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, *tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+/*
+UpdateTag renames or recolors a tag. Todos refer to tags by ID, so a
+rename shows on every todo carrying the tag at once.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  id     - Tag ID
+  userID - Owner user ID
+  name   - New name, or nil to keep it
+  color  - New color; Set with a nil Value removes the color
+
+Returns:
+  *models.Tag - Updated tag
+  error       - pgx.ErrNoRows if the user has no such tag, ErrTagExists if
+                another of the user's tags has the new name, or a database
+                error
+
+Security:
+  Uses BOTH id AND user_id so users can only change their own tags.
+*/
+func UpdateTag(pool *pgxpool.Pool, id string, userID string, name *string, color models.Nullable[string]) (*models.Tag, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE tags AS t
+	SET name = COALESCE($3, t.name),
+		color = CASE WHEN $4 THEN $5 ELSE t.color END,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE t.id = $1 AND t.user_id = $2
+	RETURNING ` + tagColumns
+
+	return scanTag(pool.QueryRow(ctx, query, id, userID, name, color.Set, color.Value))
+}
+
+/*
+DeleteTag deletes a tag and removes it from every todo.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  id     - Tag ID
+  userID - Owner user ID
+
+Returns:
+  error - pgx.ErrNoRows if the user has no such tag, or a database error
+
+Security:
+  Uses BOTH id AND user_id so users can only delete their own tags.
+*/
+func DeleteTag(pool *pgxpool.Pool, id string, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	DELETE FROM tags
+	WHERE id = $1 AND user_id = $2
+	`
+	commandTag, err := pool.Exec(ctx, query, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+/*
+MergeTags moves every todo of one tag to another and deletes the first
+tag, in one transaction. Todos that already carry both keep one.
+
+Parameters:
+  pool     - PostgreSQL connection pool
+  sourceID - Tag that is merged and deleted
+  targetID - Tag that is kept
+  userID   - Owner user ID
+
+Returns:
+  *models.Tag - The kept tag, with its new todo count
+  error       - pgx.ErrNoRows if the user does not own both tags, or a
+                database error
+
+Security:
+  Both tags must belong to the user.
+*/
+func MergeTags(pool *pgxpool.Pool, sourceID string, targetID string, userID string) (*models.Tag, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// Locking both tags keeps a concurrent merge or delete from working on
+	// them halfway through.
+	var owned int
+
+	err = tx.QueryRow(ctx, `
+	SELECT COUNT(*) FROM (
+		SELECT id FROM tags
+		WHERE id IN ($1, $2) AND user_id = $3
+		ORDER BY id
+		FOR UPDATE
+	) locked
+	`, sourceID, targetID, userID).Scan(&owned)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if owned != 2 {
+		return nil, pgx.ErrNoRows
+	}
+
+	_, err = tx.Exec(ctx, `
+	INSERT INTO todo_tags (todo_id, tag_id)
+	SELECT todo_id, $2 FROM todo_tags WHERE tag_id = $1
+	ON CONFLICT DO NOTHING
+	`, sourceID, targetID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM tags WHERE id = $1`, sourceID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := scanTag(tx.QueryRow(ctx, `
+	UPDATE tags AS t
+	SET updated_at = CURRENT_TIMESTAMP
+	WHERE t.id = $1
+	RETURNING `+tagColumns, targetID))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+/*
+ReorderTags sets the order of a user's tags. The listed tags come first,
+in the given order; tags left out follow in their previous order.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  userID - Owner user ID
+  ids    - Tag IDs in the new order, without duplicates
+
+Returns:
+  error - pgx.ErrNoRows if one of the IDs is not a tag of the user, or a
+          database error
+*/
+func ReorderTags(pool *pgxpool.Pool, userID string, ids []string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var owned int
+
+	err = tx.QueryRow(ctx, `
+	SELECT COUNT(*) FROM (
+		SELECT id FROM tags
+		WHERE user_id = $1
+		ORDER BY id
+		FOR UPDATE
+	) locked
+	WHERE id = ANY($2::uuid[])
+	`, userID, ids).Scan(&owned)
+
+	if err != nil {
+		return err
+	}
+
+	if owned != len(ids) {
+		return pgx.ErrNoRows
+	}
+
+	_, err = tx.Exec(ctx, `
+	WITH ordered AS (
+		SELECT t.id, ROW_NUMBER() OVER (ORDER BY x.ord NULLS LAST, t.position, LOWER(t.name)) - 1 AS position
+		FROM tags t
+		LEFT JOIN unnest($2::uuid[]) WITH ORDINALITY AS x(id, ord) ON x.id = t.id
+		WHERE t.user_id = $1
+	)
+	UPDATE tags
+	SET position = ordered.position
+	FROM ordered
+	WHERE tags.id = ordered.id AND tags.position <> ordered.position
+	`, userID, ids)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+/*
+AttachTag puts a tag on a todo. Attaching a tag the todo already carries
+does nothing.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  todoID - ToDo ID
+  tagID  - Tag ID
+  userID - Owner user ID
+
+Returns:
+  error - pgx.ErrNoRows if the user does not own both the todo and the
+          tag, or a database error
+
+Security:
+  Both the todo and the tag must belong to the user.
+*/
+func AttachTag(pool *pgxpool.Pool, todoID int, tagID string, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var found bool
+
+	err := pool.QueryRow(ctx, `
+	WITH owned AS (
+		SELECT todos.id AS todo_id, tags.id AS tag_id
+		FROM todos, tags
+		WHERE todos.id = $1 AND todos.user_id = $3
+		AND tags.id = $2 AND tags.user_id = $3
+	), attached AS (
+		INSERT INTO todo_tags (todo_id, tag_id)
+		SELECT todo_id, tag_id FROM owned
+		ON CONFLICT DO NOTHING
+	)
+	SELECT EXISTS (SELECT 1 FROM owned)
+	`, todoID, tagID, userID).Scan(&found)
+
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+/*
+DetachTag removes a tag from a todo.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  todoID - ToDo ID
+  tagID  - Tag ID
+  userID - Owner user ID
+
+Returns:
+  error - pgx.ErrNoRows if the user has no such todo or it does not carry
+          the tag, or a database error
+
+Security:
+  The todo must belong to the user.
+*/
+func DetachTag(pool *pgxpool.Pool, todoID int, tagID string, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	DELETE FROM todo_tags tt
+	USING todos
+	WHERE tt.todo_id = todos.id AND todos.id = $1 AND todos.user_id = $3 AND tt.tag_id = $2
+	`
+	commandTag, err := pool.Exec(ctx, query, todoID, tagID, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
@@ -2,13 +2,132 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+	"todos_api/internal/markdown"
 	"todos_api/internal/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrTodoNotFound = errors.New("todo not found")
+
+// todoColumns is the column list every todo query returns, in the order
+// expected by scanTodo. The todos table must not be aliased, because the
+// tags are looked up for todos.id.
+const todoColumns = `id, title, notes, completed, priority, project_id, parent_id, due_at, due_date, start_at, start_date, series_id, recurrence_id, created_at, updated_at, user_id, ` + todoTagsColumn + `,
+	(SELECT COUNT(*) FILTER (WHERE sub.completed) FROM todos sub WHERE sub.parent_id = todos.id),
+	(SELECT COUNT(*) FROM todos sub WHERE sub.parent_id = todos.id)`
+
+// todoTagsColumn selects the tags of a todo as a JSON array, in the
+// user's tag order.
+const todoTagsColumn = `COALESCE((
+		SELECT json_agg(json_build_object('id', tg.id, 'name', tg.name, 'color', tg.color) ORDER BY tg.position, LOWER(tg.name))
+		FROM todo_tags tt
+		JOIN tags tg ON tg.id = tt.tag_id
+		WHERE tt.todo_id = todos.id
+	), '[]')`
+
+// scanTodo scans a row selected with todoColumns into a ToDo.
+func scanTodo(row pgx.Row) (*models.ToDo, error) {
+	var todo models.ToDo
+	var dueAt, dueDate, startAt, startDate *time.Time
+	var recurrenceID *string
+	var priority int16
+
+	err := row.Scan(
+		&todo.ID,
+		&todo.Title,
+		&todo.Notes,
+		&todo.Completed,
+		&priority,
+		&todo.ProjectID,
+		&todo.ParentID,
+		&dueAt,
+		&dueDate,
+		&startAt,
+		&startDate,
+		&todo.SeriesID,
+		&recurrenceID,
+		&todo.CreatedAt,
+		&todo.UpdatedAt,
+		&todo.UserID,
+		&todo.Tags,
+		&todo.Subtasks.Done,
+		&todo.Subtasks.Total,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	todo.Priority = models.Priority(priority)
+	todo.Links = []string{}
+
+	if todo.Notes != nil {
+		todo.Links = markdown.Links(*todo.Notes)
+	}
+
+	todo.DueAt = calendarTimeFromColumns(dueAt, dueDate)
+	todo.StartAt = calendarTimeFromColumns(startAt, startDate)
+
+	if recurrenceID != nil {
+		parsed, err := models.ParseCalendarTime(*recurrenceID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		todo.RecurrenceID = &parsed
+	}
+
+	return &todo, nil
+}
+
+// recurrenceIDColumn is the value stored in todos.recurrence_id.
+func recurrenceIDColumn(t *models.CalendarTime) *string {
+	if t == nil {
+		return nil
+	}
+
+	value := t.String()
+
+	return &value
+}
+
+// calendarTimeFromColumns combines the instant and date columns of a
+// CalendarTime; at most one of them is set.
+func calendarTimeFromColumns(at *time.Time, date *time.Time) *models.CalendarTime {
+	switch {
+	case at != nil:
+		return &models.CalendarTime{Time: at.UTC()}
+	case date != nil:
+		return &models.CalendarTime{Time: time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC), DateOnly: true}
+	default:
+		return nil
+	}
+}
+
+// calendarTimeColumns splits a CalendarTime into its instant and date
+// column values.
+func calendarTimeColumns(t *models.CalendarTime) (*time.Time, *time.Time) {
+	if t == nil {
+		return nil, nil
+	}
+
+	value := t.Time
+
+	if t.DateOnly {
+		return nil, &value
+	}
+
+	return &value, nil
+}
+
 /*
 CreateTodo inserts a new ToDo into the database for a specific user.
 
@@ -18,14 +137,14 @@ This function:
   - Returns the newly created ToDo including auto-generated fields
 
 Parameters:
-  pool      - PostgreSQL connection pool
-  title     - Title of the ToDo
-  completed - Initial completion status
-  userID    - ID of the user who owns the ToDo
+  pool - PostgreSQL connection pool
+  todo - ToDo with Title, optional Notes, Completed, Priority, optional
+         ProjectID and ParentID, optional DueAt/StartAt, the SeriesID and RecurrenceID
+         of an occurrence, and the UserID of the user who owns it
 
 Returns:
   *models.ToDo - The created ToDo object
-  error        - Database or execution error
+  error        - ErrParentNotFound, ErrTodoTooDeep or a database error
 
 Security:
   The userID ensures the ToDo is associated with the correct authenticated user.
@@ -33,51 +152,116 @@ Security:
 Database fields returned:
   - id
   - title
+  - notes
   - completed
+  - priority
+  - project_id
+  - parent_id
+  - due_at / due_date
+  - start_at / start_date
+  - series_id
+  - recurrence_id
   - created_at
   - updated_at
   - user_id
+  - tags (none yet)
+  - subtasks (none yet)
 */
-func CreateTodo(pool *pgxpool.Pool, title string, completed bool, userID string) (*models.ToDo, error) {
+func CreateTodo(pool *pgxpool.Pool, todo *models.ToDo) (*models.ToDo, error) {
 	var ctx context.Context
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	dueAt, dueDate := calendarTimeColumns(todo.DueAt)
+	startAt, startDate := calendarTimeColumns(todo.StartAt)
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if todo.ParentID != nil {
+		if err = checkTodoParent(ctx, tx, todo.UserID, 0, *todo.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
 	var query string = `
-		INSERT INTO todos (title, completed, user_id)
-		VALUES ($1, $2, $3)
-		RETURNING id, title, completed, created_at, updated_at, user_id
-	`
-	var todo models.ToDo
+		INSERT INTO todos (title, notes, completed, priority, project_id, parent_id, due_at, due_date, start_at, start_date, series_id, recurrence_id, user_id)
+		VALUES ($1, $13, $2, $10, $11, $12, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + todoColumns
 
-	var err error = pool.QueryRow(ctx, query, title, completed, userID).Scan(
-		&todo.ID,
-		&todo.Title,
-		&todo.Completed,
-		&todo.CreatedAt,
-		&todo.UpdatedAt,
-		&todo.UserID,
-	)
+	created, err := scanTodo(tx.QueryRow(ctx, query, todo.Title, todo.Completed, dueAt, dueDate, startAt, startDate, todo.SeriesID, recurrenceIDColumn(todo.RecurrenceID), todo.UserID, int16(todo.Priority), todo.ProjectID, todo.ParentID, todo.Notes))
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &todo, nil
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Values of TodoFilter.Due.
+const (
+	DueOverdue  = "overdue"
+	DueToday    = "today"
+	DueUpcoming = "upcoming"
+)
+
+/*
+TodoFilter narrows GetAllTodos. Zero fields do not filter.
+
+Due selects todos by due date, relative to the user's current day:
+  overdue  - Not completed and due before now (or, for a whole-day due
+             date, before today)
+  today    - Due at some point of today
+  upcoming - Due after today
+
+Today and Tomorrow are the first instants of the user's current and next
+day, in the user's time zone (see models.StartOfDay); Now is the current
+time. They are only used when Due is set.
+
+Priorities keeps todos with any of the given priorities; Tags keeps todos
+that carry every one of the given tag names (ignoring case).
+
+Project is ProjectInbox for the todos without a project, or a project ID.
+Without it, the todos of archived projects are left out.
+
+Search keeps todos whose title or notes contain the text, ignoring case.
+*/
+type TodoFilter struct {
+	Due        string
+	Now        time.Time
+	Today      time.Time
+	Tomorrow   time.Time
+	Priorities []models.Priority
+	Tags       []string
+	Project    string
+	Search     string
 }
 
+// ProjectInbox selects the todos without a project in TodoFilter.
+const ProjectInbox = "inbox"
+
 /*
 GetAllTodos retrieves all ToDos belonging to a specific user.
 
 This function:
   - Uses a timeout-protected context
-  - Queries all ToDos filtered by user_id
+  - Queries all ToDos filtered by user_id and the optional filter
   - Orders results by creation time (newest first)
 
 Parameters:
   pool   - PostgreSQL connection pool
   userID - ID of the authenticated user
+  filter - Optional due date filter
 
 Returns:
   []models.ToDo - Slice of ToDos belonging to the user
@@ -86,19 +270,78 @@ Returns:
 Security:
   Ensures users can only retrieve their own ToDos via WHERE user_id clause.
 */
-func GetAllTodos(pool *pgxpool.Pool, userID string) ([]models.ToDo, error) {
+func GetAllTodos(pool *pgxpool.Pool, userID string, filter TodoFilter) ([]models.ToDo, error) {
 	var ctx context.Context
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	var conditions []string = []string{"user_id = $1"}
+	var args []interface{} = []interface{}{userID}
+
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if len(filter.Priorities) > 0 {
+		var priorities []int16
+
+		for _, priority := range filter.Priorities {
+			priorities = append(priorities, int16(priority))
+		}
+
+		conditions = append(conditions, "priority = ANY("+param(priorities)+")")
+	}
+
+	switch filter.Project {
+	case "":
+		conditions = append(conditions, `(project_id IS NULL OR NOT EXISTS (
+		SELECT 1 FROM projects p WHERE p.id = todos.project_id AND p.archived_at IS NOT NULL
+	))`)
+	case ProjectInbox:
+		conditions = append(conditions, "project_id IS NULL")
+	default:
+		conditions = append(conditions, "project_id = "+param(filter.Project))
+	}
+
+	if filter.Search != "" {
+		pattern := param("%" + escapeLike(filter.Search) + "%")
+		conditions = append(conditions, "(title ILIKE "+pattern+" OR notes ILIKE "+pattern+")")
+	}
+
+	for _, tag := range filter.Tags {
+		conditions = append(conditions, `EXISTS (
+		SELECT 1 FROM todo_tags tt JOIN tags tg ON tg.id = tt.tag_id
+		WHERE tt.todo_id = todos.id AND LOWER(tg.name) = LOWER(`+param(tag)+`)
+	)`)
+	}
+
+	if filter.Due != "" {
+		// Whole-day due dates are compared with the user's calendar date,
+		// instants with the boundaries of the user's day.
+		year, month, day := filter.Today.Date()
+		todayDate := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+		switch filter.Due {
+		case DueOverdue:
+			conditions = append(conditions, "NOT completed AND (due_at < "+param(filter.Now)+" OR due_date < "+param(todayDate)+")")
+		case DueToday:
+			conditions = append(conditions, "((due_at >= "+param(filter.Today)+" AND due_at < "+param(filter.Tomorrow)+") OR due_date = "+param(todayDate)+")")
+		case DueUpcoming:
+			conditions = append(conditions, "(due_at >= "+param(filter.Tomorrow)+" OR due_date > "+param(todayDate)+")")
+		default:
+			return nil, fmt.Errorf("unknown due filter %q", filter.Due)
+		}
+	}
+
 	var query string = `
-	SELECT id, title, completed, created_at, updated_at, user_id
+	SELECT ` + todoColumns + `
 	FROM todos
-	WHERE user_id = $1
+	WHERE ` + strings.Join(conditions, " AND ") + `
 	ORDER BY created_at DESC
 	`
-	rows, err := pool.Query(ctx, query, userID)
+	rows, err := pool.Query(ctx, query, args...)
 
 	if err != nil {
 		return nil, err
@@ -109,22 +352,13 @@ func GetAllTodos(pool *pgxpool.Pool, userID string) ([]models.ToDo, error) {
 	var todos []models.ToDo = []models.ToDo{}
 
 	for rows.Next() {
-		var todo models.ToDo
-
-		err = rows.Scan(
-			&todo.ID,
-			&todo.Title,
-			&todo.Completed,
-			&todo.CreatedAt,
-			&todo.UpdatedAt,
-			&todo.UserID,
-		)
+		todo, err := scanTodo(rows)
 
 		if err != nil {
 			return nil, err
 		}
 
-		todos = append(todos, todo)
+		todos = append(todos, *todo)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -134,6 +368,52 @@ func GetAllTodos(pool *pgxpool.Pool, userID string) ([]models.ToDo, error) {
 	return todos, nil
 }
 
+/*
+StreamTodos calls fn for every ToDo of a user, oldest first, without
+loading them all into memory.
+
+Unlike the other functions here it takes the caller's context, because
+streaming a large account can take longer than the usual 5 seconds.
+
+Parameters:
+  ctx    - Bounds the whole query
+  pool   - PostgreSQL connection pool
+  userID - ID of the user whose ToDos are read
+  fn     - Called once per ToDo; returning an error stops the stream
+
+Returns:
+  error - Database error or the error returned by fn
+*/
+func StreamTodos(ctx context.Context, pool *pgxpool.Pool, userID string, fn func(*models.ToDo) error) error {
+	var query string = `
+	SELECT ` + todoColumns + `
+	FROM todos
+	WHERE user_id = $1
+	ORDER BY created_at, id
+	`
+	rows, err := pool.Query(ctx, query, userID)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+
+		if err != nil {
+			return err
+		}
+
+		if err = fn(todo); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 /*
 GetTodoByID retrieves a specific ToDo by its ID and owner.
 
@@ -161,120 +441,180 @@ func GetTodoByID(pool *pgxpool.Pool, id int, userID string) (*models.ToDo, error
 	defer cancel()
 
 	var query string = `
-	SELECT id, title, completed, created_at, updated_at, user_id
+	SELECT ` + todoColumns + `
 	FROM todos
 	WHERE id = $1 AND user_id = $2
 	`
-	var todo models.ToDo
-
-	var err error = pool.QueryRow(ctx, query, id, userID).Scan(
-		&todo.ID,
-		&todo.Title,
-		&todo.Completed,
-		&todo.CreatedAt,
-		&todo.UpdatedAt,
-		&todo.UserID,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &todo, nil
+	return scanTodo(pool.QueryRow(ctx, query, id, userID))
 }
 
 /*
 UpdateTodo modifies an existing ToDo.
 
 This function:
-  - Updates title and completion status
+  - Updates title, notes, completion status, priority, project, parent,
+    due date and start date
   - Updates the updated_at timestamp automatically
   - Ensures only the owner can update the ToDo
+  - Optionally completes every subtask in the same transaction, so they
+    are left unchanged if the update fails
 
 Parameters:
-  pool      - PostgreSQL connection pool
-  id        - ToDo ID
-  title     - Updated title
-  completed - Updated completion status
-  userID    - Owner user ID
+  pool             - PostgreSQL connection pool
+  todo             - ToDo with its ID, owner UserID and the new field
+                     values
+  completeSubtasks - Whether the subtasks, at every level, are completed
+                     too
 
 Returns:
   *models.ToDo - Updated ToDo object
-  error        - Database or authorization error
+  error        - pgx.ErrNoRows if the user has no such todo;
+                 ErrParentNotFound, ErrTodoCycle or ErrTodoTooDeep if the
+                 parent cannot be used; or a database error
 
 Security:
   Prevents unauthorized updates by validating user ownership.
 */
-func UpdateTodo(pool *pgxpool.Pool, id int, title string, completed bool, userID string) (*models.ToDo, error) {
+func UpdateTodo(pool *pgxpool.Pool, todo *models.ToDo, completeSubtasks bool) (*models.ToDo, error) {
 	var ctx context.Context
 	var cancel context.CancelFunc
 
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	dueAt, dueDate := calendarTimeColumns(todo.DueAt)
+	startAt, startDate := calendarTimeColumns(todo.StartAt)
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if todo.ParentID != nil {
+		if err = checkTodoParent(ctx, tx, todo.UserID, todo.ID, *todo.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The subtasks are completed first so that the progress returned with
+	// the todo already counts them.
+	if completeSubtasks {
+		if err = completeTodoSubtasks(ctx, tx, todo.ID, todo.UserID); err != nil {
+			return nil, err
+		}
+	}
+
 	var query string = `
 	UPDATE todos
-	SET title = $1, completed = $2, updated_at = CURRENT_TIMESTAMP
-	WHERE id = $3 AND user_id = $4
-	RETURNING id, title, completed, created_at, updated_at, user_id
-	`
-	var todo models.ToDo
+	SET title = $1, notes = $12, completed = $2, priority = $9, project_id = $10, parent_id = $11, due_at = $3, due_date = $4, start_at = $5, start_date = $6, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $7 AND user_id = $8
+	RETURNING ` + todoColumns
 
-	var err error = pool.QueryRow(ctx, query, title, completed, id, userID).Scan(
-		&todo.ID,
-		&todo.Title,
-		&todo.Completed,
-		&todo.CreatedAt,
-		&todo.UpdatedAt,
-		&todo.UserID,
-	)
+	updated, err := scanTodo(tx.QueryRow(ctx, query, todo.Title, todo.Completed, dueAt, dueDate, startAt, startDate, todo.ID, todo.UserID, int16(todo.Priority), todo.ProjectID, todo.ParentID, todo.Notes))
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &todo, nil
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
 }
 
+// What DeleteTodo does with the subtasks of a deleted todo.
+const (
+	// DeleteSubtasks deletes the subtasks along with the todo.
+	DeleteSubtasks = "delete"
+
+	// PromoteSubtasks moves the direct subtasks up to the todo's level,
+	// under the todo's parent or to the top level.
+	PromoteSubtasks = "promote"
+)
+
 /*
 DeleteTodo removes a ToDo from the database.
 
 This function:
   - Ensures only the owner can delete the ToDo
-  - Uses Exec since no row is returned
-  - Checks RowsAffected to confirm deletion occurred
+  - Deletes the subtasks too, or first moves them up to the todo's level,
+    in one transaction
+  - Locks the todo so a concurrent change cannot add a subtask that would
+    be missed
 
 Parameters:
-  pool   - PostgreSQL connection pool
-  id     - ToDo ID
-  userID - Owner user ID
+  pool     - PostgreSQL connection pool
+  id       - ToDo ID
+  userID   - Owner user ID
+  subtasks - DeleteSubtasks or PromoteSubtasks
 
 Returns:
-  error - nil if successful, error otherwise
+  error - nil if successful, ErrTodoNotFound if the user has no such
+          todo, or a database error
 
 Security:
   Prevents users from deleting ToDos they do not own.
 */
-func DeleteTodo(pool *pgxpool.Pool, id int, userID string) error {
+func DeleteTodo(pool *pgxpool.Pool, id int, userID string, subtasks string) error {
 	var ctx context.Context
 	var cancel context.CancelFunc
 
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var query string = `
-	DELETE FROM todos
+	if subtasks != DeleteSubtasks && subtasks != PromoteSubtasks {
+		return fmt.Errorf("unknown subtask handling %q", subtasks)
+	}
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if err = lockTodoTree(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	var parentID *int
+
+	err = tx.QueryRow(ctx, `
+	SELECT parent_id FROM todos
 	WHERE id = $1 AND user_id = $2
-	`
-	var commandTag, err = pool.Exec(ctx, query, id, userID)
+	FOR UPDATE
+	`, id, userID).Scan(&parentID)
 
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTodoNotFound
+		}
+
 		return err
 	}
 
-	if commandTag.RowsAffected() == 0 {
-		return fmt.Errorf("ToDo with id: %v not found", id)
+	if subtasks == PromoteSubtasks {
+		_, err = tx.Exec(ctx, `
+		UPDATE todos
+		SET parent_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE parent_id = $1
+		`, id, parentID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// The subtasks that are still attached go with the todo through the
+	// ON DELETE CASCADE of parent_id.
+	if _, err = tx.Exec(ctx, `DELETE FROM todos WHERE id = $1`, id); err != nil {
+		return err
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
@@ -0,0 +1,553 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todos_api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const todoSeriesColumns = `id, user_id, title, rrule, dtstart, all_day, time_zone, last_recurrence_id, ended_at, created_at, updated_at`
+
+func scanTodoSeries(row pgx.Row) (*models.TodoSeries, error) {
+	var series models.TodoSeries
+	var lastRecurrenceID *string
+
+	err := row.Scan(
+		&series.ID,
+		&series.UserID,
+		&series.Title,
+		&series.RRule,
+		&series.DTStart.Time,
+		&series.DTStart.DateOnly,
+		&series.TimeZone,
+		&lastRecurrenceID,
+		&series.EndedAt,
+		&series.CreatedAt,
+		&series.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	series.DTStart.Time = series.DTStart.Time.UTC()
+
+	if lastRecurrenceID != nil {
+		parsed, err := models.ParseCalendarTime(*lastRecurrenceID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		series.LastRecurrenceID = &parsed
+	}
+
+	return &series, nil
+}
+
+// insertOccurrence creates the todo of one occurrence of a series, with
+// the notes, priority and project of template if it is not nil. It
+// returns pgx.ErrNoRows if the occurrence already exists.
+func insertOccurrence(ctx context.Context, tx pgx.Tx, series *models.TodoSeries, occurrence *models.CalendarTime, template *models.ToDo) (*models.ToDo, error) {
+	dueAt, dueDate := calendarTimeColumns(occurrence)
+
+	var notes *string
+	var priority models.Priority
+	var projectID *string
+
+	if template != nil {
+		notes = template.Notes
+		priority = template.Priority
+		projectID = template.ProjectID
+	}
+
+	var query string = `
+	INSERT INTO todos (title, notes, completed, priority, project_id, due_at, due_date, series_id, recurrence_id, user_id)
+	VALUES ($1, $9, FALSE, $7, $8, $2, $3, $4, $5, $6)
+	ON CONFLICT (series_id, recurrence_id) DO NOTHING
+	RETURNING ` + todoColumns
+
+	return scanTodo(tx.QueryRow(ctx, query, series.Title, dueAt, dueDate, series.ID, recurrenceIDColumn(occurrence), series.UserID, int16(priority), projectID, notes))
+}
+
+/*
+CreateTodoSeries stores a new recurring todo and creates the todo of its
+first occurrence.
+
+Parameters:
+  pool     - PostgreSQL connection pool
+  series   - Series with UserID, Title, RRule, DTStart and TimeZone
+  first    - First occurrence
+  template - Notes, Priority and ProjectID of the first occurrence; later
+             ones inherit them from the occurrence before
+
+Returns:
+  *models.ToDo - Todo of the first occurrence
+  error        - Database error
+*/
+func CreateTodoSeries(pool *pgxpool.Pool, series *models.TodoSeries, first *models.CalendarTime, template *models.ToDo) (*models.ToDo, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+	INSERT INTO todo_series (user_id, title, rrule, dtstart, all_day, time_zone, last_recurrence_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id
+	`, series.UserID, series.Title, series.RRule, series.DTStart.Time, series.DTStart.DateOnly, series.TimeZone, recurrenceIDColumn(first)).Scan(&series.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	todo, err := insertOccurrence(ctx, tx, series, first, template)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+/*
+GetTodoSeries retrieves one of a user's series.
+
+Returns:
+  *models.TodoSeries - Series if found
+  error              - pgx.ErrNoRows if it does not exist or belongs to
+                       someone else
+*/
+func GetTodoSeries(pool *pgxpool.Pool, id string, userID string) (*models.TodoSeries, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + todoSeriesColumns + `
+	FROM todo_series
+	WHERE id = $1 AND user_id = $2
+	`
+
+	return scanTodoSeries(pool.QueryRow(ctx, query, id, userID))
+}
+
+/*
+GetTodoSeriesForUser lists every series of a user, for the data export.
+
+Returns:
+  []models.TodoSeries - Series, oldest first
+  error               - Database error
+*/
+func GetTodoSeriesForUser(pool *pgxpool.Pool, userID string) ([]models.TodoSeries, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	SELECT ` + todoSeriesColumns + `
+	FROM todo_series
+	WHERE user_id = $1
+	ORDER BY created_at
+	`
+	rows, err := pool.Query(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var series []models.TodoSeries = []models.TodoSeries{}
+
+	for rows.Next() {
+		item, err := scanTodoSeries(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		series = append(series, *item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
+
+/*
+CreateNextOccurrence moves a series on once the given occurrence has been
+completed or is about to be skipped.
+
+Only the latest occurrence of a series moves it on; for an older one,
+reopened and completed again, nothing happens. The relative reminders of
+the previous occurrence, its notes, priority, project and tags are
+carried over to the new one. When the rule has no
+next occurrence the series ends.
+
+Parameters:
+  pool     - PostgreSQL connection pool
+  series   - Series of the occurrence
+  previous - Todo of the completed or skipped occurrence
+  next     - Next occurrence of the rule, nil if there is none
+
+Returns:
+  *models.ToDo - Todo of the new occurrence, nil if none was created
+  error        - Database error
+*/
+func CreateNextOccurrence(pool *pgxpool.Pool, series *models.TodoSeries, previous *models.ToDo, next *models.CalendarTime) (*models.ToDo, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	// Locking the series makes concurrent completions of the same
+	// occurrence wait for each other; the second one then sees that the
+	// series has already moved on.
+	var lastRecurrenceID *string
+	var ended bool
+
+	err = tx.QueryRow(ctx, `
+	SELECT last_recurrence_id, ended_at IS NOT NULL
+	FROM todo_series
+	WHERE id = $1 AND user_id = $2
+	FOR UPDATE
+	`, series.ID, series.UserID).Scan(&lastRecurrenceID, &ended)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ended || lastRecurrenceID == nil || previous.RecurrenceID == nil || *lastRecurrenceID != previous.RecurrenceID.String() {
+		return nil, nil
+	}
+
+	if next == nil {
+		_, err = tx.Exec(ctx, `UPDATE todo_series SET ended_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, series.ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, tx.Commit(ctx)
+	}
+
+	todo, err := insertOccurrence(ctx, tx, series, next, previous)
+
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	if todo != nil {
+		_, err = tx.Exec(ctx, `
+		INSERT INTO todo_tags (todo_id, tag_id)
+		SELECT $2, tag_id FROM todo_tags WHERE todo_id = $1
+		`, previous.ID, todo.ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		todo.Tags = previous.Tags
+
+		_, err = tx.Exec(ctx, `
+		INSERT INTO reminders (todo_id, user_id, offset_minutes, channel, webhook_url, fire_at)
+		SELECT t.id, p.user_id, p.offset_minutes, p.channel, p.webhook_url, `+reminderFireAt("p.offset_minutes", "p.remind_at")+`
+		FROM reminders p
+		JOIN todos t ON t.id = $2
+		JOIN users u ON u.id = p.user_id
+		WHERE p.todo_id = $1 AND p.offset_minutes IS NOT NULL
+		`, previous.ID, todo.ID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE todo_series
+	SET last_recurrence_id = $2, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	`, series.ID, recurrenceIDColumn(next))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+/*
+GetCompletedRecurrenceIDs returns the recurrence IDs of the completed
+occurrences of a series.
+
+Returns:
+  map[string]bool - Set of CalendarTime strings
+  error           - Database error
+*/
+func GetCompletedRecurrenceIDs(pool *pgxpool.Pool, seriesID string) (map[string]bool, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := pool.Query(ctx, `
+	SELECT recurrence_id
+	FROM todos
+	WHERE series_id = $1 AND completed AND recurrence_id IS NOT NULL
+	`, seriesID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids map[string]bool = map[string]bool{}
+
+	for rows.Next() {
+		var id string
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+/*
+UpdateTodoSeries changes a whole series: its title and rule, and its open
+occurrences to match.
+
+The newest open occurrence is moved to first and gets the new title;
+other open occurrences are deleted. Completed occurrences are kept as
+they are.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  series - Series with its ID, UserID and new Title, RRule, DTStart and
+           TimeZone
+  first  - First occurrence under the new rule that has not been
+           completed yet; nil ends the series
+
+Returns:
+  *models.ToDo - Todo of the open occurrence, nil if the series ended
+  error        - pgx.ErrNoRows if the series does not exist or belongs to
+                 someone else, or a database error
+*/
+func UpdateTodoSeries(pool *pgxpool.Pool, series *models.TodoSeries, first *models.CalendarTime) (*models.ToDo, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx, `
+	UPDATE todo_series
+	SET title = $3, rrule = $4, dtstart = $5, all_day = $6, time_zone = $7, last_recurrence_id = $8,
+		ended_at = CASE WHEN $8::varchar IS NULL THEN CURRENT_TIMESTAMP END,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND user_id = $2
+	`, series.ID, series.UserID, series.Title, series.RRule, series.DTStart.Time, series.DTStart.DateOnly, series.TimeZone, recurrenceIDColumn(first))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return nil, pgx.ErrNoRows
+	}
+
+	var keepID *int
+
+	err = tx.QueryRow(ctx, `
+	SELECT MAX(id) FROM todos WHERE series_id = $1 AND NOT completed
+	`, series.ID).Scan(&keepID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if first == nil {
+		keepID = nil
+	}
+
+	_, err = tx.Exec(ctx, `
+	DELETE FROM todos
+	WHERE series_id = $1 AND NOT completed AND id IS DISTINCT FROM $2
+	`, series.ID, keepID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var todo *models.ToDo
+
+	switch {
+	case first == nil:
+	case keepID == nil:
+		todo, err = insertOccurrence(ctx, tx, series, first, nil)
+	default:
+		dueAt, dueDate := calendarTimeColumns(first)
+
+		todo, err = scanTodo(tx.QueryRow(ctx, `
+		UPDATE todos
+		SET title = $2, due_at = $3, due_date = $4, recurrence_id = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+todoColumns, *keepID, series.Title, dueAt, dueDate, recurrenceIDColumn(first)))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+/*
+DeleteTodoSeries stops a series. Its open occurrences are deleted;
+completed ones are kept as ordinary todos.
+
+Returns:
+  error - pgx.ErrNoRows if the series does not exist or belongs to
+          someone else, or a database error
+
+Security:
+  Uses BOTH id AND user_id so users can only delete their own series.
+*/
+func DeleteTodoSeries(pool *pgxpool.Pool, id string, userID string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+	DELETE FROM todos
+	WHERE series_id = $1 AND user_id = $2 AND NOT completed
+	`, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	commandTag, err := tx.Exec(ctx, `
+	DELETE FROM todo_series
+	WHERE id = $1 AND user_id = $2
+	`, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return tx.Commit(ctx)
+}
+
+/*
+UpdateTodoSeriesTitle renames a series and its open occurrences.
+
+Returns:
+  error - pgx.ErrNoRows if the series does not exist or belongs to
+          someone else, or a database error
+*/
+func UpdateTodoSeriesTitle(pool *pgxpool.Pool, id string, userID string, title string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx, `
+	UPDATE todo_series
+	SET title = $3, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND user_id = $2
+	`, id, userID, title)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	_, err = tx.Exec(ctx, `
+	UPDATE todos
+	SET title = $2, updated_at = CURRENT_TIMESTAMP
+	WHERE series_id = $1 AND NOT completed
+	`, id, title)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -2,12 +2,48 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 	"todos_api/internal/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
+// userColumns is the column list every user query returns, in the order
+// expected by scanUser.
+const userColumns = `id, email, password, display_name, time_zone, role, email_verified_at, disabled_at, password_reset_required, deleted_at, created_at, updated_at`
+
+// scanUser scans a row selected with userColumns into a User.
+func scanUser(row pgx.Row) (*models.User, error) {
+	var user models.User
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.Password,
+		&user.DisplayName,
+		&user.TimeZone,
+		&user.Role,
+		&user.EmailVerifiedAt,
+		&user.DisabledAt,
+		&user.PasswordResetRequired,
+		&user.DeletedAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 /*
 CreateUser inserts a new user into the database.
 
@@ -33,6 +69,12 @@ Database fields returned:
   - id
   - email
   - password (hashed)
+  - display_name
+  - role
+  - email_verified_at
+  - disabled_at
+  - password_reset_required
+  - deleted_at
   - created_at
   - updated_at
 
@@ -49,28 +91,17 @@ func CreateUser(pool *pgxpool.Pool, user *models.User) (*models.User, error) {
 	var query string = `
 	INSERT INTO users (email, password)
 	VALUES ($1, $2)
-	RETURNING id, email, password, created_at, updated_at
-	`
-
-	err := pool.QueryRow(ctx, query, user.Email, user.Password).Scan(
-		&user.ID,
-		&user.Email,
-		&user.Password,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
+	RETURNING ` + userColumns
 
-	return user, nil
+	return scanUser(pool.QueryRow(ctx, query, user.Email, user.Password))
 }
 
 /*
 GetUserByEmail retrieves a user from the database using their email address.
 
 This function is primarily used for authentication during login.
+The comparison is case-insensitive so accounts created before emails were
+normalized can still be found.
 
 Parameters:
   pool  - PostgreSQL connection pool
@@ -93,6 +124,12 @@ Returned fields:
   - id
   - email
   - password (hashed)
+  - display_name
+  - role
+  - email_verified_at
+  - disabled_at
+  - password_reset_required
+  - deleted_at
   - created_at
   - updated_at
 */
@@ -103,26 +140,14 @@ func GetUserByEmail(pool *pgxpool.Pool, email string) (*models.User, error) {
 	defer cancel()
 
 	var query string = `
-		SELECT id, email, password, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
-		WHERE email = $1
+		WHERE lower(email) = lower($1)
 	`
-	var user models.User
-
-	err := pool.QueryRow(ctx, query, email).Scan(
-		&user.ID,
-		&user.Email,
-		&user.Password,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
 
-	return &user, nil
+	return scanUser(pool.QueryRow(ctx, query, email))
 }
+
 /*
 GetUserByID retrieves a user by their unique ID.
 
@@ -147,31 +172,74 @@ Returned fields:
   - id
   - email
   - password (hashed)
+  - display_name
+  - role
+  - email_verified_at
+  - disabled_at
+  - password_reset_required
+  - deleted_at
   - created_at
   - updated_at
 
 Common usage flow:
   JWT Token → extract user_id → call GetUserByID → authorize request
 */
-func GetUserByID(pool *pgxpool.Pool, id int) (*models.User, error) {
+func GetUserByID(pool *pgxpool.Pool, id string) (*models.User, error) {
 	var ctx context.Context
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var query string = `
-		SELECT id, email, password, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = $1
 	`
-	var user models.User
 
-	err := pool.QueryRow(ctx, query, id).Scan(
+	return scanUser(pool.QueryRow(ctx, query, id))
+}
+
+// UserFilter narrows down the users returned by ListUsers.
+type UserFilter struct {
+	Search string // Case-insensitive substring of the email address
+	Role   string // Only users with this role, if set
+	Status string // "active", "disabled" or "deleted", if set
+	Limit  int
+	Offset int
+}
+
+// userWithTodoCountsQuery selects users together with their todo counts.
+// Callers append a WHERE clause on u and the ordering.
+const userWithTodoCountsQuery = `
+	SELECT u.id, u.email, u.password, u.display_name, u.time_zone, u.role, u.email_verified_at, u.disabled_at,
+		u.password_reset_required, u.deleted_at, u.created_at, u.updated_at,
+		COALESCE(t.total, 0), COALESCE(t.completed, 0)
+	FROM users u
+	LEFT JOIN (
+		SELECT user_id, COUNT(*) AS total, COUNT(*) FILTER (WHERE completed) AS completed
+		FROM todos
+		GROUP BY user_id
+	) t ON t.user_id = u.id
+`
+
+func scanUserWithTodoCounts(row pgx.Row) (*models.UserWithTodoCounts, error) {
+	var user models.UserWithTodoCounts
+
+	err := row.Scan(
 		&user.ID,
 		&user.Email,
 		&user.Password,
+		&user.DisplayName,
+		&user.TimeZone,
+		&user.Role,
+		&user.EmailVerifiedAt,
+		&user.DisabledAt,
+		&user.PasswordResetRequired,
+		&user.DeletedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.TodoCount,
+		&user.CompletedTodoCount,
 	)
 
 	if err != nil {
@@ -180,3 +248,377 @@ func GetUserByID(pool *pgxpool.Pool, id int) (*models.User, error) {
 
 	return &user, nil
 }
+
+/*
+ListUsers returns one page of users matching the filter, with their todo
+counts, ordered by creation time (oldest first).
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  filter - Search, role and status filters plus Limit/Offset
+
+Returns:
+  []models.UserWithTodoCounts - Users on the requested page
+  int                         - Total number of users matching the filter
+  error                       - Database error
+
+Security:
+  Admin only. Password hashes are scanned but never serialized.
+*/
+func ListUsers(pool *pgxpool.Pool, filter UserFilter) ([]models.UserWithTodoCounts, int, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var conditions []string
+	var args []interface{}
+
+	if filter.Search != "" {
+		args = append(args, "%"+escapeLike(filter.Search)+"%")
+		conditions = append(conditions, "u.email ILIKE $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.Role != "" {
+		args = append(args, filter.Role)
+		conditions = append(conditions, "u.role = $"+strconv.Itoa(len(args)))
+	}
+
+	switch filter.Status {
+	case "active":
+		conditions = append(conditions, "u.disabled_at IS NULL AND u.deleted_at IS NULL")
+	case "disabled":
+		conditions = append(conditions, "u.disabled_at IS NOT NULL")
+	case "deleted":
+		conditions = append(conditions, "u.deleted_at IS NOT NULL")
+	}
+
+	var where string
+
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+
+	err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM users u `+where, args...).Scan(&total)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	var query string = userWithTodoCountsQuery + where + `
+	ORDER BY u.created_at, u.id
+	LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+
+	rows, err := pool.Query(ctx, query, args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var users []models.UserWithTodoCounts = []models.UserWithTodoCounts{}
+
+	for rows.Next() {
+		user, err := scanUserWithTodoCounts(rows)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		users = append(users, *user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+/*
+GetUserWithTodoCounts retrieves a single user with their todo counts.
+
+Returns:
+  *models.UserWithTodoCounts - User record if found
+  error                      - pgx.ErrNoRows if user does not exist
+*/
+func GetUserWithTodoCounts(pool *pgxpool.Pool, id string) (*models.UserWithTodoCounts, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return scanUserWithTodoCounts(pool.QueryRow(ctx, userWithTodoCountsQuery+`WHERE u.id = $1`, id))
+}
+
+/*
+SetUserDisabled disables or re-enables an account.
+
+Disabling an already disabled account keeps the original disabled_at.
+Callers must also revoke the user's tokens, see
+auth.RevocationStore.RevokeAllForUser.
+
+Parameters:
+  pool     - PostgreSQL connection pool
+  id       - User ID
+  disabled - true to disable, false to enable
+
+Returns:
+  error - ErrUserNotFound or a database error
+*/
+func SetUserDisabled(pool *pgxpool.Pool, id string, disabled bool) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE users
+	SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	`
+	commandTag, err := pool.Exec(ctx, query, id, disabled)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+/*
+SetPasswordResetRequired flags an account so that it cannot log in until
+the password is reset through the emailed reset link.
+
+The flag is cleared by ResetPasswordWithToken.
+
+Returns:
+  error - ErrUserNotFound or a database error
+*/
+func SetPasswordResetRequired(pool *pgxpool.Pool, id string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE users
+	SET password_reset_required = TRUE, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	`
+	commandTag, err := pool.Exec(ctx, query, id)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+/*
+UpdateUserProfile updates the fields a user may edit on their own profile.
+
+Parameters:
+  pool        - PostgreSQL connection pool
+  id          - User ID
+  displayName - New display name, with a nil value to clear it; kept if
+                not set
+  timeZone    - New IANA time zone name, nil to keep the current one
+
+Returns:
+  *models.User - Updated user
+  error        - pgx.ErrNoRows if user does not exist
+*/
+func UpdateUserProfile(pool *pgxpool.Pool, id string, displayName models.Nullable[string], timeZone *string) (*models.User, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE users
+	SET display_name = CASE WHEN $2 THEN $3 ELSE display_name END,
+		time_zone = COALESCE($4, time_zone),
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	RETURNING ` + userColumns
+
+	return scanUser(pool.QueryRow(ctx, query, id, displayName.Set, displayName.Value, timeZone))
+}
+
+/*
+UpdatePassword replaces a user's password hash.
+
+Callers must revoke the user's other tokens, see
+auth.RevocationStore.RevokeAllForUser.
+
+Parameters:
+  pool         - PostgreSQL connection pool
+  id           - User ID
+  passwordHash - Already hashed new password
+
+Returns:
+  error - ErrUserNotFound or a database error
+*/
+func UpdatePassword(pool *pgxpool.Pool, id string, passwordHash string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE users
+	SET password = $2, password_reset_required = FALSE, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	`
+	commandTag, err := pool.Exec(ctx, query, id, passwordHash)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+/*
+RehashPassword swaps a password hash for a stronger hash of the same
+password.
+
+The update only happens if the stored hash is still oldHash, so it never
+overwrites a password changed concurrently. It leaves updated_at alone
+since nothing about the account changed.
+
+Returns:
+  bool  - true if the hash was replaced
+  error - Database error
+*/
+func RehashPassword(pool *pgxpool.Pool, id string, oldHash string, newHash string) (bool, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	commandTag, err := pool.Exec(ctx, `UPDATE users SET password = $3 WHERE id = $1 AND password = $2`, id, oldHash, newHash)
+
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+/*
+SoftDeleteUser schedules an account for deletion.
+
+The row stays in place, and the account cannot sign in, until
+PurgeDeletedUsers removes it after the grace period. Deleting an account
+that is already scheduled keeps the original deleted_at.
+
+Returns:
+  *time.Time - When the account was marked deleted
+  error      - ErrUserNotFound or a database error
+*/
+func SoftDeleteUser(pool *pgxpool.Pool, id string) (*time.Time, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE users
+	SET deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	RETURNING deleted_at
+	`
+	var deletedAt *time.Time
+
+	err := pool.QueryRow(ctx, query, id).Scan(&deletedAt)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	return deletedAt, nil
+}
+
+/*
+RestoreUser cancels the scheduled deletion of an account.
+
+Returns:
+  error - ErrUserNotFound if the user does not exist or is not scheduled
+          for deletion, or a database error
+*/
+func RestoreUser(pool *pgxpool.Pool, id string) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var query string = `
+	UPDATE users
+	SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+	commandTag, err := pool.Exec(ctx, query, id)
+
+	if err != nil {
+		return err
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+/*
+PurgeDeletedUsers permanently removes accounts that were deleted before
+the given time.
+
+Everything the user owns (todos, tokens, two-factor settings, ...) is
+removed by the ON DELETE CASCADE foreign keys.
+
+Parameters:
+  pool   - PostgreSQL connection pool
+  before - Accounts deleted before this time are purged
+
+Returns:
+  int64 - Number of accounts purged
+  error - Database error
+*/
+func PurgeDeletedUsers(pool *pgxpool.Pool, before time.Time) (int64, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	commandTag, err := pool.Exec(ctx, `DELETE FROM users WHERE deleted_at < $1`, before)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return commandTag.RowsAffected(), nil
+}
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_invalid_before;
+
+DROP TABLE IF EXISTS revoked_tokens;
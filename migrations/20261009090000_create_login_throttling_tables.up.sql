@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+    key VARCHAR(320) PRIMARY KEY,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    blocked_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_throttles_last_failed_at ON login_throttles(last_failed_at);
+
+CREATE TABLE IF NOT EXISTS lockout_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    key VARCHAR(320) NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    event VARCHAR(20) NOT NULL,
+    ip_address VARCHAR(64),
+    locked_until TIMESTAMP WITH TIME ZONE,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_lockout_events_user_id ON lockout_events(user_id, created_at);
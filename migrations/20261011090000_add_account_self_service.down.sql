@@ -0,0 +1,6 @@
+ALTER TABLE email_verification_tokens DROP COLUMN IF EXISTS purpose;
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
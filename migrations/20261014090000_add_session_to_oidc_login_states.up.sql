@@ -0,0 +1,2 @@
+-- Whether an OpenID Connect login should end in a cookie session.
+ALTER TABLE oidc_login_states ADD COLUMN IF NOT EXISTS session BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS impersonation_audit_events;
+DROP TABLE IF EXISTS impersonations;
@@ -0,0 +1,12 @@
+ALTER TABLE users DROP COLUMN IF EXISTS time_zone;
+
+DROP INDEX IF EXISTS idx_todos_user_id_due_date;
+DROP INDEX IF EXISTS idx_todos_user_id_due_at;
+
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS chk_todos_start_kind;
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS chk_todos_due_kind;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS start_date;
+ALTER TABLE todos DROP COLUMN IF EXISTS start_at;
+ALTER TABLE todos DROP COLUMN IF EXISTS due_date;
+ALTER TABLE todos DROP COLUMN IF EXISTS due_at;
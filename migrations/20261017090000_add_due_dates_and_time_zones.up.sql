@@ -0,0 +1,15 @@
+-- A due or start date is either a whole day (*_date) or an instant (*_at),
+-- never both.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS due_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS due_date DATE;
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS start_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS start_date DATE;
+
+ALTER TABLE todos ADD CONSTRAINT chk_todos_due_kind CHECK (due_at IS NULL OR due_date IS NULL);
+ALTER TABLE todos ADD CONSTRAINT chk_todos_start_kind CHECK (start_at IS NULL OR start_date IS NULL);
+
+CREATE INDEX IF NOT EXISTS idx_todos_user_id_due_at ON todos(user_id, due_at);
+CREATE INDEX IF NOT EXISTS idx_todos_user_id_due_date ON todos(user_id, due_date);
+
+-- IANA time zone name, e.g. "Europe/Berlin".
+ALTER TABLE users ADD COLUMN IF NOT EXISTS time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,48 @@
+-- A reminder fires either offset_minutes before its todo is due or at
+-- remind_at. fire_at is the next time it fires, kept up to date when the
+-- due date, the owner's time zone or the snooze changes; it is NULL while
+-- a relative reminder's todo has no due date.
+CREATE TABLE IF NOT EXISTS reminders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    offset_minutes INTEGER,
+    remind_at TIMESTAMP WITH TIME ZONE,
+    channel VARCHAR(20) NOT NULL,
+    webhook_url VARCHAR(2048),
+    fire_at TIMESTAMP WITH TIME ZONE,
+    snoozed_until TIMESTAMP WITH TIME ZONE,
+    claimed_at TIMESTAMP WITH TIME ZONE,
+    retry_at TIMESTAMP WITH TIME ZONE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    sent_at TIMESTAMP WITH TIME ZONE,
+    failed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_reminders_kind CHECK ((offset_minutes IS NULL) <> (remind_at IS NULL)),
+    CONSTRAINT chk_reminders_webhook CHECK (channel <> 'webhook' OR webhook_url IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminders_todo_id ON reminders(todo_id);
+CREATE INDEX IF NOT EXISTS idx_reminders_user_id ON reminders(user_id);
+
+-- The scheduler only ever looks at reminders that still have to be sent.
+CREATE INDEX IF NOT EXISTS idx_reminders_pending ON reminders(COALESCE(retry_at, fire_at)) WHERE sent_at IS NULL AND failed_at IS NULL;
+
+-- In-app notifications, listed under GET /me/notifications.
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    todo_id INTEGER REFERENCES todos(id) ON DELETE SET NULL,
+    reminder_id UUID REFERENCES reminders(id) ON DELETE SET NULL,
+    fire_at TIMESTAMP WITH TIME ZONE,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created_at);
+
+-- A reminder delivered twice after a retry still shows up once.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_reminder ON notifications(reminder_id, fire_at);
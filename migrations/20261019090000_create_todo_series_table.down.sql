@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_todos_series_recurrence;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS recurrence_id;
+ALTER TABLE todos DROP COLUMN IF EXISTS series_id;
+
+DROP TABLE IF EXISTS todo_series;
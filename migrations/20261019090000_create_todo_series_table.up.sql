@@ -0,0 +1,29 @@
+-- A recurring todo. Only the next open occurrence exists as a todo; it is
+-- created when the previous one is completed or skipped.
+-- last_recurrence_id is the recurrence_id (see below) of the latest
+-- occurrence generated so far. dtstart of an all-day series is midnight
+-- UTC of its first date.
+CREATE TABLE IF NOT EXISTS todo_series (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    rrule VARCHAR(512) NOT NULL,
+    dtstart TIMESTAMP WITH TIME ZONE NOT NULL,
+    all_day BOOLEAN NOT NULL DEFAULT FALSE,
+    time_zone VARCHAR(64) NOT NULL,
+    last_recurrence_id VARCHAR(32),
+    ended_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_todo_series_user_id ON todo_series(user_id);
+
+-- recurrence_id identifies the occurrence a todo stands for, like the
+-- RECURRENCE-ID of RFC 5545, even after its due date was moved. It is the
+-- occurrence's original date ("2026-10-19") or UTC time in RFC 3339.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS series_id UUID REFERENCES todo_series(id) ON DELETE SET NULL;
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS recurrence_id VARCHAR(32);
+
+-- Completing the same occurrence twice creates the next one only once.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_series_recurrence ON todos(series_id, recurrence_id);
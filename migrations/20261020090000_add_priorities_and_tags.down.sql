@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS todo_tags;
+DROP TABLE IF EXISTS tags;
+
+DROP INDEX IF EXISTS idx_todos_user_id_priority;
+
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS chk_todos_priority;
+ALTER TABLE todos DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_todos_project_id;
+ALTER TABLE todos DROP COLUMN IF EXISTS project_id;
+
+DROP TABLE IF EXISTS projects;
@@ -0,0 +1,7 @@
+-- Subtasks: a todo with a parent_id is a subtask of that todo. The
+-- application limits the depth and prevents cycles; deleting a todo
+-- either deletes its subtasks or moves them up first.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES todos(id) ON DELETE CASCADE;
+ALTER TABLE todos ADD CONSTRAINT chk_todos_parent_id CHECK (parent_id <> id);
+
+CREATE INDEX IF NOT EXISTS idx_todos_parent_id ON todos(parent_id);
@@ -0,0 +1,2 @@
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS chk_todos_notes_length;
+ALTER TABLE todos DROP COLUMN IF EXISTS notes;
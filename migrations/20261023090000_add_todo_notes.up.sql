@@ -0,0 +1,4 @@
+-- Long-form notes of a todo, stored as the Markdown the user wrote. The
+-- API renders and sanitizes them on request.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS notes TEXT;
+ALTER TABLE todos ADD CONSTRAINT chk_todos_notes_length CHECK (char_length(notes) <= 20000);